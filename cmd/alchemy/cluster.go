@@ -1,8 +1,14 @@
 package main
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/SimonRichardson/alchemy/pkg/cluster"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/hashring"
 	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/partition"
+	clusterRegistry "github.com/SimonRichardson/alchemy/pkg/cluster/registry"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/pborman/uuid"
@@ -11,19 +17,27 @@ import (
 
 func configureRemoteCache(debugCluster bool,
 	logger log.Logger,
-	replicationFactor int,
 	apiAddr string, apiPort int,
 	bindAddrHost string, bindAddrPort int,
 	advertiseAddrHost string, advertiseAddrPort int,
 	peers []string,
+	datacenter string,
+	nodeName string,
+	snapshotPath string,
+	weight int,
+	hash string,
 ) (cluster.Peer, error) {
 	clusterMembersConfig, err := members.Build(
 		members.WithPeerType(RegistryPeerType),
-		members.WithNodeName(uuid.New()),
+		members.WithDatacenter(datacenter),
+		members.WithNodeName(nodeName),
 		members.WithAPIAddrPort(apiAddr, apiPort),
 		members.WithBindAddrPort(bindAddrHost, bindAddrPort),
 		members.WithAdvertiseAddrPort(advertiseAddrHost, advertiseAddrPort),
 		members.WithExisting(peers),
+		members.WithSnapshotPath(snapshotPath),
+		members.WithWeight(weight),
+		members.WithHash(hash),
 		members.WithLogOutput(membersLogOutput{
 			output: debugCluster,
 			logger: log.With(logger, "component", "cluster"),
@@ -41,6 +55,96 @@ func configureRemoteCache(debugCluster bool,
 	return cluster.NewPeer(clusterMembers, log.With(logger, "component", "peer")), nil
 }
 
+func configureFederation(debugCluster bool,
+	logger log.Logger,
+	apiAddr string, apiPort int,
+	bindAddrHost string, bindAddrPort int,
+	advertiseAddrHost string, advertiseAddrPort int,
+	peers []string,
+	datacenter string,
+) (cluster.Federation, error) {
+	federationMembersConfig, err := members.Build(
+		members.WithPeerType(RegistryPeerType),
+		// Node names have to be unique across the whole of the WAN pool.
+		members.WithNodeName(fmt.Sprintf("%s.%s", uuid.New(), datacenter)),
+		members.WithAPIAddrPort(apiAddr, apiPort),
+		members.WithBindAddrPort(bindAddrHost, bindAddrPort),
+		members.WithAdvertiseAddrPort(advertiseAddrHost, advertiseAddrPort),
+		members.WithExisting(peers),
+		members.WithDatacenter(datacenter),
+		members.WithWAN(true),
+		members.WithLogOutput(membersLogOutput{
+			output: debugCluster,
+			logger: log.With(logger, "component", "federation"),
+		}),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "members federation config")
+	}
+
+	federationMembers, err := members.NewRealMembers(federationMembersConfig, log.With(logger, "component", "federation_members"))
+	if err != nil {
+		return nil, errors.Wrap(err, "members federation")
+	}
+
+	return cluster.NewFederation(federationMembers, datacenter, log.With(logger, "component", "federation")), nil
+}
+
+// configurePlacement creates the placement for each peer type of the cluster
+// registry. The overrides are in the form of "<peer type>=<placement>", any
+// peer type without an override uses the default placement.
+func configurePlacement(defaultPlacement string,
+	overrides []string,
+	hash string,
+	vnodes int,
+	partitions int,
+) (clusterRegistry.PlacementFn, error) {
+	placements := make(map[string]string, len(overrides))
+	for _, v := range append([]string{"=" + defaultPlacement}, overrides...) {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid placement %q, expected <peer type>=<placement>", v)
+		}
+
+		// Verify the placement up front, so that a typo doesn't fail later
+		// on when the first member of a peer type joins.
+		if _, err := newPlacement(parts[1], hash, vnodes, partitions); err != nil {
+			return nil, err
+		}
+		placements[parts[0]] = parts[1]
+	}
+
+	return func(keyType string) hashring.Placement {
+		name, ok := placements[keyType]
+		if !ok {
+			name = placements[""]
+		}
+		placement, _ := newPlacement(name, hash, vnodes, partitions)
+		return placement
+	}, nil
+}
+
+// placements returns the names of all the placements that can be created
+// with newPlacement.
+func placements() []string {
+	return append(hashring.Placements(), partition.PlacementPartition)
+}
+
+// newPlacement creates a new Placement from the name of the placement, the
+// partition placement lives outside of the hashring package so it's created
+// here.
+func newPlacement(name, hash string, vnodes, partitions int) (hashring.Placement, error) {
+	if name != partition.PlacementPartition {
+		return hashring.NewPlacement(name, hash, vnodes)
+	}
+
+	hashFn, err := hashring.NewHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	return partition.New(hashFn, partitions)
+}
+
 type membersLogOutput struct {
 	output bool
 	logger log.Logger
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/hashring"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/partition"
+)
+
+func TestConfigurePlacement(t *testing.T) {
+	t.Parallel()
+
+	t.Run("overrides", func(t *testing.T) {
+		fn, err := configurePlacement(hashring.PlacementRing,
+			[]string{"peertype:cache=maglev"},
+			hashring.HashMurmur3,
+			2,
+			partition.DefaultPartitions,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := fn("peertype:cache").(*hashring.Maglev); !ok {
+			t.Errorf("expected: *hashring.Maglev, actual: %T", fn("peertype:cache"))
+		}
+		if _, ok := fn("peertype:registry").(*hashring.HashRing); !ok {
+			t.Errorf("expected: *hashring.HashRing, actual: %T", fn("peertype:registry"))
+		}
+	})
+
+	t.Run("partition", func(t *testing.T) {
+		fn, err := configurePlacement(partition.PlacementPartition,
+			nil,
+			hashring.HashMurmur3,
+			2,
+			16,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, ok := fn("peertype:cache").(*partition.Partitioner)
+		if !ok {
+			t.Fatalf("expected: *partition.Partitioner, actual: %T", fn("peertype:cache"))
+		}
+		if expected, actual := 16, len(p.Table().Owners); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, v := range []string{"peertype:cache", "peertype:cache=bad"} {
+			_, err := configurePlacement(hashring.PlacementRing, []string{v}, hashring.HashMurmur3, 2, partition.DefaultPartitions)
+
+			if expected, actual := false, err == nil; expected != actual {
+				t.Errorf("expected: %t, actual: %t", expected, actual)
+			}
+		}
+	})
+}
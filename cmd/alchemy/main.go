@@ -16,6 +16,7 @@ var version = "dev"
 
 const (
 	defaultAPIPort     = 8080
+	defaultGRPCPort    = 8081
 	defaultClusterPort = 8079
 	defaultAddr        = "0.0.0.0:0"
 )
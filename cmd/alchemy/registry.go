@@ -7,24 +7,39 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/SimonRichardson/alchemy/pkg/cluster"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/hashring"
 	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/partition"
+	clusterRegistry "github.com/SimonRichardson/alchemy/pkg/cluster/registry"
+	"github.com/SimonRichardson/alchemy/pkg/dns"
 	"github.com/SimonRichardson/alchemy/pkg/registry"
+	"github.com/SimonRichardson/alchemy/pkg/registry/registrypb"
 	"github.com/SimonRichardson/alchemy/pkg/status"
 	"github.com/SimonRichardson/flagset"
 	"github.com/SimonRichardson/gexec"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	miekgdns "github.com/miekg/dns"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
 )
 
 const (
-	defaultClusterReplicationFactor = 5
-	defaultMetricsRegistration      = true
-	defaultRegistryTicker           = time.Second * 10
+	defaultDatacenter           = "dc1"
+	defaultClusterWANPort       = 8302
+	defaultRingVNodes           = 5
+	defaultRingReplicas         = clusterRegistry.DefaultReplicas
+	defaultClusterWeight        = 1
+	defaultMetricsRegistration  = true
+	defaultRegistryTicker       = time.Second * 10
+	defaultDNSTTL               = time.Second * 5
+	defaultSnapshotInterval     = time.Second * 30
+	defaultConsistencyThreshold = time.Second * 30
 )
 
 const (
@@ -39,16 +54,36 @@ func runRegistry(args []string) error {
 		debug                    = flags.Bool("debug", false, "debug logging")
 		debugCluster             = flags.Bool("debug.cluster", false, "debug cluster logging")
 		apiAddr                  = flags.String("api", defaultAPIAddr, "listen address for query API")
+		grpcAddr                 = flags.String("grpc", "", "optional, listen address for the gRPC API")
 		clusterBindAddr          = flags.String("cluster", defaultClusterAddr, "listen address for cluster")
 		clusterAdvertiseAddr     = flags.String("cluster.advertise-addr", "", "optional, explicit address to advertise in cluster")
-		clusterReplicationFactor = flags.Int("cluster.replication.factor", defaultClusterReplicationFactor, "replication factor for node configuration")
+		clusterWANAddr           = flags.String("cluster.wan", "", "optional, listen address for the datacenter federation")
+		clusterWANAdvertiseAddr  = flags.String("cluster.wan.advertise-addr", "", "optional, explicit address to advertise in the datacenter federation")
+		clusterWANMerge          = flags.Bool("cluster.wan.merge", false, "merge peers from other datacenters into service queries")
+		datacenter               = flags.String("dc", defaultDatacenter, "datacenter the node belongs to")
+		dnsAddr                  = flags.String("dns", "", "optional, listen address for the DNS interface")
+		dnsDomain                = flags.String("dns.domain", dns.DefaultDomain, "domain the DNS interface is authoritative for")
+		dnsTTL                   = flags.Duration("dns.ttl", defaultDNSTTL, "time to live of the DNS answers")
+		clusterReplicationFactor = flags.Int("cluster.replication.factor", 0, "deprecated, use -ring.vnodes")
+		ringVNodes               = flags.Int("ring.vnodes", defaultRingVNodes, "number of virtual nodes of each node on the hash ring, which only changes how evenly the keys are spread")
+		ringReplicas             = flags.Int("ring.replicas", defaultRingReplicas, "number of nodes that own a key, when a lookup doesn't ask for a number")
+		clusterPlacement         = flags.String("cluster.placement", hashring.PlacementRing, fmt.Sprintf("placement of the peer types in the registry (%s)", strings.Join(placements(), ", ")))
+		clusterPartitions        = flags.Int("cluster.partitions", partition.DefaultPartitions, "number of partitions the keyspace is split in to by the partition placement")
+		clusterHash              = flags.String("cluster.hash", hashring.HashMurmur3, fmt.Sprintf("hash of the keys in the registry, every node must use the same hash (%s)", strings.Join(hashring.Hashes(), ", ")))
+		clusterWeight            = flags.Int("cluster.weight", defaultClusterWeight, "weight of the node, a larger weight owns more of the hash ring")
 		metricsRegistration      = flags.Bool("metrics.registration", defaultMetricsRegistration, "registration of metrics on launch")
 		registryTicker           = flags.Duration("registry.ticker", defaultRegistryTicker, "interval duration for cluster peer querying")
+		consistencyThreshold     = flags.Duration("registry.consistency.threshold", defaultConsistencyThreshold, "duration the nodes can disagree on the ring before it's reported")
+		dataDir                  = flags.String("data-dir", "", "optional, directory to persist the cluster state to for a fast restart")
 
-		clusterPeers stringSlice
+		clusterPeers      stringSlice
+		clusterWANPeers   stringSlice
+		clusterPlacements stringSlice
 	)
 
 	flags.Var(&clusterPeers, "peer", "cluster peer host:port (repeatable)")
+	flags.Var(&clusterWANPeers, "cluster.wan.peer", "datacenter federation peer host:port (repeatable)")
+	flags.Var(&clusterPlacements, "cluster.placement.type", "placement of a peer type in the form of <peer type>=<placement> (repeatable)")
 	flags.Usage = usageFor(flags, "registry [flags]")
 	if err := flags.Parse(args); err != nil {
 		return nil
@@ -66,6 +101,25 @@ func runRegistry(args []string) error {
 		logger = level.NewFilter(logger, logLevel)
 	}
 
+	// The replication factor was only ever the number of virtual nodes, the
+	// number of nodes that own a key is the number of replicas.
+	if *clusterReplicationFactor > 0 {
+		level.Warn(logger).Log("reason", "-cluster.replication.factor is deprecated, use -ring.vnodes")
+		*ringVNodes = *clusterReplicationFactor
+	}
+	if *ringVNodes < 1 {
+		return errors.Errorf("invalid number of virtual nodes %d", *ringVNodes)
+	}
+	if *ringReplicas < 1 {
+		return errors.Errorf("invalid number of replicas %d", *ringReplicas)
+	}
+
+	// Every node has to hash the keys the same way, so verify the hash before
+	// it's advertised to the cluster.
+	if _, err := hashring.NewHash(*clusterHash); err != nil {
+		return err
+	}
+
 	// Instrumentation
 	connectedClients := prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: "coherence",
@@ -117,17 +171,111 @@ func runRegistry(args []string) error {
 		}
 	}
 
+	// Persisting the state of the cluster allows a restarted node to keep its
+	// identity and rejoin the previously known peers.
+	var snapshotPath string
+	if *dataDir != "" {
+		var err error
+		if snapshotPath, err = membersSnapshotPath(*dataDir); err != nil {
+			return err
+		}
+	}
+	nodeName, err := loadNodeName(*dataDir)
+	if err != nil {
+		return err
+	}
+
 	peer, err := configureRemoteCache(*debugCluster,
 		logger,
-		*clusterReplicationFactor,
-		*apiAddr, defaultAPIPort,
+		apiHost, apiPort,
 		chp.BindHost, chp.BindPort,
 		chp.AdvertiseHost, chp.AdvertisePort,
 		clusterPeers.Slice(),
+		*datacenter,
+		nodeName,
+		snapshotPath,
+		*clusterWeight,
+		*clusterHash,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Federation between datacenters is optional, only registries that are
+	// given a WAN address take part.
+	var federation cluster.Federation
+	if *clusterWANAddr != "" {
+		whp, err := cluster.CalculateHostPorts(
+			*clusterWANAddr, *clusterWANAdvertiseAddr,
+			defaultClusterWANPort, clusterWANPeers, logger,
+		)
+		if err != nil {
+			return errors.Wrap(err, "calculating federation hosts and ports")
+		}
+
+		federation, err = configureFederation(*debugCluster,
+			logger,
+			apiHost, apiPort,
+			whp.BindHost, whp.BindPort,
+			whp.AdvertiseHost, whp.AdvertisePort,
+			clusterWANPeers.Slice(),
+			*datacenter,
+		)
+		if err != nil {
+			return err
+		}
+
+		if *clusterWANMerge {
+			peer = cluster.NewFederatedPeer(peer, federation)
+		}
+	}
+
+	// The cluster registry is kept up to date by the registry API, which
+	// listens to the member events of the peer.
+	placementFn, err := configurePlacement(*clusterPlacement,
+		clusterPlacements.Slice(),
+		*clusterHash,
+		*ringVNodes,
+		*clusterPartitions,
 	)
 	if err != nil {
 		return err
 	}
+	reg := clusterRegistry.NewWithPlacement(placementFn,
+		clusterRegistry.WithReplicas(*ringReplicas),
+	)
+	var restored []clusterRegistry.Key
+	if *dataDir != "" {
+		if restored, err = restoreRegistry(*dataDir, reg); err != nil {
+			return err
+		}
+	}
+
+	// Every node advertises the checksums of its registry, so that any
+	// disagreement between the nodes can be spotted.
+	consistency := registry.NewConsistency(peer,
+		reg,
+		*registryTicker,
+		*consistencyThreshold,
+		"coherence",
+		log.With(logger, "component", "consistency"),
+	)
+	if *metricsRegistration {
+		prometheus.MustRegister(
+			registry.NewStatsCollector("coherence", reg),
+			consistency,
+		)
+	}
+	registryAPI := registry.NewAPI(
+		peer,
+		reg,
+		federation,
+		consistency,
+		*registryTicker,
+		log.With(logger, "component", "store_api"),
+		connectedClients.WithLabelValues("api"),
+		apiDuration,
+	)
 
 	// Execution group.
 	g := gexec.NewGroup()
@@ -138,23 +286,65 @@ func runRegistry(args []string) error {
 			if _, err := peer.Join(); err != nil {
 				return err
 			}
+			if err := reconcileRegistry(peer, reg, restored); err != nil {
+				level.Warn(logger).Log("reason", "reconcile registry", "err", err)
+			}
 			<-cancel
 			return peer.Leave()
 		}, func(error) {
 			close(cancel)
 		})
 	}
+	if federation != nil {
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			if _, err := federation.Join(); err != nil {
+				return err
+			}
+			<-cancel
+			return federation.Leave()
+		}, func(error) {
+			close(cancel)
+		})
+	}
+	{
+		g.Add(func() error {
+			return registryAPI.Run()
+		}, func(error) {
+			registryAPI.Stop()
+		})
+	}
+	{
+		g.Add(func() error {
+			return consistency.Run()
+		}, func(error) {
+			consistency.Stop()
+		})
+	}
+	if *dataDir != "" {
+		cancel := make(chan struct{})
+		g.Add(func() error {
+			ticker := time.NewTicker(defaultSnapshotInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					if err := snapshotRegistry(*dataDir, reg); err != nil {
+						level.Warn(logger).Log("reason", "snapshot", "err", err)
+					}
+				case <-cancel:
+					return snapshotRegistry(*dataDir, reg)
+				}
+			}
+		}, func(error) {
+			close(cancel)
+		})
+	}
 	{
 		g.Add(func() error {
 			mux := http.NewServeMux()
-			mux.Handle("/registry/", http.StripPrefix("/registry", registry.NewAPI(
-				peer,
-				nil,
-				*registryTicker,
-				log.With(logger, "component", "store_api"),
-				connectedClients.WithLabelValues("api"),
-				apiDuration,
-			)))
+			mux.Handle("/registry/", http.StripPrefix("/registry", registryAPI))
 			mux.Handle("/status/", status.NewAPI(
 				log.With(logger, "component", "status_api"),
 				connectedClients.WithLabelValues("status"),
@@ -169,6 +359,49 @@ func runRegistry(args []string) error {
 			apiListener.Close()
 		})
 	}
+	if *grpcAddr != "" {
+		grpcNetwork, _, grpcHost, grpcPort, err := cluster.ParseAddr(*grpcAddr, defaultGRPCPort)
+		if err != nil {
+			return err
+		}
+
+		grpcListener, err := net.Listen(grpcNetwork, net.JoinHostPort(grpcHost, strconv.Itoa(grpcPort)))
+		if err != nil {
+			return err
+		}
+		level.Debug(logger).Log("gRPC", fmt.Sprintf("%s://%s", grpcNetwork, net.JoinHostPort(grpcHost, strconv.Itoa(grpcPort))))
+
+		server := grpc.NewServer()
+		registrypb.RegisterRegistryServer(server, registry.NewGRPCServer(
+			peer,
+			reg,
+			log.With(logger, "component", "grpc_api"),
+		))
+		g.Add(func() error {
+			return server.Serve(grpcListener)
+		}, func(error) {
+			server.Stop()
+		})
+	}
+	if *dnsAddr != "" {
+		handler := dns.NewServer(reg,
+			*dnsDomain,
+			*dnsTTL,
+			log.With(logger, "component", "dns"),
+		)
+		for _, network := range []string{"udp", "tcp"} {
+			server := &miekgdns.Server{
+				Addr:    *dnsAddr,
+				Net:     network,
+				Handler: handler,
+			}
+			g.Add(func() error {
+				return server.ListenAndServe()
+			}, func(error) {
+				server.Shutdown()
+			})
+		}
+	}
 	gexec.Interrupt(g)
 	return g.Run()
 }
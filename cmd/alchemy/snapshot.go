@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	clusterRegistry "github.com/SimonRichardson/alchemy/pkg/cluster/registry"
+	"github.com/pborman/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	dataDirNodeID           = "node-id"
+	dataDirMembersSnapshot  = "serf/local.snapshot"
+	dataDirRegistrySnapshot = "registry.snapshot"
+)
+
+// loadNodeName returns the node name that's stored in the data directory, so
+// that a restarted node keeps the same identity in the cluster. A new node
+// name is generated if one hasn't been stored yet. Without a data directory a
+// new node name is always generated.
+func loadNodeName(dataDir string) (string, error) {
+	if dataDir == "" {
+		return uuid.New(), nil
+	}
+
+	path := filepath.Join(dataDir, dataDirNodeID)
+	b, err := ioutil.ReadFile(path)
+	if err == nil {
+		if name := strings.TrimSpace(string(b)); name != "" {
+			return name, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", errors.Wrap(err, "reading node id")
+	}
+
+	name := uuid.New()
+	if err := writeFile(path, []byte(name)); err != nil {
+		return "", errors.Wrap(err, "writing node id")
+	}
+	return name, nil
+}
+
+// membersSnapshotPath returns the path of the members snapshot in the data
+// directory, creating the directory of the snapshot if it doesn't exist, as
+// the members won't create it.
+func membersSnapshotPath(dataDir string) (string, error) {
+	path := filepath.Join(dataDir, dataDirMembersSnapshot)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", errors.Wrap(err, "creating members snapshot directory")
+	}
+	return path, nil
+}
+
+// restoreRegistry restores the registry from the snapshot in the data
+// directory, returning the restored keys. A missing snapshot isn't an error,
+// as there's nothing to restore on the first start.
+func restoreRegistry(dataDir string, reg clusterRegistry.Registry) ([]clusterRegistry.Key, error) {
+	file, err := os.Open(filepath.Join(dataDir, dataDirRegistrySnapshot))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "opening registry snapshot")
+	}
+	defer file.Close()
+
+	keys, err := reg.Restore(file)
+	return keys, errors.Wrap(err, "restoring registry snapshot")
+}
+
+// reconcileRegistry removes the restored keys of any node that isn't alive in
+// the cluster. The nodes that went away while this node was down never send an
+// event to remove their keys, so once the cluster has been joined the keys are
+// checked against the alive peers.
+func reconcileRegistry(peer cluster.Peer, reg clusterRegistry.Registry, keys []clusterRegistry.Key) error {
+	alive := make(map[string]struct{})
+	if err := peer.Walk(func(info members.PeerInfo) error {
+		alive[info.Name] = struct{}{}
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "walking peers")
+	}
+
+	for _, v := range keys {
+		if _, ok := alive[v.Name()]; !ok {
+			reg.Remove(v)
+		}
+	}
+	return nil
+}
+
+// snapshotRegistry writes a snapshot of the registry to the data directory.
+func snapshotRegistry(dataDir string, reg clusterRegistry.Registry) error {
+	var buf bytes.Buffer
+	if err := reg.Snapshot(&buf); err != nil {
+		return errors.Wrap(err, "snapshotting registry")
+	}
+	return writeFile(filepath.Join(dataDir, dataDirRegistrySnapshot), buf.Bytes())
+}
+
+// writeFile writes the file via a temporary file, so that a crash part way
+// through doesn't leave a truncated file behind.
+func writeFile(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/hashring"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	clusterMocks "github.com/SimonRichardson/alchemy/pkg/cluster/mocks"
+	clusterRegistry "github.com/SimonRichardson/alchemy/pkg/cluster/registry"
+	"github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+	"github.com/spaolacci/murmur3"
+)
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+
+	t.Run("members from an empty data directory", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "alchemy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		path, err := membersSnapshotPath(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		peer, err := configureRemoteCache(false,
+			log.NewNopLogger(),
+			"127.0.0.1", 8080,
+			"127.0.0.1", 0,
+			"", 0,
+			nil,
+			"dc1",
+			"a",
+			path,
+			1,
+			hashring.HashMurmur3,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer peer.Leave()
+
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected: snapshot, actual: %v", err)
+		}
+	})
+
+	t.Run("reconcile removes the restored keys of dead nodes", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		dir, err := ioutil.TempDir("", "alchemy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		src := clusterRegistry.New(murmur3.Sum64, 3)
+		src.Add(key{"a", "10.0.0.1:8080"})
+		src.Add(key{"b", "10.0.0.2:8080"})
+		if err := snapshotRegistry(dir, src); err != nil {
+			t.Fatal(err)
+		}
+
+		dst := clusterRegistry.New(murmur3.Sum64, 3)
+		restored, err := restoreRegistry(dir, dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 2, len(restored); expected != actual {
+			t.Fatalf("expected: %d, actual: %d", expected, actual)
+		}
+
+		peer := clusterMocks.NewMockPeer(ctrl)
+		peer.EXPECT().Walk(gomock.Any()).DoAndReturn(func(fn func(members.PeerInfo) error) error {
+			return fn(members.PeerInfo{Name: "a"})
+		})
+
+		if err := reconcileRegistry(peer, dst, restored); err != nil {
+			t.Fatal(err)
+		}
+
+		info, ok := dst.Info("peertype:test")
+		if !ok {
+			t.Fatal("expected: info")
+		}
+		if expected, actual := 1, len(info.Keys["10.0.0.1:8080"]); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := 0, len(info.Keys["10.0.0.2:8080"]); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+}
+
+type key struct {
+	name, address string
+}
+
+func (k key) Name() string            { return k.name }
+func (k key) Type() string            { return "peertype:test" }
+func (k key) Address() string         { return k.address }
+func (k key) Tags() map[string]string { return nil }
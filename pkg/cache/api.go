@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/SimonRichardson/alchemy/pkg/api"
+	"github.com/SimonRichardson/alchemy/pkg/metrics"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/gorilla/mux"
+)
+
+// These are the cache API URL paths.
+const (
+	APIPathCacheQuery = "/cache/{name}/{key}"
+)
+
+const (
+	defaultContentType = "application/octet-stream"
+)
+
+// API serves the keys of the caches to the other nodes of the cluster.
+//
+//     GET /cache/{name}/{key}
+//         Returns the value of the key from the cache with the name, loading
+//         the key if it's not cached. The name and the key are path escaped.
+//         Returns 404 Not Found if there is no cache with the name.
+//         Returns 500 Internal Server Error if the key can't be loaded.
+//
+type API struct {
+	handler  http.Handler
+	caches   map[string]*Cache
+	logger   log.Logger
+	clients  metrics.Gauge
+	duration metrics.HistogramVec
+	errors   api.Error
+}
+
+// NewAPI creates a API with the correct dependencies.
+// The API is an http.Handler and can ServeHTTP.
+func NewAPI(caches []*Cache,
+	logger log.Logger,
+	clients metrics.Gauge,
+	duration metrics.HistogramVec,
+) *API {
+	api := &API{
+		caches:   make(map[string]*Cache, len(caches)),
+		logger:   logger,
+		clients:  clients,
+		duration: duration,
+		errors:   api.NewError(logger),
+	}
+	for _, v := range caches {
+		api.caches[v.Name()] = v
+	}
+	{
+		// The keys can contain slashes, so the path is matched before it's
+		// unescaped.
+		router := mux.NewRouter().StrictSlash(true).UseEncodedPath()
+		router.Methods("GET").Path(APIPathCacheQuery).HandlerFunc(api.handleGet)
+		router.NotFoundHandler = http.HandlerFunc(api.errors.NotFound)
+		api.handler = router
+	}
+	return api
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	level.Debug(a.logger).Log("method", r.Method, "url", r.URL.String())
+
+	iw := &interceptingWriter{http.StatusOK, w}
+	w = iw
+
+	// Metrics
+	a.clients.Inc()
+	defer a.clients.Dec()
+
+	defer func(begin time.Time) {
+		a.duration.WithLabelValues(
+			r.Method,
+			APIPathCacheQuery,
+			strconv.Itoa(iw.code),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	a.handler.ServeHTTP(w, r)
+}
+
+func (a *API) handleGet(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	vars := mux.Vars(r)
+	name, err := url.PathUnescape(vars["name"])
+	if err != nil {
+		a.errors.BadRequest(w, r, err.Error())
+		return
+	}
+	key, err := url.PathUnescape(vars["key"])
+	if err != nil {
+		a.errors.BadRequest(w, r, err.Error())
+		return
+	}
+
+	cache, ok := a.caches[name]
+	if !ok {
+		a.errors.NotFound(w, r)
+		return
+	}
+
+	value, err := cache.getLocally(r.Context(), key)
+	if err != nil {
+		a.errors.InternalServerError(w, r, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", defaultContentType)
+	if _, err := w.Write(value); err != nil {
+		level.Warn(a.logger).Log("reason", "writing value", "err", err)
+	}
+}
+
+type interceptingWriter struct {
+	code int
+	http.ResponseWriter
+}
+
+func (iw *interceptingWriter) WriteHeader(code int) {
+	iw.code = code
+	iw.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,316 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultCacheBytes    = 64 << 20
+	defaultHotCacheBytes = 8 << 20
+	defaultHotRatio      = 10
+	defaultFetchTimeout  = time.Second * 5
+)
+
+// Loader loads the value of a key when it isn't in any cache. The loader is
+// only ever called on the node that owns the key, unless the owner can't be
+// reached.
+type Loader interface {
+	Load(ctx context.Context, key string) ([]byte, error)
+}
+
+// LoaderFunc adapts a function in to a Loader.
+type LoaderFunc func(ctx context.Context, key string) ([]byte, error)
+
+// Load calls the function.
+func (f LoaderFunc) Load(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// Option defines a option for configuring a Cache
+type Option func(*Cache)
+
+// WithCacheBytes sets the number of bytes of the keys the local node owns
+// that are kept.
+func WithCacheBytes(bytes int64) Option {
+	return func(c *Cache) {
+		c.main = newLRU(bytes)
+	}
+}
+
+// WithHotCacheBytes sets the number of bytes of the hot keys owned by other
+// nodes that are kept.
+func WithHotCacheBytes(bytes int64) Option {
+	return func(c *Cache) {
+		c.hot = newLRU(bytes)
+	}
+}
+
+// WithHotRatio sets how often a key fetched from another node is kept in the
+// hot cache, one in every ratio fetches is kept. Keys that are fetched often
+// are more likely to be kept, which spreads the load of the hot keys across
+// the cluster. A ratio of zero never keeps any keys.
+func WithHotRatio(ratio int) Option {
+	return func(c *Cache) {
+		c.hotRatio = ratio
+	}
+}
+
+// WithClient sets the HTTP client used to fetch keys from the other nodes.
+func WithClient(client *http.Client) Option {
+	return func(c *Cache) {
+		c.client = client
+	}
+}
+
+// Cache is a distributed read-through cache. Every key is owned by a single
+// node of the cluster, which loads and keeps the value. The other nodes fetch
+// the value from the owner over HTTP. Concurrent gets of the same key are
+// collapsed in to one load or fetch.
+type Cache struct {
+	name     string
+	loader   Loader
+	picker   PeerPicker
+	client   *http.Client
+	hotRatio int
+	logger   log.Logger
+
+	// The gets of the local node and of the other nodes are collapsed in to
+	// separate flights, so that a node serving a key for another node never
+	// waits on its own fetch of the key from that node.
+	flight singleflight.Group
+	loads  singleflight.Group
+
+	mtx  sync.Mutex
+	main *lru
+	hot  *lru
+
+	stats Stats
+}
+
+// Stats are the counters of a Cache.
+type Stats struct {
+	Gets       int64 `json:"gets"`
+	Hits       int64 `json:"hits"`
+	Loads      int64 `json:"loads"`
+	PeerLoads  int64 `json:"peer_loads"`
+	PeerErrors int64 `json:"peer_errors"`
+	ServerGets int64 `json:"server_gets"`
+}
+
+// New creates a Cache with the name, every node must use the same name for
+// the same Cache. The loader loads the keys the local node owns and the
+// picker picks the owner of a key.
+func New(name string,
+	loader Loader,
+	picker PeerPicker,
+	logger log.Logger,
+	opts ...Option,
+) *Cache {
+	c := &Cache{
+		name:     name,
+		loader:   loader,
+		picker:   picker,
+		client:   &http.Client{Timeout: defaultFetchTimeout},
+		hotRatio: defaultHotRatio,
+		logger:   logger,
+		main:     newLRU(defaultCacheBytes),
+		hot:      newLRU(defaultHotCacheBytes),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Name returns the name of the Cache.
+func (c *Cache) Name() string {
+	return c.name
+}
+
+// Get returns the value of the key, either from the local caches, from the
+// node that owns the key or by loading it. If the owner can't be reached the
+// key is loaded locally instead, but if the owner answers with an error, such
+// as failing to load the key, a StatusError is returned.
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, error) {
+	atomic.AddInt64(&c.stats.Gets, 1)
+	if v, ok := c.lookup(key); ok {
+		atomic.AddInt64(&c.stats.Hits, 1)
+		return clone(v), nil
+	}
+
+	v, err := c.do(ctx, &c.flight, key, func(ctx context.Context) ([]byte, error) {
+		// Another get may have filled the cache whilst this one was waiting.
+		if v, ok := c.lookup(key); ok {
+			return v, nil
+		}
+
+		if addr, ok := c.picker.PickPeer(key); ok {
+			v, err := c.fetch(ctx, addr, key)
+			if err == nil {
+				atomic.AddInt64(&c.stats.PeerLoads, 1)
+				if c.hotRatio > 0 && rand.Intn(c.hotRatio) == 0 {
+					c.populate(c.hot, key, v)
+				}
+				return v, nil
+			}
+
+			atomic.AddInt64(&c.stats.PeerErrors, 1)
+			level.Warn(c.logger).Log("reason", "fetch from peer", "peer", addr, "key", key, "err", err)
+
+			// The owner was reached, so loading the key locally would only
+			// hide the error of the owner.
+			if _, ok := err.(StatusError); ok {
+				return nil, err
+			}
+		}
+		return c.load(ctx, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clone(v), nil
+}
+
+// Remove the key from the local caches. The key isn't removed from the caches
+// of the other nodes.
+func (c *Cache) Remove(key string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.main.Remove(key)
+	c.hot.Remove(key)
+}
+
+// Stats returns a copy of the counters of the Cache.
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Gets:       atomic.LoadInt64(&c.stats.Gets),
+		Hits:       atomic.LoadInt64(&c.stats.Hits),
+		Loads:      atomic.LoadInt64(&c.stats.Loads),
+		PeerLoads:  atomic.LoadInt64(&c.stats.PeerLoads),
+		PeerErrors: atomic.LoadInt64(&c.stats.PeerErrors),
+		ServerGets: atomic.LoadInt64(&c.stats.ServerGets),
+	}
+}
+
+// getLocally returns the value of the key for another node, without ever
+// asking any other node for the key or waiting on a get that does, so that
+// requests can't go round in circles when the nodes disagree on the owner.
+func (c *Cache) getLocally(ctx context.Context, key string) ([]byte, error) {
+	atomic.AddInt64(&c.stats.ServerGets, 1)
+	if v, ok := c.lookup(key); ok {
+		atomic.AddInt64(&c.stats.Hits, 1)
+		return v, nil
+	}
+
+	return c.do(ctx, &c.loads, key, func(ctx context.Context) ([]byte, error) {
+		if v, ok := c.lookup(key); ok {
+			return v, nil
+		}
+		return c.load(ctx, key)
+	})
+}
+
+// do collapses the concurrent calls for the key in the group in to a single
+// call of fn. The call is shared by every caller, so it's given a context
+// that isn't cancelled along with the context of the first caller. Instead
+// each caller stops waiting once its own context is done.
+func (c *Cache) do(ctx context.Context, group *singleflight.Group, key string, fn func(context.Context) ([]byte, error)) ([]byte, error) {
+	res := group.DoChan(key, func() (interface{}, error) {
+		return fn(context.WithoutCancel(ctx))
+	})
+	select {
+	case r := <-res:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		return r.Val.([]byte), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// load the key with the loader and keep the value in the main cache.
+func (c *Cache) load(ctx context.Context, key string) ([]byte, error) {
+	atomic.AddInt64(&c.stats.Loads, 1)
+	v, err := c.loader.Load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	v = clone(v)
+	c.populate(c.main, key, v)
+	return v, nil
+}
+
+// fetch the value of the key from the node at the address.
+func (c *Cache) fetch(ctx context.Context, addr, key string) ([]byte, error) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   addr,
+		Path:   fmt.Sprintf("/cache/%s/%s", c.name, key),
+		RawPath: fmt.Sprintf("/cache/%s/%s",
+			url.PathEscape(c.name),
+			url.PathEscape(key),
+		),
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, StatusError{Code: resp.StatusCode}
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// StatusError is returned when the owner of a key answers with an error,
+// rather than the value of the key.
+type StatusError struct {
+	Code int
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", e.Code)
+}
+
+func (c *Cache) lookup(key string) ([]byte, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if v, ok := c.main.Get(key); ok {
+		return v, true
+	}
+	return c.hot.Get(key)
+}
+
+func (c *Cache) populate(cache *lru, key string, value []byte) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	cache.Add(key, value)
+}
+
+// clone the value, so that the cached value can't be changed by the caller.
+func clone(v []byte) []byte {
+	return append([]byte(nil), v...)
+}
@@ -0,0 +1,351 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spaolacci/murmur3"
+)
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	t.Run("load", func(t *testing.T) {
+		var (
+			loader = &countingLoader{}
+			cache  = New("test", loader, picker(""), log.NewNopLogger())
+		)
+
+		for i := 0; i < 2; i++ {
+			value, err := cache.Get(context.Background(), "key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected, actual := "value:key", string(value); expected != actual {
+				t.Errorf("expected: %q, actual: %q", expected, actual)
+			}
+		}
+		if expected, actual := int64(1), loader.count(); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := int64(1), cache.Stats().Hits; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("load error", func(t *testing.T) {
+		cache := New("test", LoaderFunc(func(context.Context, string) ([]byte, error) {
+			return nil, errors.New("bad")
+		}), picker(""), log.NewNopLogger())
+
+		if _, err := cache.Get(context.Background(), "key"); err == nil {
+			t.Errorf("expected: error, actual: %v", err)
+		}
+	})
+
+	t.Run("singleflight", func(t *testing.T) {
+		var (
+			release = make(chan struct{})
+			loader  = &countingLoader{wait: release}
+			cache   = New("test", loader, picker(""), log.NewNopLogger())
+			wg      sync.WaitGroup
+		)
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := cache.Get(context.Background(), "key"); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		for cache.Stats().Gets < 10 {
+			time.Sleep(time.Millisecond)
+		}
+		close(release)
+		wg.Wait()
+
+		if expected, actual := int64(1), loader.count(); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("values are copied", func(t *testing.T) {
+		cache := New("test", &countingLoader{}, picker(""), log.NewNopLogger())
+
+		value, err := cache.Get(context.Background(), "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		value[0] = 'X'
+
+		value, err = cache.Get(context.Background(), "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := "value:key", string(value); expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("peer", func(t *testing.T) {
+		var (
+			owner       = &countingLoader{}
+			ownerCache  = New("test", owner, picker(""), log.NewNopLogger())
+			server      = httptest.NewServer(newAPI(ownerCache))
+			local       = &countingLoader{}
+			localCache  = New("test", local, picker(strings.TrimPrefix(server.URL, "http://")), log.NewNopLogger(), WithHotRatio(1))
+			keyWithPath = "a/b c"
+		)
+		defer server.Close()
+
+		for i := 0; i < 2; i++ {
+			value, err := localCache.Get(context.Background(), keyWithPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected, actual := "value:"+keyWithPath, string(value); expected != actual {
+				t.Errorf("expected: %q, actual: %q", expected, actual)
+			}
+		}
+
+		// The second get is served from the hot cache.
+		if expected, actual := int64(1), ownerCache.Stats().ServerGets; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := int64(1), owner.count(); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := int64(0), local.count(); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("peer unreachable", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+
+		var (
+			local = &countingLoader{}
+			cache = New("test", local, picker(strings.TrimPrefix(server.URL, "http://")), log.NewNopLogger())
+		)
+		if _, err := cache.Get(context.Background(), "key"); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := int64(1), local.count(); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := int64(1), cache.Stats().PeerErrors; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("peer error", func(t *testing.T) {
+		var (
+			owner = New("test", LoaderFunc(func(context.Context, string) ([]byte, error) {
+				return nil, errors.New("bad")
+			}), picker(""), log.NewNopLogger())
+			server = httptest.NewServer(newAPI(owner))
+			local  = &countingLoader{}
+			cache  = New("test", local, picker(strings.TrimPrefix(server.URL, "http://")), log.NewNopLogger())
+		)
+		defer server.Close()
+
+		_, err := cache.Get(context.Background(), "key")
+		if expected, actual := (StatusError{Code: http.StatusInternalServerError}), err; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := int64(0), local.count(); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("cancelled get", func(t *testing.T) {
+		var (
+			release = make(chan struct{})
+			loader  = &countingLoader{wait: release}
+			cache   = New("test", loader, picker(""), log.NewNopLogger())
+			errs    = make(chan error)
+		)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			_, err := cache.Get(ctx, "key")
+			errs <- err
+		}()
+		for loader.count() < 1 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+
+		if expected, actual := context.Canceled, <-errs; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		// The load is shared, so it carries on for the other gets.
+		go func() {
+			_, err := cache.Get(context.Background(), "key")
+			errs <- err
+		}()
+		for cache.Stats().Gets < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		close(release)
+
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := int64(1), loader.count(); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("owners disagree", func(t *testing.T) {
+		// The transport only lets the fetches through once both nodes are
+		// fetching the key from the other.
+		var (
+			started int32
+			fetched = make(chan struct{})
+			client  = &http.Client{
+				Timeout: time.Second * 2,
+				Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					if atomic.AddInt32(&started, 1) == 2 {
+						close(fetched)
+					}
+					<-fetched
+					return http.DefaultTransport.RoundTrip(req)
+				}),
+			}
+			serverA = httptest.NewUnstartedServer(nil)
+			serverB = httptest.NewUnstartedServer(nil)
+			loaderA = &countingLoader{}
+			loaderB = &countingLoader{}
+			cacheA  = New("test", loaderA, picker(serverB.Listener.Addr().String()), log.NewNopLogger(), WithClient(client))
+			cacheB  = New("test", loaderB, picker(serverA.Listener.Addr().String()), log.NewNopLogger(), WithClient(client))
+		)
+		serverA.Config.Handler = newAPI(cacheA)
+		serverB.Config.Handler = newAPI(cacheB)
+		serverA.Start()
+		serverB.Start()
+		defer serverA.Close()
+		defer serverB.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		for _, c := range []*Cache{cacheA, cacheB} {
+			wg.Add(1)
+			go func(c *Cache) {
+				defer wg.Done()
+				value, err := c.Get(ctx, "key")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if expected, actual := "value:key", string(value); expected != actual {
+					t.Errorf("expected: %q, actual: %q", expected, actual)
+				}
+			}(c)
+		}
+		wg.Wait()
+
+		// Each node loads the key for the other node.
+		if expected, actual := int64(1), loaderA.count(); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := int64(1), loaderB.count(); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("unknown cache", func(t *testing.T) {
+		server := httptest.NewServer(newAPI(New("other", &countingLoader{}, picker(""), log.NewNopLogger())))
+		defer server.Close()
+
+		resp, err := http.Get(fmt.Sprintf("%s/cache/test/key", server.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if expected, actual := http.StatusNotFound, resp.StatusCode; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+}
+
+func TestRingPicker(t *testing.T) {
+	t.Parallel()
+
+	p := NewRingPicker(nil, "peertype:cache", "10.0.0.1:8080", murmur3.Sum64, 10)
+	if _, ok := p.PickPeer("key"); ok {
+		t.Errorf("expected: no peer, actual: %t", ok)
+	}
+
+	p.Set("10.0.0.1:8080", "10.0.0.2:8080")
+
+	var local, remote int
+	for i := 0; i < 100; i++ {
+		if addr, ok := p.PickPeer(fmt.Sprintf("key-%d", i)); ok {
+			if expected, actual := "10.0.0.2:8080", addr; expected != actual {
+				t.Fatalf("expected: %q, actual: %q", expected, actual)
+			}
+			remote++
+		} else {
+			local++
+		}
+	}
+	if local == 0 || remote == 0 {
+		t.Errorf("expected: keys on both peers, actual: local %d, remote %d", local, remote)
+	}
+}
+
+func newAPI(caches ...*Cache) *API {
+	return NewAPI(caches,
+		log.NewNopLogger(),
+		prometheus.NewGauge(prometheus.GaugeOpts{Name: "clients"}),
+		prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "duration"}, []string{"method", "path", "status_code"}),
+	)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// picker always picks the address, an empty address is the local node.
+type picker string
+
+func (p picker) PickPeer(string) (string, bool) {
+	return string(p), p != ""
+}
+
+type countingLoader struct {
+	loads int64
+	wait  chan struct{}
+}
+
+func (l *countingLoader) Load(ctx context.Context, key string) ([]byte, error) {
+	atomic.AddInt64(&l.loads, 1)
+	if l.wait != nil {
+		<-l.wait
+	}
+	return []byte("value:" + key), nil
+}
+
+func (l *countingLoader) count() int64 {
+	return atomic.LoadInt64(&l.loads)
+}
@@ -0,0 +1,77 @@
+package cache
+
+import "container/list"
+
+// lru is a non-thread safe least recently used cache, which is bounded by
+// the number of bytes of the keys and values it holds.
+type lru struct {
+	maxBytes int64
+	bytes    int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type entry struct {
+	key   string
+	value []byte
+}
+
+func newLRU(maxBytes int64) *lru {
+	return &lru{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value of the key, marking the key as the most recently
+// used.
+func (c *lru) Get(key string) ([]byte, bool) {
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*entry).value, true
+}
+
+// Add the value of the key, evicting the least recently used keys until the
+// cache fits in to the bytes again.
+func (c *lru) Add(key string, value []byte) {
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		ent := e.Value.(*entry)
+		c.bytes += int64(len(value)) - int64(len(ent.value))
+		ent.value = value
+	} else {
+		c.items[key] = c.ll.PushFront(&entry{key, value})
+		c.bytes += int64(len(key) + len(value))
+	}
+
+	for c.bytes > c.maxBytes && c.ll.Len() > 0 {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Remove the key from the cache.
+func (c *lru) Remove(key string) {
+	if e, ok := c.items[key]; ok {
+		c.removeElement(e)
+	}
+}
+
+// Len returns the number of keys in the cache.
+func (c *lru) Len() int {
+	return c.ll.Len()
+}
+
+// Bytes returns the number of bytes of the keys and values in the cache.
+func (c *lru) Bytes() int64 {
+	return c.bytes
+}
+
+func (c *lru) removeElement(e *list.Element) {
+	ent := c.ll.Remove(e).(*entry)
+	delete(c.items, ent.key)
+	c.bytes -= int64(len(ent.key) + len(ent.value))
+}
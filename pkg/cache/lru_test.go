@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"testing/quick"
+)
+
+func TestLRU(t *testing.T) {
+	t.Parallel()
+
+	t.Run("bounded", func(t *testing.T) {
+		fn := func(keys []string, maxBytes uint16) bool {
+			c := newLRU(int64(maxBytes))
+			for _, v := range keys {
+				c.Add(v, []byte(v))
+				if c.Bytes() > int64(maxBytes) {
+					return false
+				}
+			}
+			return true
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("evicts least recently used", func(t *testing.T) {
+		c := newLRU(5)
+		c.Add("a", []byte("1"))
+		c.Add("b", []byte("2"))
+		c.Get("a")
+		c.Add("c", []byte("3"))
+
+		for _, v := range []struct {
+			key string
+			ok  bool
+		}{
+			{"a", true},
+			{"b", false},
+			{"c", true},
+		} {
+			if _, ok := c.Get(v.key); v.ok != ok {
+				t.Errorf("expected: %t, actual: %t", v.ok, ok)
+			}
+		}
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		c := newLRU(100)
+		for i := 0; i < 3; i++ {
+			c.Add("a", []byte(fmt.Sprintf("%d", i)))
+		}
+
+		if expected, actual := 1, c.Len(); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := int64(2), c.Bytes(); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/hashring"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+)
+
+// PeerPicker picks the peer that owns a key.
+type PeerPicker interface {
+
+	// PickPeer returns the API address of the peer that owns the key.
+	// Returns false if the local node owns the key.
+	PickPeer(key string) (string, bool)
+}
+
+// RingPicker picks the owner of a key by placing the API addresses of the
+// peers of a type on a HashRing. The ring is kept up to date by registering
+// the RingPicker as an event handler of the peer.
+type RingPicker struct {
+	peer     cluster.Peer
+	peerType members.PeerType
+	self     string
+	hashFn   func([]byte) uint64
+	vnodes   int
+
+	mtx  sync.RWMutex
+	ring *hashring.HashRing
+}
+
+// NewRingPicker creates a RingPicker for the peers of the peer type, where
+// self is the API address the local node advertises. Every node must use the
+// same hash and number of virtual nodes.
+func NewRingPicker(peer cluster.Peer,
+	peerType members.PeerType,
+	self string,
+	hashFn func([]byte) uint64,
+	vnodes int,
+) *RingPicker {
+	return &RingPicker{
+		peer:     peer,
+		peerType: peerType,
+		self:     self,
+		hashFn:   hashFn,
+		vnodes:   vnodes,
+		ring:     hashring.New(hashFn, vnodes),
+	}
+}
+
+// PickPeer returns the API address of the peer that owns the key.
+// Returns false if the local node owns the key, or there are no peers.
+func (p *RingPicker) PickPeer(key string) (string, bool) {
+	p.mtx.RLock()
+	hosts := p.ring.LookupN(key, 1)
+	p.mtx.RUnlock()
+
+	if len(hosts) == 0 || hosts[0] == p.self {
+		return "", false
+	}
+	return hosts[0], true
+}
+
+// Update rebuilds the ring from the current peers of the peer type.
+func (p *RingPicker) Update() error {
+	current, err := p.peer.Current(p.peerType)
+	if err != nil {
+		return err
+	}
+	p.Set(current[p.peerType]...)
+	return nil
+}
+
+// Set replaces the API addresses of the peers on the ring.
+func (p *RingPicker) Set(addrs ...string) {
+	ring := hashring.New(p.hashFn, p.vnodes)
+	for _, v := range addrs {
+		ring.Add(v)
+	}
+
+	p.mtx.Lock()
+	p.ring = ring
+	p.mtx.Unlock()
+}
+
+// HandleEvent updates the ring every time the members of the cluster change.
+func (p *RingPicker) HandleEvent(e members.Event) error {
+	if e.Type() != members.EventMember {
+		return nil
+	}
+	return p.Update()
+}
@@ -32,6 +32,12 @@ type Peer interface {
 	// Bool defines if you want to include the current local node.
 	Current(members.PeerType) (map[members.PeerType][]string, error)
 
+	// Walk over the information of each alive peer in the cluster.
+	Walk(func(members.PeerInfo) error) error
+
+	// SetTags advertises additional tags for this peer to the cluster.
+	SetTags(map[string]string) error
+
 	// Close and shutdown the peer
 	Close()
 }
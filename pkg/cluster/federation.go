@@ -0,0 +1,281 @@
+//go:generate mockgen -package=mocks -destination=./mocks/federation.go github.com/SimonRichardson/alchemy/pkg/cluster Federation
+
+package cluster
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultFederationTimeout = time.Second * 5
+
+	// federationServicesPath is the path of the services query of the
+	// registry API in the remote datacenters.
+	federationServicesPath = "/registry/services"
+)
+
+// Federation represents a WAN gossip pool that links the registry nodes of
+// several datacenters together.
+type Federation interface {
+
+	// Join the WAN pool
+	Join() (int, error)
+
+	// Leave the WAN pool.
+	Leave() error
+
+	// Datacenter returns the name of the local datacenter.
+	Datacenter() string
+
+	// Datacenters returns all the datacenters known to the WAN pool, including
+	// the local datacenter.
+	Datacenters() ([]string, error)
+
+	// Registries returns the API host:ports of the registry nodes found in the
+	// given datacenter.
+	Registries(string) ([]string, error)
+
+	// Current API host:ports for the given type of peer, for every datacenter
+	// apart from the local datacenter. The services are queried from the
+	// registries of each remote datacenter, a datacenter that can't be reached
+	// is left out.
+	Current(members.PeerType) (map[members.PeerType][]string, error)
+}
+
+type federation struct {
+	members    members.Members
+	datacenter string
+	client     *http.Client
+	logger     log.Logger
+}
+
+// NewFederation creates a Federation from members that are configured to
+// gossip over the WAN.
+func NewFederation(members members.Members, datacenter string, logger log.Logger) Federation {
+	return &federation{
+		members:    members,
+		datacenter: datacenter,
+		client:     &http.Client{Timeout: defaultFederationTimeout},
+		logger:     logger,
+	}
+}
+
+func (f *federation) Join() (int, error) {
+	return f.members.Join()
+}
+
+func (f *federation) Leave() error {
+	return f.members.Leave()
+}
+
+func (f *federation) Datacenter() string {
+	return f.datacenter
+}
+
+func (f *federation) Datacenters() ([]string, error) {
+	unique := map[string]struct{}{
+		f.datacenter: struct{}{},
+	}
+	if err := f.members.Walk(func(info members.PeerInfo) error {
+		if info.Datacenter != "" {
+			unique[info.Datacenter] = struct{}{}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(unique))
+	for k := range unique {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (f *federation) Registries(dc string) ([]string, error) {
+	var res []string
+	return res, f.members.Walk(func(info members.PeerInfo) error {
+		if info.Datacenter == dc {
+			res = append(res, net.JoinHostPort(info.APIAddr, strconv.Itoa(info.APIPort)))
+		}
+		return nil
+	})
+}
+
+func (f *federation) Current(peerType members.PeerType) (map[members.PeerType][]string, error) {
+	// The WAN pool only holds the registries, so the services of each remote
+	// datacenter have to be asked for.
+	registries := make(map[string][]string)
+	if err := f.members.Walk(func(info members.PeerInfo) error {
+		if dc := info.Datacenter; dc != "" && dc != f.datacenter {
+			registries[dc] = append(registries[dc], net.JoinHostPort(info.APIAddr, strconv.Itoa(info.APIPort)))
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var (
+		mtx    sync.Mutex
+		wg     sync.WaitGroup
+		remote = make(map[string]map[members.PeerType][]string, len(registries))
+	)
+	for dc, addrs := range registries {
+		wg.Add(1)
+		go func(dc string, addrs []string) {
+			defer wg.Done()
+
+			services, err := f.services(dc, addrs, peerType)
+			if err != nil {
+				level.Warn(f.logger).Log("reason", "federation services", "dc", dc, "err", err)
+				return
+			}
+
+			mtx.Lock()
+			defer mtx.Unlock()
+			remote[dc] = services
+		}(dc, addrs)
+	}
+	wg.Wait()
+
+	// Merge the datacenters in order, so the results are stable.
+	dcs := make([]string, 0, len(remote))
+	for dc := range remote {
+		dcs = append(dcs, dc)
+	}
+	sort.Strings(dcs)
+
+	res := make(map[members.PeerType][]string)
+	for _, dc := range dcs {
+		for typ, addrs := range remote[dc] {
+			if peerType == PeerTypeAny || typ == peerType {
+				res[typ] = append(res[typ], addrs...)
+			}
+		}
+	}
+	return res, nil
+}
+
+// services queries the registries of the datacenter for the services of the
+// peer type, trying each registry in a random order until one answers.
+func (f *federation) services(dc string, registries []string, peerType members.PeerType) (map[members.PeerType][]string, error) {
+	values := url.Values{}
+	values.Set("dc", dc)
+	if peerType != PeerTypeAny {
+		values.Set("type", peerType.String())
+	}
+
+	var err error
+	for _, k := range rand.Perm(len(registries)) {
+		var res map[members.PeerType][]string
+		if res, err = f.query(registries[k], values); err == nil {
+			return res, nil
+		}
+	}
+	return nil, err
+}
+
+func (f *federation) query(host string, values url.Values) (map[members.PeerType][]string, error) {
+	u := url.URL{
+		Scheme:   "http",
+		Host:     host,
+		Path:     federationServicesPath,
+		RawQuery: values.Encode(),
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// The datacenter doesn't have any services of the type.
+		return nil, nil
+	default:
+		return nil, errors.Errorf("unexpected status %d from %s", resp.StatusCode, host)
+	}
+
+	var result struct {
+		Services map[members.PeerType][]string `json:"services"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, errors.Wrapf(err, "decoding services from %s", host)
+	}
+	return result.Services, nil
+}
+
+// federatedPeer merges the remote datacenters from the federation into the
+// results of the local peer.
+type federatedPeer struct {
+	Peer
+	federation Federation
+}
+
+// NewFederatedPeer wraps a Peer so that Current also includes the peers that
+// are advertised by other datacenters in the federation.
+func NewFederatedPeer(peer Peer, federation Federation) Peer {
+	return &federatedPeer{
+		Peer:       peer,
+		federation: federation,
+	}
+}
+
+// Current API host:ports for the given type of peer, merged across all the
+// datacenters in the federation.
+func (p *federatedPeer) Current(peerType members.PeerType) (map[members.PeerType][]string, error) {
+	res, err := p.Peer.Current(peerType)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := p.federation.Current(peerType)
+	if err != nil {
+		return nil, err
+	}
+
+	for typ, addrs := range remote {
+		unique := make(map[string]struct{}, len(res[typ]))
+		for _, v := range res[typ] {
+			unique[v] = struct{}{}
+		}
+		for _, v := range addrs {
+			if _, ok := unique[v]; ok {
+				continue
+			}
+			unique[v] = struct{}{}
+			res[typ] = append(res[typ], v)
+		}
+	}
+	return res, nil
+}
+
+// Local returns the peer without the peers of the other datacenters merged in
+// to it, if the peer is federated.
+func Local(peer Peer) Peer {
+	if p, ok := peer.(*federatedPeer); ok {
+		return p.Peer
+	}
+	return peer
+}
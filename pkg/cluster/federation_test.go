@@ -0,0 +1,245 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members/mocks"
+	clusterMocks "github.com/SimonRichardson/alchemy/pkg/cluster/mocks"
+	"github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+)
+
+func TestFederation(t *testing.T) {
+	t.Parallel()
+
+	infos := []members.PeerInfo{
+		{Name: "a", PeerType: "peertype:registry", APIAddr: "10.0.0.1", APIPort: 8080, Datacenter: "us"},
+		{Name: "b", PeerType: "peertype:registry", APIAddr: "10.0.1.1", APIPort: 8080, Datacenter: "eu"},
+		{Name: "c", PeerType: "peertype:registry", APIAddr: "10.0.1.2", APIPort: 8080, Datacenter: "eu"},
+	}
+
+	t.Run("datacenters", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mbrs := mocks.NewMockMembers(ctrl)
+		mbrs.EXPECT().
+			Walk(PeerInfos(infos)).
+			Return(nil)
+
+		f := NewFederation(mbrs, "ap", log.NewNopLogger())
+		got, err := f.Datacenters()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := []string{"ap", "eu", "us"}, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("registries", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mbrs := mocks.NewMockMembers(ctrl)
+		mbrs.EXPECT().
+			Walk(PeerInfos(infos)).
+			Return(nil)
+
+		f := NewFederation(mbrs, "us", log.NewNopLogger())
+		got, err := f.Registries("eu")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := []string{"10.0.1.1:8080", "10.0.1.2:8080"}, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("current queries remote datacenters", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var query url.Values
+		remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if expected, actual := "/registry/services", r.URL.Path; expected != actual {
+				t.Errorf("expected: %q, actual: %q", expected, actual)
+			}
+			query = r.URL.Query()
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"services": map[string][]string{
+					"peertype:store": []string{"10.0.1.5:8080", "10.0.1.6:8080"},
+				},
+			})
+		}))
+		defer remote.Close()
+
+		mbrs := mocks.NewMockMembers(ctrl)
+		mbrs.EXPECT().
+			Walk(PeerInfos(append(infos[:1:1], serverPeerInfo(t, "d", remote, "eu")))).
+			Return(nil)
+
+		f := NewFederation(mbrs, "us", log.NewNopLogger())
+		got, err := f.Current(members.PeerType("peertype:store"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[members.PeerType][]string{
+			"peertype:store": []string{"10.0.1.5:8080", "10.0.1.6:8080"},
+		}
+		if expected, actual := want, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "peertype:store", query.Get("type"); expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+		if expected, actual := "eu", query.Get("dc"); expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("current skips unreachable datacenters", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			missing = httptest.NewServer(http.NotFoundHandler())
+			broken  = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+		)
+		defer missing.Close()
+		defer broken.Close()
+
+		mbrs := mocks.NewMockMembers(ctrl)
+		mbrs.EXPECT().
+			Walk(PeerInfos([]members.PeerInfo{
+				serverPeerInfo(t, "a", missing, "eu"),
+				serverPeerInfo(t, "b", broken, "ap"),
+			})).
+			Return(nil)
+
+		f := NewFederation(mbrs, "us", log.NewNopLogger())
+		got, err := f.Current(members.PeerType("peertype:store"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := 0, len(got); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+}
+
+func TestFederatedPeer(t *testing.T) {
+	t.Parallel()
+
+	t.Run("current merges", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			peer       = clusterMocks.NewMockPeer(ctrl)
+			federation = clusterMocks.NewMockFederation(ctrl)
+		)
+
+		peer.EXPECT().
+			Current(PeerTypeAny).
+			Return(map[members.PeerType][]string{
+				"peertype:registry": []string{"10.0.0.1:8080"},
+			}, nil)
+		federation.EXPECT().
+			Current(PeerTypeAny).
+			Return(map[members.PeerType][]string{
+				"peertype:registry": []string{"10.0.0.1:8080", "10.0.1.1:8080"},
+			}, nil)
+
+		got, err := NewFederatedPeer(peer, federation).Current(PeerTypeAny)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[members.PeerType][]string{
+			"peertype:registry": []string{"10.0.0.1:8080", "10.0.1.1:8080"},
+		}
+		if expected, actual := want, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestLocal(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var (
+		peer       = clusterMocks.NewMockPeer(ctrl)
+		federation = clusterMocks.NewMockFederation(ctrl)
+	)
+
+	if expected, actual := Peer(peer), Local(NewFederatedPeer(peer, federation)); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+	if expected, actual := Peer(peer), Local(peer); expected != actual {
+		t.Errorf("expected: %v, actual: %v", expected, actual)
+	}
+}
+
+type peerInfoMatcher struct {
+	infos []members.PeerInfo
+}
+
+func (m peerInfoMatcher) Matches(x interface{}) bool {
+	if fn, ok := x.(func(members.PeerInfo) error); ok {
+		for _, v := range m.infos {
+			if err := fn(v); err != nil {
+				panic(err)
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (peerInfoMatcher) String() string {
+	return "is func"
+}
+
+func PeerInfos(infos []members.PeerInfo) gomock.Matcher { return peerInfoMatcher{infos} }
+
+// serverPeerInfo creates the PeerInfo of a registry, which is served by the
+// test server.
+func serverPeerInfo(t *testing.T, name string, server *httptest.Server, dc string) members.PeerInfo {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return members.PeerInfo{
+		Name:       name,
+		PeerType:   "peertype:registry",
+		APIAddr:    host,
+		APIPort:    p,
+		Datacenter: dc,
+	}
+}
@@ -0,0 +1,148 @@
+package hashring
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// NewBoundedLoad creates a new HashRing that implements consistent hashing
+// with bounded loads. Callers report the load of each host using SetLoad and
+// a lookup skips any host that has a load above (1+epsilon) times the average
+// load of all the hosts. The average is per unit of weight, so a host with
+// twice the weight can take twice the load.
+func NewBoundedLoad(hashFn func([]byte) uint64, vnodes int, epsilon float64) *HashRing {
+	ring := New(hashFn, vnodes)
+	ring.bounded = true
+	ring.epsilon = epsilon
+	ring.publish(false)
+	return ring
+}
+
+// SetLoad sets the current load of a host, the load is only used when the
+// HashRing bounds the load. Loads change far more often than the hosts, so
+// the load is set in place rather than publishing a new Snapshot, which means
+// that the latest Snapshot sees the load straight away.
+// Returns false if the host isn't in the ring.
+func (r *HashRing) SetLoad(host string, value float64) bool {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	h, ok := r.hosts[host]
+	if !ok {
+		return false
+	}
+
+	r.totalLoad.add(value - h.load.swap(value))
+
+	return true
+}
+
+// Load returns the current load of a host.
+func (r *HashRing) Load(host string) float64 {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if h, ok := r.hosts[host]; ok {
+		return h.load.value()
+	}
+	return 0
+}
+
+// MaxLoad returns the load a host with a weight of one can have before it's
+// skipped by a lookup, a host with a larger weight can have proportionally
+// more load. Hosts at the max load are still returned.
+func (r *HashRing) MaxLoad() float64 {
+	return r.Snapshot().MaxLoad()
+}
+
+// MaxLoad returns the load a host with a weight of one can have before it's
+// skipped by a lookup, see HashRing.MaxLoad.
+func (s *Snapshot) MaxLoad() float64 {
+	if s.totalWeight == 0 {
+		return 0
+	}
+	return (1 + s.epsilon) * (s.totalLoad.value() / float64(s.totalWeight))
+}
+
+// lookupNBounded walks the ring from the key, skipping the hosts that are
+// over the max load for their weight. The walk stops as soon as N hosts are
+// found, so a lookup only visits the hosts it has to. As there's always a
+// host at or below the average load, at least one host is always found. If
+// there are less than N hosts below the max load, the overloaded hosts are
+// appended in ring order so that callers still get N hosts when they exist.
+func (s *Snapshot) lookupNBounded(key string, n int) []string {
+	var (
+		max  = s.MaxLoad()
+		seen = make(map[string]struct{}, n)
+
+		res  = make([]string, 0, n)
+		over []string
+	)
+	s.walkFrom(s.hashFn(key), func(h *host) bool {
+		if _, ok := seen[h.name]; ok {
+			return true
+		}
+		seen[h.name] = struct{}{}
+
+		if h.load.value() > max*float64(h.weight) {
+			over = append(over, h.name)
+		} else {
+			res = append(res, h.name)
+		}
+		return len(res) < n && len(seen) < len(s.hosts)
+	})
+	for _, host := range over {
+		if len(res) >= n {
+			break
+		}
+		res = append(res, host)
+	}
+	return res
+}
+
+// walkFrom walks the points of the ring from the hash in ring order, wrapping
+// around the end of the ring, until fn returns false or every point has been
+// walked.
+func (s *Snapshot) walkFrom(hash uint64, fn func(*host) bool) {
+	it := s.tree.IteratorAt(hash)
+	for it.Next() {
+		if !fn(it.Value()) {
+			return
+		}
+	}
+	for it = s.tree.Iterator(); it.Next() && it.Key() < hash; {
+		if !fn(it.Value()) {
+			return
+		}
+	}
+}
+
+// load is the load of a host, or the total load of all the hosts, that can be
+// read and changed without holding the lock of the HashRing.
+type load struct {
+	bits atomic.Uint64
+}
+
+func newLoad(value float64) *load {
+	l := new(load)
+	l.bits.Store(math.Float64bits(value))
+	return l
+}
+
+func (l *load) value() float64 {
+	return math.Float64frombits(l.bits.Load())
+}
+
+// swap the load for the value, returning the previous load.
+func (l *load) swap(value float64) float64 {
+	return math.Float64frombits(l.bits.Swap(math.Float64bits(value)))
+}
+
+func (l *load) add(delta float64) {
+	for {
+		old := l.bits.Load()
+		if l.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
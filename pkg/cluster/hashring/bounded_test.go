@@ -0,0 +1,162 @@
+package hashring
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/quick"
+
+	"github.com/spaolacci/murmur3"
+)
+
+func TestHashRingBoundedLoad(t *testing.T) {
+	t.Parallel()
+
+	t.Run("without load", func(t *testing.T) {
+		fn := func(a []ASCII, key ASCII) bool {
+			var (
+				ring    = New(murmur3.Sum64, 10)
+				bounded = NewBoundedLoad(murmur3.Sum64, 10, 0.25)
+			)
+			for _, v := range a {
+				ring.Add(v.String())
+				bounded.Add(v.String())
+			}
+
+			return reflect.DeepEqual(ring.LookupN(key.String(), 3), bounded.LookupN(key.String(), 3))
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("skips overloaded host", func(t *testing.T) {
+		fn := func(a, b, key ASCII) bool {
+			if a == b {
+				return true
+			}
+
+			ring := NewBoundedLoad(murmur3.Sum64, 10, 0.25)
+			ring.Add(a.String())
+			ring.Add(b.String())
+
+			owner, _ := ring.Lookup(key.String())
+			ring.SetLoad(owner, 100)
+
+			got, _ := ring.Lookup(key.String())
+			if got == owner {
+				return false
+			}
+
+			// The overloaded host should still be returned as a fallback.
+			return reflect.DeepEqual([]string{got, owner}, ring.LookupN(key.String(), 2))
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("set load of missing host", func(t *testing.T) {
+		ring := NewBoundedLoad(murmur3.Sum64, 10, 0.25)
+
+		if expected, actual := false, ring.SetLoad("a", 1); expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+	})
+
+	t.Run("remove clears load", func(t *testing.T) {
+		ring := NewBoundedLoad(murmur3.Sum64, 10, 0)
+		ring.Add("a")
+		ring.Add("b")
+		ring.SetLoad("a", 10)
+		ring.SetLoad("b", 2)
+		ring.Remove("a")
+
+		if expected, actual := 2.0, ring.MaxLoad(); expected != actual {
+			t.Errorf("expected: %f, actual: %f", expected, actual)
+		}
+	})
+
+	t.Run("concurrent loads", func(t *testing.T) {
+		var (
+			ring = NewBoundedLoad(murmur3.Sum64, 10, 0)
+			wg   sync.WaitGroup
+		)
+		hosts := []string{"a", "b", "c", "d"}
+		for _, v := range hosts {
+			ring.Add(v)
+		}
+
+		for _, v := range hosts {
+			wg.Add(1)
+			go func(host string) {
+				defer wg.Done()
+				for i := 1; i <= 100; i++ {
+					ring.SetLoad(host, float64(i))
+					ring.LookupN(fmt.Sprintf("key-%d", i), 2)
+				}
+			}(v)
+		}
+		wg.Wait()
+
+		if expected, actual := 100.0, ring.MaxLoad(); expected != actual {
+			t.Errorf("expected: %f, actual: %f", expected, actual)
+		}
+	})
+
+	t.Run("bound scales with weight", func(t *testing.T) {
+		const keys = 4000
+
+		ring := NewBoundedLoad(murmur3.Sum64, 10, 0)
+		ring.AddWeighted("a", 1)
+		ring.AddWeighted("b", 3)
+
+		for i := 0; i < keys; i++ {
+			host, ok := ring.Lookup(fmt.Sprintf("key-%d", i))
+			if !ok {
+				t.Fatal("expected a host")
+			}
+			ring.SetLoad(host, ring.Load(host)+1)
+		}
+
+		// Each host can go over the bound for its weight by a single key.
+		for host, weight := range map[string]float64{"a": 1, "b": 3} {
+			max := keys/4*weight + 1
+			if load := ring.Load(host); load > max {
+				t.Errorf("expected: load <= %f, actual: %s has %f", max, host, load)
+			}
+		}
+	})
+
+	for _, epsilon := range []float64{0, 0.25, 1} {
+		t.Run(fmt.Sprintf("bound with epsilon %.2f", epsilon), func(t *testing.T) {
+			const (
+				hosts = 10
+				keys  = 10000
+			)
+
+			ring := NewBoundedLoad(murmur3.Sum64, 10, epsilon)
+			for i := 0; i < hosts; i++ {
+				ring.Add(fmt.Sprintf("host-%d", i))
+			}
+
+			for i := 0; i < keys; i++ {
+				host, ok := ring.Lookup(fmt.Sprintf("key-%d", i))
+				if !ok {
+					t.Fatal("expected a host")
+				}
+				ring.SetLoad(host, ring.Load(host)+1)
+			}
+
+			// A host can only be assigned a key whilst it's at or below the
+			// max load, so it can only ever go over it by a single key.
+			max := (1+epsilon)*(keys/hosts) + 1
+			for _, host := range ring.Hosts() {
+				if load := ring.Load(host); load > max {
+					t.Errorf("expected: load <= %f, actual: %s has %f", max, host, load)
+				}
+			}
+		})
+	}
+}
@@ -1,5 +1,10 @@
 package hashring
 
+import (
+	"fmt"
+	"strings"
+)
+
 // Checksum computes a checksum for an instance of a HashRing. The
 // checksum can be used to compare two rings for equality.
 type Checksum interface {
@@ -7,3 +12,31 @@ type Checksum interface {
 	// Checksum calculates the checksum for the hashring that is passed in.
 	Checksum(*HashRing) uint32
 }
+
+type pointsChecksum struct{}
+
+// NewPointsChecksum creates a Checksum from the hashes and the hosts of a
+// HashRing in the order of the hashes. Unlike the shape of the underlying
+// tree, the order of the hashes is the same on every node that knows of the
+// same hosts, so the checksum can be compared across the cluster.
+func NewPointsChecksum() Checksum {
+	return pointsChecksum{}
+}
+
+func (pointsChecksum) Checksum(r *HashRing) uint32 {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.checksum()
+}
+
+// checksum the hashes and the hosts of the HashRing, the caller is expected
+// to hold the lock.
+func (r *HashRing) checksum() uint32 {
+	nodes := r.sortedNodes()
+	values := make([]string, len(nodes))
+	for k, v := range nodes {
+		values[k] = fmt.Sprintf("%016x:%s", v.key, v.value.name)
+	}
+	return fold(r.hashFn(strings.Join(values, ";")))
+}
@@ -0,0 +1,123 @@
+package hashring
+
+import (
+	"fmt"
+	"sort"
+)
+
+// maxSalt is the number of times a replicated point is rehashed before giving
+// up on placing it.
+const maxSalt = 64
+
+// vnode is a replicated point of a host. The salt records how many times the
+// point had to be rehashed, because the hash collided with another point.
+type vnode struct {
+	hash uint64
+	salt int
+}
+
+func vnodeKey(host string, index, salt int) string {
+	if salt == 0 {
+		return fmt.Sprintf("%s%d", host, index)
+	}
+	return fmt.Sprintf("%s%d#%d", host, index, salt)
+}
+
+// place the replicated point of a host at the index on to the tree.
+// When the hash collides with a point of another host, the host that sorts
+// first keeps the hash and the other host rehashes it's point with a salt.
+// This means the hashring ends up the same regardless of the order that the
+// hosts were added in.
+// Returns false if the point couldn't be placed.
+func (r *HashRing) place(h *host, index int) bool {
+	for salt := 0; salt < maxSalt; salt++ {
+		hash := r.hashFn(vnodeKey(h.name, index, salt))
+
+		owner, ok := r.tree.Search(hash)
+		if !ok {
+			r.tree.Insert(hash, h)
+			h.points[index] = vnode{hash, salt}
+			return true
+		}
+		if owner == h || owner.name < h.name {
+			continue
+		}
+
+		// The host takes over the hash, so the point of the owner has to be
+		// placed again.
+		displaced := owner.pointIndex(hash)
+		r.tree.Delete(hash)
+		r.tree.Insert(hash, h)
+		h.points[index] = vnode{hash, salt}
+
+		h, index, salt = owner, displaced, -1
+	}
+	h.points[index] = vnode{salt: maxSalt}
+	return false
+}
+
+// unplace removes the replicated point of a host at the index from the tree,
+// but only if the point still belongs to the host.
+func (r *HashRing) unplace(h *host, index int) bool {
+	point := h.points[index]
+	if point.salt >= maxSalt {
+		return false
+	}
+	if owner, ok := r.tree.Search(point.hash); !ok || owner != h {
+		return false
+	}
+	return r.tree.Delete(point.hash)
+}
+
+// pointIndex returns the index of the replicated point of the host that has
+// the hash.
+func (h *host) pointIndex(hash uint64) int {
+	for k, v := range h.points {
+		if v.hash == hash {
+			return k
+		}
+	}
+	return -1
+}
+
+// resettle places any of the salted points again, as the hashes they collided
+// with might have been removed.
+func (r *HashRing) resettle() {
+	hosts := make([]string, 0, len(r.hosts))
+	for k := range r.hosts {
+		hosts = append(hosts, k)
+	}
+	sort.Strings(hosts)
+
+	for _, name := range hosts {
+		h := r.hosts[name]
+		for index, point := range h.points {
+			if point.salt == 0 {
+				continue
+			}
+			r.unplace(h, index)
+			r.place(h, index)
+		}
+	}
+}
+
+// Collisions returns the number of replicated points that collided with
+// another point and had to be rehashed.
+func (r *HashRing) Collisions() int {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.collisions()
+}
+
+func (r *HashRing) collisions() int {
+	var res int
+	for _, h := range r.hosts {
+		for _, v := range h.points {
+			if v.salt > 0 {
+				res++
+			}
+		}
+	}
+	return res
+}
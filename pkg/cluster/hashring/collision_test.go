@@ -0,0 +1,109 @@
+package hashring
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/spaolacci/murmur3"
+)
+
+// smallHash squashes the hashes in to a small keyspace, so that the points of
+// the hosts collide often.
+func smallHash(b []byte) uint64 {
+	return murmur3.Sum64(b) % 1024
+}
+
+func TestHashRingCollisions(t *testing.T) {
+	t.Parallel()
+
+	hosts := make([]string, 20)
+	for k := range hosts {
+		hosts[k] = fmt.Sprintf("host-%d", k)
+	}
+
+	t.Run("add keeps all points", func(t *testing.T) {
+		ring := New(smallHash, 10)
+		for _, v := range hosts {
+			if expected, actual := true, ring.Add(v); expected != actual {
+				t.Errorf("expected: %t, actual: %t", expected, actual)
+			}
+		}
+
+		if expected, actual := len(hosts)*10, ring.tree.Size(); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := true, ring.Collisions() > 0; expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+	})
+
+	t.Run("order independent", func(t *testing.T) {
+		a := New(smallHash, 10)
+		for _, v := range hosts {
+			a.Add(v)
+		}
+
+		b := New(smallHash, 10)
+		for _, k := range rand.Perm(len(hosts)) {
+			b.Add(hosts[k])
+		}
+
+		if expected, actual := a.hashes(), b.hashes(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := a.LookupN("key", 3), b.LookupN("key", 3); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("remove only deletes own points", func(t *testing.T) {
+		ring := New(smallHash, 10)
+		for _, v := range hosts {
+			ring.Add(v)
+		}
+		for _, v := range hosts[1:] {
+			if expected, actual := true, ring.Remove(v); expected != actual {
+				t.Errorf("expected: %t, actual: %t", expected, actual)
+			}
+		}
+
+		want := New(smallHash, 10)
+		want.Add(hosts[0])
+
+		if expected, actual := want.hashes(), ring.hashes(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 0, ring.Collisions(); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		ring := New(smallHash, 10)
+		for _, v := range hosts {
+			ring.Add(v)
+		}
+		ring.Update(hosts[0], 3)
+		ring.Update(hosts[0], 1)
+
+		want := New(smallHash, 10)
+		for _, v := range hosts {
+			want.Add(v)
+		}
+
+		if expected, actual := want.hashes(), ring.hashes(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+// hashes returns the hashes of all the points in the order of the ring.
+func (r *HashRing) hashes() []uint64 {
+	var res []uint64
+	for _, v := range r.sortedNodes() {
+		res = append(res, v.key)
+	}
+	return res
+}
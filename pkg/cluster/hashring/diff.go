@@ -0,0 +1,141 @@
+package hashring
+
+import (
+	"math"
+	"reflect"
+	"sort"
+)
+
+// Range is a range of hashes on the ring, both the start and the end of the
+// range are inclusive.
+type Range struct {
+	Start, End uint64
+}
+
+// RangeChange describes a range of hashes that moved from one set of hosts to
+// another set of hosts.
+type RangeChange struct {
+	Range
+	From, To []string
+}
+
+// Diff returns the ranges of hashes where the owner of the range is
+// different between the old and the new HashRing.
+func Diff(old, new *HashRing) []RangeChange {
+	return DiffN(old, new, 1)
+}
+
+// DiffN returns the ranges of hashes where the N hosts that own the range
+// are different between the old and the new HashRing. The order of the hosts
+// matters, as the first host is the owner of the range. Adjacent ranges that
+// moved between the same hosts are merged together.
+func DiffN(old, new *HashRing, n int) []RangeChange {
+	var (
+		oldPoints = old.points()
+		newPoints = new.points()
+		unique    = make(map[uint64]struct{}, len(oldPoints)+len(newPoints))
+		points    = make([]uint64, 0, len(oldPoints)+len(newPoints))
+	)
+	for _, v := range append(oldPoints, newPoints...) {
+		if _, ok := unique[v]; ok {
+			continue
+		}
+		unique[v] = struct{}{}
+		points = append(points, v)
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i] < points[j]
+	})
+
+	// Each range ends at a point, apart from the range after the last point,
+	// which is owned by the owners of the first point on the ring.
+	ends := points
+	if len(points) > 0 && points[len(points)-1] < math.MaxUint64 {
+		ends = append(ends, math.MaxUint64)
+	}
+
+	var (
+		oldOwners = old.ownersAt(ends, n)
+		newOwners = new.ownersAt(ends, n)
+		res       []RangeChange
+		start     uint64
+	)
+	for k, end := range ends {
+		from, to := oldOwners[k], newOwners[k]
+		if !reflect.DeepEqual(from, to) {
+			if last := len(res) - 1; last >= 0 &&
+				res[last].End+1 == start &&
+				reflect.DeepEqual(res[last].From, from) &&
+				reflect.DeepEqual(res[last].To, to) {
+				res[last].End = end
+			} else {
+				res = append(res, RangeChange{
+					Range: Range{
+						Start: start,
+						End:   end,
+					},
+					From: from,
+					To:   to,
+				})
+			}
+		}
+		start = end + 1
+	}
+	return res
+}
+
+// points returns the hashes of all the nodes in the ring.
+func (r *HashRing) points() []uint64 {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	res := make([]uint64, 0, r.tree.Size())
+	r.tree.Walk(func(n *Node[uint64, *host]) error {
+		res = append(res, n.key)
+		return nil
+	})
+	return res
+}
+
+// ownersAt returns the N hosts that own each of the hashes.
+func (r *HashRing) ownersAt(hashes []uint64, n int) [][]string {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	res := make([][]string, len(hashes))
+	for k, v := range hashes {
+		res[k] = names(r.tree.LookupNUniqueAt(n, v))
+	}
+	return res
+}
+
+// Clone returns a copy of the HashRing, which can be used to diff the
+// HashRing before and after a change.
+func (r *HashRing) Clone() *HashRing {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	clone := &HashRing{
+		hashName:  r.hashName,
+		hashFn:    r.hashFn,
+		vnodes:    r.vnodes,
+		hosts:     make(map[string]*host, len(r.hosts)),
+		tree:      r.tree.clone(),
+		bounded:   r.bounded,
+		epsilon:   r.epsilon,
+		totalLoad: newLoad(r.totalLoad.value()),
+	}
+	// The clone places the points of its own hosts and has its own loads, so
+	// the hosts are copied and the points of the tree moved over to them.
+	for k, v := range r.hosts {
+		clone.hosts[k] = v.with(func(h *host) {
+			h.load = newLoad(v.load.value())
+			h.points = append([]vnode(nil), v.points...)
+		})
+	}
+	clone.tree.walkInOrder(func(n *Node[uint64, *host]) {
+		n.value = clone.hosts[n.value.name]
+	})
+	clone.publish(false)
+	return clone
+}
@@ -0,0 +1,105 @@
+package hashring
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/spaolacci/murmur3"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	t.Run("same", func(t *testing.T) {
+		fn := func(a ASCIISlice) bool {
+			ring := New(murmur3.Sum64, 10)
+			for _, v := range a.Slice() {
+				ring.Add(v)
+			}
+
+			return len(Diff(ring, ring.Clone())) == 0
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if expected, actual := 0, len(Diff(New(murmur3.Sum64, 10), New(murmur3.Sum64, 10))); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("add", func(t *testing.T) {
+		old := New(murmur3.Sum64, 10)
+		for i := 0; i < 5; i++ {
+			old.Add(fmt.Sprintf("host-%d", i))
+		}
+		new := old.Clone()
+		new.Add("host-5")
+
+		changes := Diff(old, new)
+		if len(changes) == 0 {
+			t.Fatal("expected changes")
+		}
+		for _, v := range changes {
+			if expected, actual := []string{"host-5"}, v.To; !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("clone is independent", func(t *testing.T) {
+		ring := New(murmur3.Sum64, 10)
+		ring.Add("a")
+		clone := ring.Clone()
+		clone.Add("b")
+
+		if expected, actual := 1, ring.Len(); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	for _, n := range []int{1, 2} {
+		t.Run(fmt.Sprintf("keys moved with %d replicas", n), func(t *testing.T) {
+			fn := func(a ASCIISlice, keys ASCIISlice) bool {
+				hosts := a.Slice()
+				if len(hosts) < 2 {
+					return true
+				}
+
+				old := New(murmur3.Sum64, 10)
+				for _, v := range hosts {
+					old.Add(v)
+				}
+				new := old.Clone()
+				new.Remove(hosts[0])
+
+				changes := DiffN(old, new, n)
+				for _, key := range keys.Slice() {
+					var (
+						from  = old.LookupN(key, n)
+						to    = new.LookupN(key, n)
+						hash  = old.hashFn(key)
+						found bool
+					)
+					for _, v := range changes {
+						if hash >= v.Start && hash <= v.End {
+							found = reflect.DeepEqual(from, v.From) && reflect.DeepEqual(to, v.To)
+							break
+						}
+					}
+					if moved := !reflect.DeepEqual(from, to); moved != found {
+						return false
+					}
+				}
+				return true
+			}
+			if err := quick.Check(fn, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,484 @@
+package hashring
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// encodingVersion is the version of the encoding format, which allows the
+// format to change without decoding garbage.
+const encodingVersion = 1
+
+// ringState is the state of a HashRing that is encoded. The loads of a
+// bounded HashRing aren't encoded, as they're only relevant to the node that
+// reported them.
+type ringState struct {
+	Version  int         `json:"version"`
+	Hash     string      `json:"hash"`
+	VNodes   int         `json:"vnodes"`
+	Bounded  bool        `json:"bounded,omitempty"`
+	Epsilon  float64     `json:"epsilon,omitempty"`
+	Hosts    []hostState `json:"hosts"`
+	Checksum uint32      `json:"checksum"`
+}
+
+type hostState struct {
+	Name   string            `json:"name"`
+	Weight int               `json:"weight"`
+	Points []pointState      `json:"points"`
+	Tags   map[string]string `json:"tags,omitempty"`
+}
+
+// pointState is a replicated point of a host. The hash is encoded as a string
+// in JSON, as not every client can represent a 64-bit integer.
+type pointState struct {
+	Hash uint64 `json:"hash,string"`
+	Salt int    `json:"salt,omitempty"`
+}
+
+// MarshalBinary encodes the hosts, weights and replicated points of the
+// HashRing, along with the name of the hash and the checksum of the HashRing.
+func (r *HashRing) MarshalBinary() ([]byte, error) {
+	s := r.state()
+
+	var e encoder
+	e.uvarint(uint64(s.Version))
+	e.string(s.Hash)
+	e.uvarint(uint64(s.VNodes))
+	e.bool(s.Bounded)
+	e.uint64(math.Float64bits(s.Epsilon))
+	e.uvarint(uint64(len(s.Hosts)))
+	for _, host := range s.Hosts {
+		e.string(host.Name)
+		e.uvarint(uint64(host.Weight))
+		e.uvarint(uint64(len(host.Points)))
+		for _, point := range host.Points {
+			e.uint64(point.Hash)
+			e.uvarint(uint64(point.Salt))
+		}
+		e.tags(host.Tags)
+	}
+	e.uvarint(uint64(s.Checksum))
+
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a HashRing encoded by MarshalBinary, replacing the
+// contents of the HashRing. An error is returned if the checksum of the
+// decoded HashRing doesn't match the encoded checksum.
+func (r *HashRing) UnmarshalBinary(data []byte) error {
+	var (
+		s ringState
+		d = decoder{r: bytes.NewReader(data)}
+	)
+	s.Version = int(d.uvarint())
+	if d.err == nil && s.Version != encodingVersion {
+		return errors.Errorf("unexpected encoding version %d", s.Version)
+	}
+	s.Hash = d.string()
+	s.VNodes = int(d.uvarint())
+	s.Bounded = d.bool()
+	s.Epsilon = math.Float64frombits(d.uint64())
+
+	num := d.length()
+	for i := 0; i < num && d.err == nil; i++ {
+		host := hostState{
+			Name:   d.string(),
+			Weight: int(d.uvarint()),
+		}
+		points := d.length()
+		for j := 0; j < points && d.err == nil; j++ {
+			host.Points = append(host.Points, pointState{
+				Hash: d.uint64(),
+				Salt: int(d.uvarint()),
+			})
+		}
+		host.Tags = d.tags()
+		s.Hosts = append(s.Hosts, host)
+	}
+	s.Checksum = uint32(d.uvarint())
+
+	if d.err != nil {
+		return errors.Wrap(d.err, "decoding hashring")
+	}
+	return r.restore(s)
+}
+
+// MarshalJSON encodes the HashRing as JSON, see MarshalBinary.
+func (r *HashRing) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.state())
+}
+
+// UnmarshalJSON decodes a HashRing encoded by MarshalJSON, see
+// UnmarshalBinary.
+func (r *HashRing) UnmarshalJSON(data []byte) error {
+	var s ringState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.Wrap(err, "decoding hashring")
+	}
+	if s.Version != encodingVersion {
+		return errors.Errorf("unexpected encoding version %d", s.Version)
+	}
+	return r.restore(s)
+}
+
+// state returns the state of the HashRing, with the hosts sorted so that the
+// same HashRing always encodes the same way.
+func (r *HashRing) state() ringState {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	s := ringState{
+		Version:  encodingVersion,
+		Hash:     r.hashName,
+		VNodes:   r.vnodes,
+		Bounded:  r.bounded,
+		Epsilon:  r.epsilon,
+		Hosts:    make([]hostState, 0, len(r.hosts)),
+		Checksum: r.checksum(),
+	}
+	for _, h := range r.hosts {
+		host := hostState{
+			Name:   h.name,
+			Weight: h.weight,
+			Points: make([]pointState, len(h.points)),
+			Tags:   h.tags,
+		}
+		for k, v := range h.points {
+			host.Points[k] = pointState{
+				Hash: v.hash,
+				Salt: v.salt,
+			}
+		}
+		s.Hosts = append(s.Hosts, host)
+	}
+	sort.Slice(s.Hosts, func(i, j int) bool {
+		return s.Hosts[i].Name < s.Hosts[j].Name
+	})
+	return s
+}
+
+// restore the HashRing from the state. The points are placed exactly as they
+// were encoded, so the HashRing is a copy of the encoded HashRing, even if
+// the collisions were resolved differently. If the state doesn't name the
+// hash, the hash of the HashRing is used instead.
+func (r *HashRing) restore(s ringState) error {
+	ring := &HashRing{
+		hashName:  s.Hash,
+		vnodes:    s.VNodes,
+		hosts:     make(map[string]*host, len(s.Hosts)),
+		tree:      newHostTree(),
+		bounded:   s.Bounded,
+		epsilon:   s.Epsilon,
+		totalLoad: new(load),
+	}
+
+	switch {
+	case s.Hash != "":
+		hashFn, err := NewHash(s.Hash)
+		if err != nil {
+			return err
+		}
+		ring.hashFn = func(s string) uint64 {
+			return hashFn([]byte(s))
+		}
+	case r.hashFn != nil:
+		ring.hashName, ring.hashFn = r.hashName, r.hashFn
+	default:
+		return errors.Errorf("missing hash")
+	}
+
+	for _, state := range s.Hosts {
+		if _, ok := ring.hosts[state.Name]; ok {
+			return errors.Errorf("duplicate host %q", state.Name)
+		}
+		if want := s.VNodes * state.Weight; state.Weight < 1 || len(state.Points) != want {
+			return errors.Errorf("host %q has %d points, expected %d", state.Name, len(state.Points), want)
+		}
+
+		h := &host{
+			name:   state.Name,
+			weight: state.Weight,
+			tags:   state.Tags,
+			load:   new(load),
+			points: make([]vnode, len(state.Points)),
+		}
+		ring.hosts[state.Name] = h
+
+		for k, v := range state.Points {
+			h.points[k] = vnode{v.Hash, v.Salt}
+			if v.Salt >= maxSalt {
+				continue
+			}
+			if !ring.tree.Insert(v.Hash, h) {
+				return errors.Errorf("duplicate point %016x", v.Hash)
+			}
+		}
+	}
+
+	if checksum := ring.checksum(); checksum != s.Checksum {
+		return errors.Errorf("checksum mismatch, expected %08x, actual %08x", s.Checksum, checksum)
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.hashName, r.hashFn = ring.hashName, ring.hashFn
+	r.vnodes = ring.vnodes
+	r.hosts = ring.hosts
+	r.tree = ring.tree
+	r.bounded, r.epsilon = ring.bounded, ring.epsilon
+	r.totalLoad = ring.totalLoad
+	r.publish(true)
+
+	return nil
+}
+
+// MarshalBinary encodes the keys and values of the Tree in order. Keys and
+// values are encoded if they're uint64s, strings or implement
+// encoding.BinaryMarshaler.
+func (t *Tree[K, V]) MarshalBinary() ([]byte, error) {
+	var (
+		e   encoder
+		err error
+	)
+	e.uvarint(uint64(t.Size()))
+	t.walkInOrder(func(n *Node[K, V]) {
+		if err == nil {
+			err = e.value(n.key)
+		}
+		if err == nil {
+			err = e.value(n.value)
+		}
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding tree")
+	}
+	return e.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a Tree encoded by MarshalBinary, replacing the
+// contents of the Tree. The comparator and identity of the Tree are kept.
+func (t *Tree[K, V]) UnmarshalBinary(data []byte) error {
+	var (
+		tree = &Tree[K, V]{compare: t.compare, identity: t.identity}
+		d    = decoder{r: bytes.NewReader(data)}
+		num  = d.length()
+	)
+	for i := 0; i < num && d.err == nil; i++ {
+		var (
+			key   K
+			value V
+		)
+		d.value(&key)
+		d.value(&value)
+		if d.err == nil && !tree.Insert(key, value) {
+			return errors.Errorf("duplicate key %v", key)
+		}
+	}
+	if d.err != nil {
+		return errors.Wrap(d.err, "decoding tree")
+	}
+
+	*t = *tree
+	return nil
+}
+
+type nodeState[K any, V any] struct {
+	Key   K `json:"key,string"`
+	Value V `json:"value"`
+}
+
+// MarshalJSON encodes the keys and values of the Tree in order.
+func (t *Tree[K, V]) MarshalJSON() ([]byte, error) {
+	nodes := make([]nodeState[K, V], 0, t.Size())
+	t.walkInOrder(func(n *Node[K, V]) {
+		nodes = append(nodes, nodeState[K, V]{n.key, n.value})
+	})
+	return json.Marshal(nodes)
+}
+
+// UnmarshalJSON decodes a Tree encoded by MarshalJSON, replacing the
+// contents of the Tree. The comparator and identity of the Tree are kept.
+func (t *Tree[K, V]) UnmarshalJSON(data []byte) error {
+	var nodes []nodeState[K, V]
+	if err := json.Unmarshal(data, &nodes); err != nil {
+		return errors.Wrap(err, "decoding tree")
+	}
+
+	tree := &Tree[K, V]{compare: t.compare, identity: t.identity}
+	for _, v := range nodes {
+		if !tree.Insert(v.Key, v.Value) {
+			return errors.Errorf("duplicate key %v", v.Key)
+		}
+	}
+
+	*t = *tree
+	return nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (e *encoder) uint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *encoder) string(v string) {
+	e.uvarint(uint64(len(v)))
+	e.buf.WriteString(v)
+}
+
+// value encodes uint64s and strings directly, anything else has to implement
+// encoding.BinaryMarshaler.
+func (e *encoder) value(v any) error {
+	switch x := v.(type) {
+	case uint64:
+		e.uint64(x)
+	case string:
+		e.string(x)
+	case encoding.BinaryMarshaler:
+		b, err := x.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		e.string(string(b))
+	default:
+		return errors.Errorf("unable to encode %T", v)
+	}
+	return nil
+}
+
+// tags are encoded with the keys sorted, so that the same tags always encode
+// the same way.
+func (e *encoder) tags(tags map[string]string) {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	e.uvarint(uint64(len(keys)))
+	for _, k := range keys {
+		e.string(k)
+		e.string(tags[k])
+	}
+}
+
+// decoder reads the values written by the encoder. Once an error occurs
+// every read returns the zero value, so the error only has to be checked at
+// the end.
+type decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	d.err = err
+	return v
+}
+
+func (d *decoder) uint64() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	var b [8]byte
+	if _, err := io.ReadFull(d.r, b[:]); err != nil {
+		d.err = err
+		return 0
+	}
+	return binary.BigEndian.Uint64(b[:])
+}
+
+func (d *decoder) bool() bool {
+	if d.err != nil {
+		return false
+	}
+	b, err := d.r.ReadByte()
+	d.err = err
+	return b == 1
+}
+
+// length reads the length of a slice, making sure there could be enough data
+// left for it, so that garbage can't allocate huge slices.
+func (d *decoder) length() int {
+	v := d.uvarint()
+	if d.err == nil && v > uint64(d.r.Len()) {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	return int(v)
+}
+
+func (d *decoder) string() string {
+	n := d.length()
+	if d.err != nil {
+		return ""
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		d.err = err
+		return ""
+	}
+	return string(b)
+}
+
+// value decodes a value written by the encoder into v, which has to be a
+// pointer to a uint64, a string or implement encoding.BinaryUnmarshaler.
+func (d *decoder) value(v any) {
+	if d.err != nil {
+		return
+	}
+	switch x := v.(type) {
+	case *uint64:
+		*x = d.uint64()
+	case *string:
+		*x = d.string()
+	case encoding.BinaryUnmarshaler:
+		if b := d.string(); d.err == nil {
+			d.err = x.UnmarshalBinary([]byte(b))
+		}
+	default:
+		d.err = errors.Errorf("unable to decode %T", v)
+	}
+}
+
+func (d *decoder) tags() map[string]string {
+	n := d.length()
+	if d.err != nil || n == 0 {
+		return nil
+	}
+	res := make(map[string]string, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		k := d.string()
+		res[k] = d.string()
+	}
+	return res
+}
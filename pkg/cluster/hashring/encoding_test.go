@@ -0,0 +1,186 @@
+package hashring
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/spaolacci/murmur3"
+)
+
+func TestHashRingEncoding(t *testing.T) {
+	t.Parallel()
+
+	build := func(a ASCIISlice) *HashRing {
+		ring, err := NewWithHash(HashXXHash, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range a.Slice() {
+			ring.AddWeighted(v, k%3+1)
+			ring.SetTags(v, map[string]string{"zone": v})
+		}
+		return ring
+	}
+
+	equal := func(a, b *HashRing, key string) bool {
+		x, _ := a.Checksum()
+		y, _ := b.Checksum()
+		return x == y &&
+			reflect.DeepEqual(a.hashes(), b.hashes()) &&
+			reflect.DeepEqual(a.LookupN(key, 3), b.LookupN(key, 3)) &&
+			reflect.DeepEqual(a.state(), b.state())
+	}
+
+	t.Run("binary", func(t *testing.T) {
+		fn := func(a ASCIISlice, key ASCII) bool {
+			ring := build(a)
+
+			b, err := ring.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var res HashRing
+			if err := res.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+			return equal(ring, &res, key.String())
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		fn := func(a ASCIISlice, key ASCII) bool {
+			ring := build(a)
+
+			b, err := json.Marshal(ring)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var res HashRing
+			if err := json.Unmarshal(b, &res); err != nil {
+				t.Fatal(err)
+			}
+			return equal(ring, &res, key.String())
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("unnamed hash", func(t *testing.T) {
+		ring := New(murmur3.Sum64, 10)
+		ring.Add("a")
+
+		b, err := ring.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var missing HashRing
+		if expected, actual := false, missing.UnmarshalBinary(b) == nil; expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+
+		res := New(murmur3.Sum64, 1)
+		if err := res.UnmarshalBinary(b); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := true, equal(ring, res, "key"); expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		ring := build(ASCIISlice{"a", "b", "c"})
+
+		s := ring.state()
+		s.Hosts[0].Points[0].Hash++
+
+		b, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var res HashRing
+		if expected, actual := false, res.UnmarshalJSON(b) == nil; expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		ring := build(ASCIISlice{"a", "b", "c"})
+
+		b, err := ring.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < len(b); i++ {
+			var res HashRing
+			if expected, actual := false, res.UnmarshalBinary(b[:i]) == nil; expected != actual {
+				t.Fatalf("expected: %t, actual: %t", expected, actual)
+			}
+		}
+	})
+}
+
+func TestRBTreeEncoding(t *testing.T) {
+	t.Parallel()
+
+	walk := func(tree *RBTree) []nodeState[uint64, string] {
+		var res []nodeState[uint64, string]
+		tree.walkInOrder(func(n *RBNode) {
+			res = append(res, nodeState[uint64, string]{n.key, n.value})
+		})
+		return res
+	}
+
+	t.Run("binary", func(t *testing.T) {
+		fn := func(a uint8) bool {
+			tree := makeTreeWithAmount(int(a))
+
+			b, err := tree.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var res RBTree
+			if err := res.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+			return res.Size() == tree.Size() &&
+				reflect.DeepEqual(walk(tree), walk(&res)) &&
+				verifyTreeStructure(res.Root()) == nil
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		fn := func(a uint8) bool {
+			tree := makeTreeWithAmount(int(a))
+
+			b, err := json.Marshal(tree)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var res RBTree
+			if err := json.Unmarshal(b, &res); err != nil {
+				t.Fatal(err)
+			}
+			return res.Size() == tree.Size() &&
+				reflect.DeepEqual(walk(tree), walk(&res))
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+}
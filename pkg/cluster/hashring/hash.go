@@ -0,0 +1,85 @@
+package hashring
+
+import (
+	"hash/crc32"
+	"hash/fnv"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/pkg/errors"
+	"github.com/spaolacci/murmur3"
+)
+
+const (
+	// HashCRC32 hashes using the IEEE CRC-32 checksum. The hash is only 32-bit
+	// so it collides a lot more than the other hashes on large rings.
+	HashCRC32 = "crc32"
+
+	// HashFNV1a hashes using the 64-bit FNV-1a hash.
+	HashFNV1a = "fnv1a"
+
+	// HashXXHash hashes using the 64-bit xxHash hash.
+	HashXXHash = "xxhash"
+
+	// HashMurmur3 hashes using the 64-bit murmur3 hash.
+	HashMurmur3 = "murmur3"
+)
+
+// Hashes returns the names of all the hashes that can be created with
+// NewHash.
+func Hashes() []string {
+	return []string{
+		HashCRC32,
+		HashFNV1a,
+		HashXXHash,
+		HashMurmur3,
+	}
+}
+
+// NewHash returns the hash function from the name of the hash.
+func NewHash(name string) (func([]byte) uint64, error) {
+	switch name {
+	case HashCRC32:
+		return Widen(crc32.ChecksumIEEE), nil
+	case HashFNV1a:
+		return fnv1a, nil
+	case HashXXHash:
+		return xxhash.Sum64, nil
+	case HashMurmur3:
+		return murmur3.Sum64, nil
+	default:
+		return nil, errors.Errorf("unknown hash %q, expected one of %s", name, strings.Join(Hashes(), ", "))
+	}
+}
+
+// Widen turns a 32-bit hash in to a 64-bit hash. The hash is shifted in to
+// the upper bits, so that the hashes are still spread over the whole ring.
+func Widen(hashFn func([]byte) uint32) func([]byte) uint64 {
+	return func(b []byte) uint64 {
+		return uint64(hashFn(b)) << 32
+	}
+}
+
+func fnv1a(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
+// Mix the bits of a 64-bit hash with the finalizer of SplitMix64, so that
+// every bit of the result depends on every bit of the hash. A hash has to be
+// mixed before it's reduced with a modulo, as a widened 32-bit hash has none
+// of its entropy in the lower bits.
+func Mix(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// fold a 64-bit hash in to a 32-bit hash, keeping the entropy of both halves.
+func fold(h uint64) uint32 {
+	return uint32(h ^ h>>32)
+}
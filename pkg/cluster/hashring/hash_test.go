@@ -0,0 +1,71 @@
+package hashring
+
+import (
+	"fmt"
+	"testing"
+	"testing/quick"
+)
+
+func TestHash(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range Hashes() {
+		name := name
+
+		t.Run(name, func(t *testing.T) {
+			hashFn, err := NewHash(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fn := func(a ASCIISlice) bool {
+				ring := New(hashFn, 10)
+				for _, v := range a.Slice() {
+					if !ring.Add(v) {
+						return false
+					}
+				}
+				return ring.tree.Size() == len(a.Slice())*10
+			}
+			if err := quick.Check(fn, nil); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run(fmt.Sprintf("%s mix lower bits", name), func(t *testing.T) {
+			hashFn, err := NewHash(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			buckets := make(map[uint64]struct{})
+			for i := 0; i < 1000; i++ {
+				buckets[Mix(hashFn([]byte(fmt.Sprintf("key-%d", i))))%64] = struct{}{}
+			}
+			if expected, actual := 64, len(buckets); expected != actual {
+				t.Errorf("expected: %d, actual: %d", expected, actual)
+			}
+		})
+	}
+
+	t.Run("unknown hash", func(t *testing.T) {
+		_, err := NewHash("bad")
+
+		if expected, actual := false, err == nil; expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+	})
+
+	t.Run("widen keeps order", func(t *testing.T) {
+		fn := func(a, b uint32) bool {
+			var (
+				hashA = Widen(func([]byte) uint32 { return a })(nil)
+				hashB = Widen(func([]byte) uint32 { return b })(nil)
+			)
+			return (a < b) == (hashA < hashB)
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+}
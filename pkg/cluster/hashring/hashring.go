@@ -1,74 +1,238 @@
 package hashring
 
 import (
+	"cmp"
 	"fmt"
-	"strings"
 	"sync"
+	"sync/atomic"
 )
 
-type hashFn func(string) int
+type hashFn func(string) uint64
 
 // HashRing stores strings on a consistent hash ring. HashRing internally uses
 // Red-Black Tree to achieve O(log N) lookup and insertion time.
+// Lookups are done against an immutable Snapshot of the HashRing, so they
+// never block whilst the HashRing is being changed.
 type HashRing struct {
-	mtx               sync.RWMutex
-	hashFn            hashFn
-	replicationFactor int
-	hosts             map[string]struct{}
-	tree              *RBTree
-}
-
-// New creates a new HashRing with a replication factor
-func New(hashFn func([]byte) uint32, replicationFactor int) *HashRing {
-	return &HashRing{
-		hashFn: func(s string) int {
-			return int(hashFn([]byte(s)))
+	mtx      sync.RWMutex
+	snapshot atomic.Value
+	hashName string
+	hashFn   hashFn
+	vnodes   int // virtual nodes per unit of weight
+	hosts    map[string]*host
+	tree     *hostTree
+
+	// bounded load state, see NewBoundedLoad
+	bounded   bool
+	epsilon   float64
+	totalLoad *load
+}
+
+// host is a host of the HashRing, which is the value of every point of the
+// host on the tree. The name, weight, tags and load are shared with the
+// Snapshots, so a host is replaced rather than changed, apart from the load.
+// The points are only used whilst holding the write lock.
+type host struct {
+	name   string
+	weight int
+	tags   map[string]string
+	load   *load
+	points []vnode
+}
+
+// hostTree is a Tree of the hashes of the points to their host.
+type hostTree = Tree[uint64, *host]
+
+func newHostTree() *hostTree {
+	return NewTree[uint64, *host](cmp.Compare[uint64])
+}
+
+// with returns a copy of the host, that can then be changed and replaced.
+func (h *host) with(fn func(*host)) *host {
+	res := *h
+	fn(&res)
+	return &res
+}
+
+// names returns the names of the hosts.
+func names(hosts []*host) []string {
+	res := make([]string, len(hosts))
+	for k, v := range hosts {
+		res[k] = v.name
+	}
+	return res
+}
+
+// New creates a new HashRing, where every host is placed on the ring as the
+// number of virtual nodes. The number of virtual nodes only changes how evenly
+// the keys are spread, the number of hosts that own a key is given to LookupN.
+func New(hashFn func([]byte) uint64, vnodes int) *HashRing {
+	r := &HashRing{
+		hashFn: func(s string) uint64 {
+			return hashFn([]byte(s))
 		},
-		replicationFactor: replicationFactor,
-		hosts:             make(map[string]struct{}, 0),
-		tree:              NewRBTree(),
+		vnodes:    vnodes,
+		hosts:     make(map[string]*host),
+		tree:      newHostTree(),
+		totalLoad: new(load),
+	}
+	r.publish(true)
+	return r
+}
+
+// NewWithHash creates a new HashRing with the number of virtual nodes, using
+// the hash with the name from NewHash. Unlike New, the name of the hash is encoded
+// along with the HashRing, so a decoded HashRing hashes the keys the same way.
+func NewWithHash(hash string, vnodes int) (*HashRing, error) {
+	hashFn, err := NewHash(hash)
+	if err != nil {
+		return nil, err
 	}
+
+	r := New(hashFn, vnodes)
+	r.hashName = hash
+	return r, nil
 }
 
-// Add a host and replicate it around the hashring according to the replication
-// factor.
+// Add a host and replicate it around the hashring according to the number of
+// virtual nodes.
 // Returns true if an insertion happens for all replicated points
 func (r *HashRing) Add(host string) bool {
+	return r.AddWeighted(host, 1)
+}
+
+// AddWeighted adds a host and replicates it around the hashring according to
+// the number of virtual nodes multiplied by the weight, so that a host with a
+// larger weight owns proportionally more of the hashring.
+// Returns true if an insertion happens for all replicated points
+func (r *HashRing) AddWeighted(name string, weight int) bool {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 
-	if _, ok := r.hosts[host]; ok {
+	if _, ok := r.hosts[name]; ok || weight < 1 {
 		return false
 	}
 
-	r.hosts[host] = struct{}{}
-
-	added := true
-	for i := 0; i < r.replicationFactor; i++ {
-		key := fmt.Sprintf("%s%d", host, i)
-		added = added && r.tree.Insert(r.hashFn(key), host)
+	h := &host{
+		name:   name,
+		weight: weight,
+		load:   new(load),
 	}
+	r.hosts[name] = h
+
+	added := r.insert(h, 0, r.vnodes*weight)
+
+	r.publish(true)
+
 	return added
 }
 
+// Update re-weights a host that is already in the hashring. Only the
+// difference in the replicated points is added or removed, so the rest of
+// the hashring stays in place.
+// Returns true if the host was re-weighted.
+func (r *HashRing) Update(name string, weight int) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	current, ok := r.hosts[name]
+	if !ok || weight < 1 {
+		return false
+	}
+
+	h := r.replace(current, func(h *host) {
+		h.weight = weight
+	})
+
+	var (
+		from = r.vnodes * current.weight
+		to   = r.vnodes * weight
+	)
+	defer r.publish(true)
+
+	if to > from {
+		return r.insert(h, from, to)
+	}
+	return r.delete(h, to, from)
+}
+
+// replace the host with a changed copy of the host, both in the index and the
+// points on the tree, so that the Snapshots still see the host as it was.
+// The caller is expected to publish the change.
+func (r *HashRing) replace(current *host, fn func(*host)) *host {
+	h := current.with(fn)
+	r.hosts[h.name] = h
+	for _, v := range h.points {
+		if v.salt >= maxSalt {
+			continue
+		}
+		if n, ok := r.tree.node(v.hash); ok && n.value == current {
+			n.value = h
+		}
+	}
+	return h
+}
+
+// Weight returns the weight of a host and whether the HashRing contains the
+// host at all.
+func (r *HashRing) Weight(host string) (int, bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if h, ok := r.hosts[host]; ok {
+		return h.weight, true
+	}
+	return 0, false
+}
+
 // Remove a host from the hashring including all the subsequent replicated
 // hosts.
 // Returns true if a deletion happens to all the replicated points
-func (r *HashRing) Remove(host string) bool {
+func (r *HashRing) Remove(name string) bool {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 
-	if _, ok := r.hosts[host]; !ok {
+	h, ok := r.hosts[name]
+	if !ok {
 		return false
 	}
 
+	delete(r.hosts, name)
+	removed := r.delete(h, 0, r.vnodes*h.weight)
+
+	r.totalLoad.add(-h.load.value())
+
+	r.publish(true)
+
+	return removed
+}
+
+// insert the replicated points of a host from the start index, up to but not
+// including the end index. Any collisions are resolved when placing the
+// points, see place.
+func (r *HashRing) insert(h *host, start, end int) bool {
+	points := make([]vnode, end)
+	copy(points, h.points)
+	h.points = points
+
+	added := true
+	for i := start; i < end; i++ {
+		added = r.place(h, i) && added
+	}
+	return added
+}
+
+// delete the replicated points of a host from the start index, up to but not
+// including the end index. Only the points that belong to the host are
+// deleted.
+func (r *HashRing) delete(h *host, start, end int) bool {
 	removed := true
-	for i := 0; i < r.replicationFactor; i++ {
-		key := fmt.Sprintf("%s%d", host, i)
-		removed = removed && r.tree.Delete(r.hashFn(key))
+	for i := start; i < end; i++ {
+		removed = r.unplace(h, i) && removed
 	}
+	h.points = h.points[:start]
 
-	delete(r.hosts, host)
+	r.resettle()
 
 	return removed
 }
@@ -76,20 +240,16 @@ func (r *HashRing) Remove(host string) bool {
 // Lookup returns the owner of the given key and whether the HashRing contains
 // the key at all.
 func (r *HashRing) Lookup(key string) (string, bool) {
-	if s := r.LookupN(key, 1); len(s) > 0 {
-		return s[0], true
-	}
-	return "", false
+	return r.Snapshot().Lookup(key)
 }
 
 // LookupN returns the N servers that own the given key. Duplicates in the form
 // of virtual nodes are skipped to maintain a list of unique servers. If there
 // are less servers than N, we simply return all existing servers.
+// When the HashRing bounds the load, servers that are over the bound are
+// skipped, see NewBoundedLoad.
 func (r *HashRing) LookupN(key string, n int) []string {
-	r.mtx.RLock()
-	defer r.mtx.RUnlock()
-
-	return r.tree.LookupNUniqueAt(n, r.hashFn(key))
+	return r.Snapshot().LookupN(key, n)
 }
 
 // Contains checks to see if a key is already in the ring.
@@ -108,53 +268,31 @@ func (r *HashRing) Contains(key string) bool {
 
 // Hosts returns the hosts in a slice.
 func (r *HashRing) Hosts() []string {
-	r.mtx.RLock()
-	defer r.mtx.RUnlock()
-
-	var (
-		idx int
-		res = make([]string, len(r.hosts))
-	)
-	for k := range r.hosts {
-		res[idx] = k
-		idx++
-	}
-	return res
+	return r.Snapshot().Hosts()
 }
 
-// Walk iterates over each node in the hashring, because of the replication
-// factor, the number of nodes you walk over will be many.
+// Walk iterates over each node in the hashring, because of the virtual
+// nodes, the number of nodes you walk over will be many.
 // If an error is returned whilst walking the nodes, it will stop walking
 // immediately and return that error.
 func (r *HashRing) Walk(fn func(string, string) error) error {
 	r.mtx.RLock()
 	defer r.mtx.RUnlock()
 
-	return r.tree.Walk(func(n *RBNode) error {
-		return fn(fmt.Sprintf("%08x", n.key), n.value)
+	return r.tree.Walk(func(n *Node[uint64, *host]) error {
+		return fn(fmt.Sprintf("%016x", n.key), n.value.name)
 	})
 }
 
 // Len returns the number of unique hosts
 func (r *HashRing) Len() int {
-	r.mtx.RLock()
-	defer r.mtx.RUnlock()
-
-	return len(r.hosts)
+	return r.Snapshot().Len()
 }
 
-// Checksum the hashring to verify if there have been any changes
+// Checksum the hashring to verify if there have been any changes. The
+// checksum only depends on the hashes and hosts, so two hashrings with the
+// same hosts have the same checksum, regardless of the order the hosts were
+// added in.
 func (r *HashRing) Checksum() (uint32, error) {
-	r.mtx.RLock()
-	defer r.mtx.RUnlock()
-
-	var values []string
-	if err := r.tree.Walk(func(n *RBNode) error {
-		values = append(values, fmt.Sprintf("%s:%s", n.nodeType.String(), n.value))
-		return nil
-	}); err != nil {
-		return 0, err
-	}
-
-	return uint32(r.hashFn(strings.Join(values, ";"))), nil
+	return NewPointsChecksum().Checksum(r), nil
 }
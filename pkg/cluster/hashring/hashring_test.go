@@ -15,7 +15,7 @@ func TestHashRingAddRemove(t *testing.T) {
 
 	t.Run("add", func(t *testing.T) {
 		fn := func(a ASCII) bool {
-			ring := New(murmur3.Sum32, 2)
+			ring := New(murmur3.Sum64, 2)
 			return ring.Add(a.String())
 		}
 		if err := quick.Check(fn, nil); err != nil {
@@ -25,7 +25,7 @@ func TestHashRingAddRemove(t *testing.T) {
 
 	t.Run("add duplicate", func(t *testing.T) {
 		fn := func(a ASCII) bool {
-			ring := New(murmur3.Sum32, 2)
+			ring := New(murmur3.Sum64, 2)
 			ring.Add(a.String())
 			return !ring.Add(a.String())
 		}
@@ -36,7 +36,7 @@ func TestHashRingAddRemove(t *testing.T) {
 
 	t.Run("remove", func(t *testing.T) {
 		fn := func(a ASCII) bool {
-			ring := New(murmur3.Sum32, 2)
+			ring := New(murmur3.Sum64, 2)
 			return !ring.Remove(a.String())
 		}
 		if err := quick.Check(fn, nil); err != nil {
@@ -46,7 +46,7 @@ func TestHashRingAddRemove(t *testing.T) {
 
 	t.Run("add then remove", func(t *testing.T) {
 		fn := func(a ASCII) bool {
-			ring := New(murmur3.Sum32, 2)
+			ring := New(murmur3.Sum64, 2)
 			ring.Add(a.String())
 			return ring.Remove(a.String())
 		}
@@ -61,7 +61,7 @@ func TestHashRingLookup(t *testing.T) {
 
 	t.Run("lookup", func(t *testing.T) {
 		fn := func(a ASCII) bool {
-			ring := New(murmur3.Sum32, 10)
+			ring := New(murmur3.Sum64, 10)
 			if expected, actual := true, ring.Add(a.String()); expected != actual {
 				t.Errorf("expected: %t, actual: %t", expected, actual)
 			}
@@ -84,7 +84,7 @@ func TestHashRingLookup(t *testing.T) {
 				return true
 			}
 
-			ring := New(murmur3.Sum32, 10)
+			ring := New(murmur3.Sum64, 10)
 			for _, v := range a {
 				ring.Add(v.String())
 			}
@@ -103,7 +103,7 @@ func TestHashRingLookup(t *testing.T) {
 
 	t.Run("lookup with empty value", func(t *testing.T) {
 		fn := func(a ASCII) bool {
-			ring := New(murmur3.Sum32, 10)
+			ring := New(murmur3.Sum64, 10)
 
 			want := []string{}
 			got := ring.LookupN(a.String(), 2)
@@ -116,12 +116,99 @@ func TestHashRingLookup(t *testing.T) {
 	})
 }
 
+func TestHashRingWeighted(t *testing.T) {
+	t.Parallel()
+
+	t.Run("add weighted", func(t *testing.T) {
+		fn := func(a ASCII, weight uint8) bool {
+			w := int(weight%8) + 1
+
+			ring := New(murmur3.Sum64, 2)
+			ring.AddWeighted(a.String(), w)
+
+			var nodes int
+			ring.Walk(func(string, string) error {
+				nodes++
+				return nil
+			})
+
+			got, ok := ring.Weight(a.String())
+			return ok && got == w && nodes == 2*w
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("add invalid weight", func(t *testing.T) {
+		ring := New(murmur3.Sum64, 2)
+
+		if expected, actual := false, ring.AddWeighted("a", 0); expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		fn := func(a, b ASCII) bool {
+			if a == b {
+				return true
+			}
+
+			var (
+				ring     = New(murmur3.Sum64, 10)
+				expected = New(murmur3.Sum64, 10)
+			)
+			ring.Add(a.String())
+			ring.Add(b.String())
+			expected.AddWeighted(a.String(), 3)
+			expected.Add(b.String())
+
+			if !ring.Update(a.String(), 3) {
+				return false
+			}
+			if !reflect.DeepEqual(points(expected), points(ring)) {
+				return false
+			}
+
+			// Scaling back down should remove the additional points.
+			ring.Update(a.String(), 1)
+			expected.Update(a.String(), 1)
+
+			return reflect.DeepEqual(points(expected), points(ring))
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("update missing host", func(t *testing.T) {
+		ring := New(murmur3.Sum64, 2)
+
+		if expected, actual := false, ring.Update("a", 2); expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+	})
+
+	t.Run("remove weighted", func(t *testing.T) {
+		fn := func(a ASCII) bool {
+			ring := New(murmur3.Sum64, 2)
+			ring.AddWeighted(a.String(), 4)
+			ring.Remove(a.String())
+
+			return ring.tree.Size() == 0
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
 func TestHashRingChecksum(t *testing.T) {
 	t.Parallel()
 
 	t.Run("add", func(t *testing.T) {
 		fn := func(a ASCII) bool {
-			ring := New(murmur3.Sum32, 64)
+			ring := New(murmur3.Sum64, 64)
 			ring.Add(a.String())
 
 			v0, err0 := ring.Checksum()
@@ -143,7 +230,7 @@ func TestHashRingChecksum(t *testing.T) {
 
 	t.Run("remove", func(t *testing.T) {
 		fn := func(a, b ASCII) bool {
-			ring := New(murmur3.Sum32, 64)
+			ring := New(murmur3.Sum64, 64)
 			ring.Add(a.String())
 			ring.Add(a.String())
 			ring.Add(b.String())
@@ -166,9 +253,31 @@ func TestHashRingChecksum(t *testing.T) {
 		}
 	})
 
+	t.Run("order of hosts", func(t *testing.T) {
+		fn := func(a ASCIISlice) bool {
+			var (
+				hosts    = a.Slice()
+				ring     = New(murmur3.Sum64, 16)
+				reversed = New(murmur3.Sum64, 16)
+			)
+			for k := range hosts {
+				ring.Add(hosts[k])
+				reversed.Add(hosts[len(hosts)-1-k])
+			}
+
+			v0, _ := ring.Checksum()
+			v1, _ := reversed.Checksum()
+
+			return v0 == v1
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
 	t.Run("add and remove", func(t *testing.T) {
 		fn := func(a, b ASCII) bool {
-			ring := New(murmur3.Sum32, 64)
+			ring := New(murmur3.Sum64, 64)
 			ring.Add(a.String())
 			ring.Add(a.String())
 			ring.Add(b.String())
@@ -193,6 +302,17 @@ func TestHashRingChecksum(t *testing.T) {
 	})
 }
 
+// points returns the points of the hashring, regardless of the shape of the
+// underlying tree.
+func points(ring *HashRing) map[string]string {
+	res := make(map[string]string)
+	ring.Walk(func(hash, host string) error {
+		res[hash] = host
+		return nil
+	})
+	return res
+}
+
 const asciiChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
 // GenerateString creates a random string
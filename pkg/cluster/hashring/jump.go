@@ -0,0 +1,123 @@
+package hashring
+
+import (
+	"sync"
+)
+
+// Jump places keys using jump consistent hashing. Jump needs no memory
+// other than the hosts and spreads the keys evenly, but the hosts are
+// numbered buckets. A host keeps its bucket for as long as it's placed, new
+// hosts are given the next bucket and the bucket of a removed host is given
+// to the host of the last bucket. So adding a host only moves keys to the new
+// host, and removing one only moves the keys of the removed host and of the
+// last host.
+//
+// The buckets depend on the order the hosts were added and removed in, every
+// node has to add and remove the hosts in the same order, such as the order
+// the hosts joined the cluster in, to agree on the buckets. The checksum
+// covers the buckets, so nodes that disagree can be told apart.
+type Jump struct {
+	mtx     sync.RWMutex
+	hashFn  func([]byte) uint64
+	hosts   []string
+	buckets map[string]int
+}
+
+// NewJump creates a new Jump placement
+func NewJump(hashFn func([]byte) uint64) *Jump {
+	return &Jump{
+		hashFn:  hashFn,
+		buckets: make(map[string]int),
+	}
+}
+
+// Add a host to the placement, the host is given the next bucket.
+// Returns true if the host was added.
+func (j *Jump) Add(host string) bool {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	if _, ok := j.buckets[host]; ok {
+		return false
+	}
+	j.buckets[host] = len(j.hosts)
+	j.hosts = append(j.hosts, host)
+	return true
+}
+
+// Remove a host from the placement, the host of the last bucket takes over
+// the bucket of the host.
+// Returns true if the host was removed.
+func (j *Jump) Remove(host string) bool {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	idx, ok := j.buckets[host]
+	if !ok {
+		return false
+	}
+	last := len(j.hosts) - 1
+	if idx != last {
+		j.hosts[idx] = j.hosts[last]
+		j.buckets[j.hosts[idx]] = idx
+	}
+	j.hosts = j.hosts[:last]
+	delete(j.buckets, host)
+	return true
+}
+
+// LookupN returns the host of the bucket for the given key, followed by the
+// hosts in the next buckets. If there are less hosts than N, all the hosts
+// are returned.
+func (j *Jump) LookupN(key string, n int) []string {
+	j.mtx.RLock()
+	defer j.mtx.RUnlock()
+
+	num := len(j.hosts)
+	if n > num {
+		n = num
+	}
+
+	res := make([]string, n)
+	if n == 0 {
+		return res
+	}
+
+	bucket := jumpHash(j.hashFn([]byte(key)), num)
+	for k := range res {
+		res[k] = j.hosts[(bucket+k)%num]
+	}
+	return res
+}
+
+// Hosts returns the hosts in bucket order.
+func (j *Jump) Hosts() []string {
+	j.mtx.RLock()
+	defer j.mtx.RUnlock()
+
+	res := make([]string, len(j.hosts))
+	copy(res, j.hosts)
+	return res
+}
+
+// Checksum the placement to verify if there have been any changes. The hosts
+// are checksummed in bucket order, so only the same hosts in the same buckets
+// have the same checksum.
+func (j *Jump) Checksum() (uint32, error) {
+	j.mtx.RLock()
+	defer j.mtx.RUnlock()
+
+	return checksumHosts(j.hashFn, j.hosts), nil
+}
+
+// jumpHash is the jump consistent hash by Lamping and Veach, which returns a
+// bucket in the range of [0, buckets).
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,149 @@
+package hashring
+
+import (
+	"sync"
+)
+
+// DefaultMaglevTableSize is the default size of the Maglev lookup table. The
+// size has to be a prime and should be a lot larger than the number of hosts.
+const DefaultMaglevTableSize = 65537
+
+// Maglev places keys using the lookup tables from Google's Maglev load
+// balancer. Each host fills the table in the order of its own permutation,
+// which gives a near perfect balance, at the cost of rebuilding the table
+// when the hosts change. A lookup is O(1).
+type Maglev struct {
+	mtx    sync.RWMutex
+	hashFn func([]byte) uint64
+	size   int
+	hosts  map[string]struct{}
+	sorted []string
+	table  []int
+}
+
+// NewMaglev creates a new Maglev placement with a lookup table of the given
+// size, which should be a prime.
+func NewMaglev(hashFn func([]byte) uint64, size int) *Maglev {
+	return &Maglev{
+		hashFn: hashFn,
+		size:   size,
+		hosts:  make(map[string]struct{}),
+	}
+}
+
+// Add a host to the placement and rebuild the lookup table.
+// Returns true if the host was added.
+func (m *Maglev) Add(host string) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if _, ok := m.hosts[host]; ok {
+		return false
+	}
+	m.hosts[host] = struct{}{}
+	m.populate()
+	return true
+}
+
+// Remove a host from the placement and rebuild the lookup table.
+// Returns true if the host was removed.
+func (m *Maglev) Remove(host string) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if _, ok := m.hosts[host]; !ok {
+		return false
+	}
+	delete(m.hosts, host)
+	m.populate()
+	return true
+}
+
+// LookupN returns the host in the lookup table entry for the given key,
+// followed by the unique hosts of the next entries. If there are less hosts
+// than N, all the hosts are returned.
+func (m *Maglev) LookupN(key string, n int) []string {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	if n > len(m.sorted) {
+		n = len(m.sorted)
+	}
+
+	var (
+		res    = make([]string, 0, n)
+		unique = make(map[int]struct{}, n)
+		idx    = int(Mix(m.hashFn([]byte(key))) % uint64(m.size))
+	)
+	for i := 0; len(res) < n && i < m.size; i++ {
+		host := m.table[(idx+i)%m.size]
+		if _, ok := unique[host]; ok {
+			continue
+		}
+		unique[host] = struct{}{}
+		res = append(res, m.sorted[host])
+	}
+	return res
+}
+
+// Hosts returns the hosts in a slice.
+func (m *Maglev) Hosts() []string {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	res := make([]string, len(m.sorted))
+	copy(res, m.sorted)
+	return res
+}
+
+// Checksum the placement to verify if there have been any changes
+func (m *Maglev) Checksum() (uint32, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return checksumHosts(m.hashFn, m.sorted), nil
+}
+
+// populate rebuilds the lookup table. The hosts are sorted first, so every
+// node that knows of the same hosts builds the same table.
+func (m *Maglev) populate() {
+	m.sorted = sortedHosts(m.hosts)
+
+	num := len(m.sorted)
+	if num == 0 {
+		m.table = nil
+		return
+	}
+
+	var (
+		size    = uint64(m.size)
+		offsets = make([]uint64, num)
+		skips   = make([]uint64, num)
+		next    = make([]uint64, num)
+		table   = make([]int, m.size)
+	)
+	for k, host := range m.sorted {
+		offsets[k] = Mix(m.hashFn([]byte(host+"offset"))) % size
+		skips[k] = Mix(m.hashFn([]byte(host+"skip")))%(size-1) + 1
+	}
+	for k := range table {
+		table[k] = -1
+	}
+
+	for filled := 0; ; {
+		for k := 0; k < num; k++ {
+			c := (offsets[k] + next[k]*skips[k]) % size
+			for table[c] >= 0 {
+				next[k]++
+				c = (offsets[k] + next[k]*skips[k]) % size
+			}
+			table[c] = k
+			next[k]++
+
+			if filled++; filled == m.size {
+				m.table = table
+				return
+			}
+		}
+	}
+}
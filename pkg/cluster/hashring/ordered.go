@@ -0,0 +1,250 @@
+package hashring
+
+// Key returns the key of the node
+func (n *Node[K, V]) Key() K {
+	return n.key
+}
+
+// Value returns the value of the node
+func (n *Node[K, V]) Value() V {
+	return n.value
+}
+
+// Min returns the node with the smallest key and whether the tree has any
+// nodes at all.
+func (t *Tree[K, V]) Min() (*Node[K, V], bool) {
+	if t.root == nil {
+		return nil, false
+	}
+	n := t.root
+	for n.left != nil {
+		n = n.left
+	}
+	return n, true
+}
+
+// Max returns the node with the largest key and whether the tree has any
+// nodes at all.
+func (t *Tree[K, V]) Max() (*Node[K, V], bool) {
+	if t.root == nil {
+		return nil, false
+	}
+	n := t.root
+	for n.right != nil {
+		n = n.right
+	}
+	return n, true
+}
+
+// Floor returns the node with the largest key that is smaller than or equal
+// to the key.
+// Returns false if there is no such node.
+func (t *Tree[K, V]) Floor(key K) (*Node[K, V], bool) {
+	var res *Node[K, V]
+	for n := t.root; n != nil; {
+		switch comparator := t.compareKeys(n.key, key); {
+		case comparator == 0:
+			return n, true
+		case comparator < 0:
+			res, n = n, n.right
+		default:
+			n = n.left
+		}
+	}
+	return res, res != nil
+}
+
+// Ceiling returns the node with the smallest key that is larger than or
+// equal to the key.
+// Returns false if there is no such node.
+func (t *Tree[K, V]) Ceiling(key K) (*Node[K, V], bool) {
+	var res *Node[K, V]
+	for n := t.root; n != nil; {
+		switch comparator := t.compareKeys(n.key, key); {
+		case comparator == 0:
+			return n, true
+		case comparator > 0:
+			res, n = n, n.left
+		default:
+			n = n.right
+		}
+	}
+	return res, res != nil
+}
+
+// Predecessor returns the node with the largest key that is strictly smaller
+// than the key, the key itself doesn't have to be in the tree.
+// Returns false if there is no such node.
+func (t *Tree[K, V]) Predecessor(key K) (*Node[K, V], bool) {
+	var res *Node[K, V]
+	for n := t.root; n != nil; {
+		if t.compareKeys(n.key, key) < 0 {
+			res, n = n, n.right
+		} else {
+			n = n.left
+		}
+	}
+	return res, res != nil
+}
+
+// Successor returns the node with the smallest key that is strictly larger
+// than the key, the key itself doesn't have to be in the tree.
+// Returns false if there is no such node.
+func (t *Tree[K, V]) Successor(key K) (*Node[K, V], bool) {
+	var res *Node[K, V]
+	for n := t.root; n != nil; {
+		if t.compareKeys(n.key, key) > 0 {
+			res, n = n, n.left
+		} else {
+			n = n.right
+		}
+	}
+	return res, res != nil
+}
+
+// Range iterates over the nodes with keys from the start key up to and
+// including the end key, in the order of the keys. If the start key is larger
+// than the end key, the range wraps around the end of the tree, the same way
+// it would around a ring.
+// If an error is returned whilst walking the nodes, it will stop walking
+// immediately and return that error.
+func (t *Tree[K, V]) Range(from, to K, fn func(*Node[K, V]) error) error {
+	if t.compareKeys(from, to) > 0 {
+		if err := t.walkRange(t.root, &from, nil, fn); err != nil {
+			return err
+		}
+		return t.walkRange(t.root, nil, &to, fn)
+	}
+	return t.walkRange(t.root, &from, &to, fn)
+}
+
+// WalkReverse walks over the tree in the reverse order of the keys, from the
+// largest key to the smallest key.
+// If an error is returned whilst walking the nodes, it will stop walking
+// immediately and return that error.
+func (t *Tree[K, V]) WalkReverse(fn func(*Node[K, V]) error) error {
+	var walk func(*Node[K, V]) error
+	walk = func(n *Node[K, V]) error {
+		if n == nil {
+			return nil
+		}
+		if err := walk(n.right); err != nil {
+			return err
+		}
+		if err := fn(n); err != nil {
+			return err
+		}
+		return walk(n.left)
+	}
+	return walk(t.root)
+}
+
+// walkInOrder walks the nodes of the tree in the order of the keys.
+func (t *Tree[K, V]) walkInOrder(fn func(*Node[K, V])) {
+	var walk func(*Node[K, V])
+	walk = func(n *Node[K, V]) {
+		if n == nil {
+			return
+		}
+		walk(n.left)
+		fn(n)
+		walk(n.right)
+	}
+	walk(t.root)
+}
+
+// walkRange walks the nodes from the start key up to and including the end
+// key, a missing start or end key leaves that side of the range open.
+func (t *Tree[K, V]) walkRange(n *Node[K, V], from, to *K, fn func(*Node[K, V]) error) error {
+	if n == nil {
+		return nil
+	}
+
+	var (
+		afterFrom = from == nil || t.compareKeys(n.key, *from) > 0
+		beforeTo  = to == nil || t.compareKeys(n.key, *to) < 0
+		inRange   = (afterFrom || t.compareKeys(n.key, *from) == 0) && (beforeTo || t.compareKeys(n.key, *to) == 0)
+	)
+	if afterFrom {
+		if err := t.walkRange(n.left, from, to, fn); err != nil {
+			return err
+		}
+	}
+	if inRange {
+		if err := fn(n); err != nil {
+			return err
+		}
+	}
+	if beforeTo {
+		return t.walkRange(n.right, from, to, fn)
+	}
+	return nil
+}
+
+// Iterator iterates over the nodes of a RBTree in the order of the keys.
+// The Iterator only remembers the key it's at, rather than the node, so it's
+// safe to pause the Iterator and change the RBTree between calls to Next.
+type Iterator[K any, V any] struct {
+	tree    *Tree[K, V]
+	key     K
+	value   V
+	from    bool
+	started bool
+	done    bool
+}
+
+// Iterator returns an Iterator that starts at the smallest key of the tree.
+func (t *Tree[K, V]) Iterator() *Iterator[K, V] {
+	return &Iterator[K, V]{
+		tree: t,
+	}
+}
+
+// IteratorAt returns an Iterator that starts at the smallest key that is
+// larger than or equal to the key.
+func (t *Tree[K, V]) IteratorAt(key K) *Iterator[K, V] {
+	return &Iterator[K, V]{
+		tree: t,
+		key:  key,
+		from: true,
+	}
+}
+
+// Next moves the Iterator to the next node.
+// Returns false once there are no more nodes.
+func (it *Iterator[K, V]) Next() bool {
+	if it.done {
+		return false
+	}
+
+	var (
+		n  *Node[K, V]
+		ok bool
+	)
+	switch {
+	case it.started:
+		n, ok = it.tree.Successor(it.key)
+	case it.from:
+		n, ok = it.tree.Ceiling(it.key)
+	default:
+		n, ok = it.tree.Min()
+	}
+	it.started = true
+	if !ok {
+		it.done = true
+		return false
+	}
+
+	it.key, it.value = n.key, n.value
+	return true
+}
+
+// Key returns the key of the node the Iterator is at.
+func (it *Iterator[K, V]) Key() K {
+	return it.key
+}
+
+// Value returns the value of the node the Iterator is at.
+func (it *Iterator[K, V]) Value() V {
+	return it.value
+}
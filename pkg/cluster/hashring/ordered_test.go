@@ -0,0 +1,209 @@
+package hashring
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/quick"
+)
+
+// orderedTree creates a tree from the keys, along with the keys sorted and
+// without any duplicates.
+func orderedTree(a []uint16) (*RBTree, []uint64) {
+	var (
+		tree = NewRBTree()
+		keys []uint64
+	)
+	for _, v := range a {
+		if tree.Insert(uint64(v), fmt.Sprintf("%d", v)) {
+			keys = append(keys, uint64(v))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+	return tree, keys
+}
+
+func nodeKey(n *RBNode, ok bool) (uint64, bool) {
+	if !ok {
+		return 0, false
+	}
+	return n.Key(), true
+}
+
+func TestRBTreeOrdered(t *testing.T) {
+	t.Parallel()
+
+	t.Run("min and max", func(t *testing.T) {
+		fn := func(a []uint16) bool {
+			tree, keys := orderedTree(a)
+
+			min, minOK := nodeKey(tree.Min())
+			max, maxOK := nodeKey(tree.Max())
+			if len(keys) == 0 {
+				return !minOK && !maxOK
+			}
+			return min == keys[0] && max == keys[len(keys)-1]
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("floor and ceiling", func(t *testing.T) {
+		fn := func(a []uint16, b uint16) bool {
+			tree, keys := orderedTree(a)
+			key := uint64(b)
+
+			var (
+				floor, ceiling     uint64
+				floorOK, ceilingOK bool
+			)
+			for _, v := range keys {
+				if v <= key {
+					floor, floorOK = v, true
+				}
+				if v >= key && !ceilingOK {
+					ceiling, ceilingOK = v, true
+				}
+			}
+
+			f, fOK := nodeKey(tree.Floor(key))
+			c, cOK := nodeKey(tree.Ceiling(key))
+			return f == floor && fOK == floorOK && c == ceiling && cOK == ceilingOK
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("predecessor and successor", func(t *testing.T) {
+		fn := func(a []uint16, b uint16) bool {
+			tree, keys := orderedTree(a)
+			key := uint64(b)
+
+			var (
+				pred, succ     uint64
+				predOK, succOK bool
+			)
+			for _, v := range keys {
+				if v < key {
+					pred, predOK = v, true
+				}
+				if v > key && !succOK {
+					succ, succOK = v, true
+				}
+			}
+
+			p, pOK := nodeKey(tree.Predecessor(key))
+			s, sOK := nodeKey(tree.Successor(key))
+			return p == pred && pOK == predOK && s == succ && sOK == succOK
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("range", func(t *testing.T) {
+		fn := func(a []uint16, from, to uint16) bool {
+			tree, keys := orderedTree(a)
+
+			var want []uint64
+			if from <= to {
+				for _, v := range keys {
+					if v >= uint64(from) && v <= uint64(to) {
+						want = append(want, v)
+					}
+				}
+			} else {
+				for _, v := range keys {
+					if v >= uint64(from) {
+						want = append(want, v)
+					}
+				}
+				for _, v := range keys {
+					if v <= uint64(to) {
+						want = append(want, v)
+					}
+				}
+			}
+
+			var got []uint64
+			tree.Range(uint64(from), uint64(to), func(n *RBNode) error {
+				got = append(got, n.Key())
+				return nil
+			})
+			return reflect.DeepEqual(want, got)
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("walk reverse", func(t *testing.T) {
+		fn := func(a []uint16) bool {
+			tree, keys := orderedTree(a)
+
+			var want []uint64
+			for i := len(keys) - 1; i >= 0; i-- {
+				want = append(want, keys[i])
+			}
+
+			var got []uint64
+			tree.WalkReverse(func(n *RBNode) error {
+				got = append(got, n.Key())
+				return nil
+			})
+			return reflect.DeepEqual(want, got)
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("iterator", func(t *testing.T) {
+		fn := func(a []uint16) bool {
+			tree, keys := orderedTree(a)
+
+			var (
+				got []uint64
+				it  = tree.Iterator()
+			)
+			for it.Next() {
+				if it.Value() != fmt.Sprintf("%d", it.Key()) {
+					return false
+				}
+				got = append(got, it.Key())
+			}
+			return reflect.DeepEqual(keys, got) && !it.Next()
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("iterator paused", func(t *testing.T) {
+		tree, _ := orderedTree([]uint16{1, 2, 3, 4, 5})
+
+		it := tree.IteratorAt(2)
+		if expected, actual := true, it.Next(); expected != actual {
+			t.Fatalf("expected: %t, actual: %t", expected, actual)
+		}
+
+		// Deleting the current node and inserting new nodes whilst paused
+		// shouldn't upset the iterator.
+		tree.Delete(2)
+		tree.Delete(3)
+		tree.Insert(6, "6")
+
+		var got []uint64
+		for it.Next() {
+			got = append(got, it.Key())
+		}
+		if expected, actual := []uint64{4, 5, 6}, got; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
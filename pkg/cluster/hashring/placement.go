@@ -0,0 +1,114 @@
+package hashring
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Placement decides which hosts own a key. Each implementation trades off
+// the balance of the keys against how many keys move when the hosts change.
+type Placement interface {
+
+	// Add a host to the placement.
+	// Returns true if the host was added.
+	Add(string) bool
+
+	// Remove a host from the placement.
+	// Returns true if the host was removed.
+	Remove(string) bool
+
+	// LookupN returns the N unique hosts that own the given key. If there are
+	// less hosts than N, all the hosts are returned.
+	LookupN(string, int) []string
+
+	// Hosts returns the hosts in a slice.
+	Hosts() []string
+
+	// Checksum the placement to verify if there have been any changes.
+	Checksum() (uint32, error)
+}
+
+// Weighted is implemented by a Placement that supports weighted hosts.
+type Weighted interface {
+
+	// AddWeighted adds a host with a weight to the placement.
+	// Returns true if the host was added.
+	AddWeighted(string, int) bool
+
+	// Update re-weights a host in the placement.
+	// Returns true if the host was re-weighted.
+	Update(string, int) bool
+}
+
+// Walker is implemented by a Placement that places the hosts on hashes.
+type Walker interface {
+
+	// Walk iterates over each hash and host of the placement.
+	Walk(func(string, string) error) error
+}
+
+const (
+	// PlacementRing places keys using the red-black tree backed HashRing.
+	PlacementRing = "ring"
+
+	// PlacementRendezvous places keys using rendezvous (highest random weight)
+	// hashing.
+	PlacementRendezvous = "rendezvous"
+
+	// PlacementJump places keys using jump consistent hashing.
+	PlacementJump = "jump"
+
+	// PlacementMaglev places keys using Maglev lookup tables.
+	PlacementMaglev = "maglev"
+)
+
+// Placements returns the names of all the placements that can be created with
+// NewPlacement.
+func Placements() []string {
+	return []string{
+		PlacementRing,
+		PlacementRendezvous,
+		PlacementJump,
+		PlacementMaglev,
+	}
+}
+
+// NewPlacement creates a new Placement from the name of the placement, which
+// hashes using the hash with the name from NewHash. The number of virtual nodes
+// is only used by placements that place each host more than once.
+func NewPlacement(name, hash string, vnodes int) (Placement, error) {
+	hashFn, err := NewHash(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case PlacementRing:
+		return NewWithHash(hash, vnodes)
+	case PlacementRendezvous:
+		return NewRendezvous(hashFn), nil
+	case PlacementJump:
+		return NewJump(hashFn), nil
+	case PlacementMaglev:
+		return NewMaglev(hashFn, DefaultMaglevTableSize), nil
+	default:
+		return nil, errors.Errorf("unknown placement %q, expected one of %s", name, strings.Join(Placements(), ", "))
+	}
+}
+
+// checksumHosts creates a checksum of the hosts in the order they're given.
+func checksumHosts(hashFn func([]byte) uint64, hosts []string) uint32 {
+	return fold(hashFn([]byte(strings.Join(hosts, ";"))))
+}
+
+// sortedHosts returns the hosts of a set in a sorted slice.
+func sortedHosts(hosts map[string]struct{}) []string {
+	res := make([]string, 0, len(hosts))
+	for k := range hosts {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,346 @@
+package hashring
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/quick"
+
+	"github.com/spaolacci/murmur3"
+)
+
+func TestPlacement(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range Placements() {
+		name := name
+
+		create := func(t *testing.T) Placement {
+			// Rebuilding the default table for every host is slow when
+			// running quick checks.
+			if name == PlacementMaglev {
+				return NewMaglev(murmur3.Sum64, 1021)
+			}
+			placement, err := NewPlacement(name, HashMurmur3, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return placement
+		}
+
+		t.Run(fmt.Sprintf("%s add remove", name), func(t *testing.T) {
+			fn := func(a ASCII) bool {
+				placement := create(t)
+				return placement.Add(a.String()) &&
+					!placement.Add(a.String()) &&
+					placement.Remove(a.String()) &&
+					!placement.Remove(a.String()) &&
+					len(placement.Hosts()) == 0
+			}
+			if err := quick.Check(fn, nil); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run(fmt.Sprintf("%s lookup", name), func(t *testing.T) {
+			fn := func(a ASCIISlice, key ASCII) bool {
+				placement := create(t)
+				unique := make(map[string]struct{})
+				for _, v := range a.Slice() {
+					placement.Add(v)
+					unique[v] = struct{}{}
+				}
+
+				got := placement.LookupN(key.String(), 3)
+
+				want := 3
+				if len(unique) < want {
+					want = len(unique)
+				}
+				if len(got) != want {
+					return false
+				}
+
+				seen := make(map[string]struct{})
+				for _, v := range got {
+					if _, ok := unique[v]; !ok {
+						return false
+					}
+					if _, ok := seen[v]; ok {
+						return false
+					}
+					seen[v] = struct{}{}
+				}
+				return reflect.DeepEqual(got, placement.LookupN(key.String(), 3))
+			}
+			if err := quick.Check(fn, nil); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run(fmt.Sprintf("%s checksum", name), func(t *testing.T) {
+			fn := func(a, b ASCII) bool {
+				if a == b {
+					return true
+				}
+
+				placement := create(t)
+				placement.Add(a.String())
+				v0, _ := placement.Checksum()
+				placement.Add(b.String())
+				v1, _ := placement.Checksum()
+
+				return v0 != v1
+			}
+			if err := quick.Check(fn, nil); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run(fmt.Sprintf("%s disruption on add", name), func(t *testing.T) {
+			placement, err := NewPlacement(name, HashMurmur3, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hosts := addresses(10)
+			for _, v := range hosts {
+				placement.Add(v)
+			}
+
+			// The new host doesn't sort last, so placements that number the
+			// hosts by their sorted order would move a lot more keys.
+			const host = "10.0.0.11:8080"
+			before := lookupKeys(placement, 1000)
+			placement.Add(host)
+			after := lookupKeys(placement, 1000)
+
+			var moved int
+			for k, v := range after {
+				if v != before[k] && v != host {
+					moved++
+				}
+			}
+
+			// Keys should only move to the new host, apart from Maglev which
+			// trades a small amount of disruption for balance.
+			var allowed int
+			if name == PlacementMaglev {
+				allowed = len(after) / 20
+			}
+			if expected, actual := allowed, moved; actual > expected {
+				t.Errorf("expected: <= %d, actual: %d", expected, actual)
+			}
+		})
+
+		t.Run(fmt.Sprintf("%s disruption on remove", name), func(t *testing.T) {
+			placement, err := NewPlacement(name, HashMurmur3, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hosts := addresses(10)
+			for _, v := range hosts {
+				placement.Add(v)
+			}
+
+			before := lookupKeys(placement, 1000)
+			placement.Remove(hosts[0])
+			after := lookupKeys(placement, 1000)
+
+			var moved int
+			for k, v := range after {
+				if v != before[k] && before[k] != hosts[0] {
+					moved++
+				}
+			}
+
+			// Keys should only move from the removed host, apart from Maglev
+			// and Jump, which also moves the keys of the host that takes over
+			// the bucket of the removed host.
+			var allowed int
+			switch name {
+			case PlacementMaglev:
+				allowed = len(after) / 20
+			case PlacementJump:
+				allowed = len(after) / 5
+			}
+			if expected, actual := allowed, moved; actual > expected {
+				t.Errorf("expected: <= %d, actual: %d", expected, actual)
+			}
+		})
+	}
+
+	t.Run("unknown placement", func(t *testing.T) {
+		_, err := NewPlacement("bad", HashMurmur3, 10)
+
+		if expected, actual := false, err == nil; expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+	})
+}
+
+func TestJump(t *testing.T) {
+	t.Parallel()
+
+	t.Run("remove fills the bucket with the last host", func(t *testing.T) {
+		jump := NewJump(murmur3.Sum64)
+		for _, v := range []string{"d", "b", "a", "c"} {
+			jump.Add(v)
+		}
+		jump.Remove("b")
+
+		if expected, actual := []string{"d", "c", "a"}, jump.Hosts(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("remove only moves keys of the removed and last host", func(t *testing.T) {
+		jump := NewJump(murmur3.Sum64)
+		hosts := addresses(10)
+		for _, v := range hosts {
+			jump.Add(v)
+		}
+
+		before := lookupKeys(jump, 1000)
+		jump.Remove(hosts[3])
+		after := lookupKeys(jump, 1000)
+
+		for k, v := range after {
+			if v == before[k] {
+				continue
+			}
+			if from := before[k]; from != hosts[3] && from != hosts[len(hosts)-1] {
+				t.Errorf("expected: %s to stay on %s, actual: %s", k, from, v)
+			}
+		}
+	})
+
+	t.Run("order of hosts", func(t *testing.T) {
+		fn := func(a ASCIISlice, key ASCII) bool {
+			var (
+				hosts  = a.Slice()
+				first  = NewJump(murmur3.Sum64)
+				second = NewJump(murmur3.Sum64)
+			)
+			for _, v := range hosts {
+				first.Add(v)
+				second.Add(v)
+			}
+
+			x, _ := first.Checksum()
+			y, _ := second.Checksum()
+			return x == y &&
+				reflect.DeepEqual(first.LookupN(key.String(), 3), second.LookupN(key.String(), 3))
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("different order of hosts", func(t *testing.T) {
+		var (
+			forward  = NewJump(murmur3.Sum64)
+			backward = NewJump(murmur3.Sum64)
+			hosts    = addresses(3)
+		)
+		for k := range hosts {
+			forward.Add(hosts[k])
+			backward.Add(hosts[len(hosts)-1-k])
+		}
+
+		x, _ := forward.Checksum()
+		y, _ := backward.Checksum()
+		if x == y {
+			t.Errorf("expected: different checksums, actual: %d", x)
+		}
+	})
+
+	t.Run("jump hash range", func(t *testing.T) {
+		fn := func(key uint64, buckets uint8) bool {
+			n := int(buckets) + 1
+			b := jumpHash(key, n)
+			return b >= 0 && b < n
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestMaglev(t *testing.T) {
+	t.Parallel()
+
+	t.Run("balance", func(t *testing.T) {
+		maglev := NewMaglev(murmur3.Sum64, DefaultMaglevTableSize)
+		for i := 0; i < 10; i++ {
+			maglev.Add(fmt.Sprintf("host-%d", i))
+		}
+
+		entries := make(map[int]int)
+		for _, v := range maglev.table {
+			entries[v]++
+		}
+
+		// Each host fills the table in turn, so they can only differ by one.
+		var counts []int
+		for _, v := range entries {
+			counts = append(counts, v)
+		}
+		sort.Ints(counts)
+		if expected, actual := 1, counts[len(counts)-1]-counts[0]; actual > expected {
+			t.Errorf("expected: <= %d, actual: %d", expected, actual)
+		}
+	})
+
+	for _, hash := range Hashes() {
+		hash := hash
+
+		t.Run(fmt.Sprintf("disruption on add with %s", hash), func(t *testing.T) {
+			hashFn, err := NewHash(hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			maglev := NewMaglev(hashFn, DefaultMaglevTableSize)
+			for _, v := range addresses(10) {
+				maglev.Add(v)
+			}
+
+			// A hash without entropy in the lower bits gives every host the
+			// same permutation, which moves a lot more keys.
+			before := lookupKeys(maglev, 1000)
+			maglev.Add("10.0.0.11:8080")
+			after := lookupKeys(maglev, 1000)
+
+			var moved int
+			for k, v := range after {
+				if v != before[k] && v != "10.0.0.11:8080" {
+					moved++
+				}
+			}
+			if expected, actual := len(after)/20, moved; actual > expected {
+				t.Errorf("expected: <= %d, actual: %d", expected, actual)
+			}
+		})
+	}
+}
+
+// addresses returns n addresses in the order they join, which isn't their
+// sorted order.
+func addresses(n int) []string {
+	res := make([]string, n)
+	for k := range res {
+		res[k] = fmt.Sprintf("10.0.0.%d:8080", n-k)
+	}
+	return res
+}
+
+func lookupKeys(placement Placement, n int) map[string]string {
+	res := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if hosts := placement.LookupN(key, 1); len(hosts) > 0 {
+			res[key] = hosts[0]
+		}
+	}
+	return res
+}
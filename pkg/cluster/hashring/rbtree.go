@@ -2,6 +2,7 @@ package hashring
 
 import (
 	"bytes"
+	"cmp"
 	"fmt"
 	"io"
 	"strings"
@@ -28,39 +29,105 @@ func (n NodeType) String() string {
 }
 
 const (
-	// Red represents a red type of the RBTree
+	// Red represents a red type of the Tree
 	Red NodeType = iota
 
-	// Black represents a black type of the RBTree
+	// Black represents a black type of the Tree
 	Black
 )
 
-// RBTree implements a non-thread safe fixed size Red, Black tree
-type RBTree struct {
-	root *RBNode
-	size int
+// Tree implements a non-thread safe fixed size Red, Black tree, which orders
+// the keys using a comparator. Many keys can share a value, so the values are
+// told apart by their identity when looking up unique values.
+type Tree[K any, V any] struct {
+	root     *Node[K, V]
+	size     int
+	compare  func(K, K) int
+	identity func(V) any
 }
 
+// NewTree creates a new Tree that orders the keys using the comparator. The
+// comparator returns a negative number when a is less than b, a positive
+// number when a is greater than b and zero when they're equal. The values are
+// their own identity.
+// It panics if the comparator is nil.
+func NewTree[K any, V comparable](compare func(a, b K) int) *Tree[K, V] {
+	return NewTreeFunc[K, V](compare, nil)
+}
+
+// NewTreeFunc creates a new Tree that orders the keys using the comparator,
+// see NewTree, and tells the values apart using the identity, which has to
+// return a comparable value. Values that can't be compared, such as slices,
+// can be stored in a Tree this way.
+// It panics if the comparator is nil.
+func NewTreeFunc[K any, V any](compare func(a, b K) int, identity func(V) any) *Tree[K, V] {
+	if compare == nil {
+		panic("hashring: tree requires a comparator")
+	}
+	return &Tree[K, V]{
+		compare:  compare,
+		identity: identity,
+	}
+}
+
+// RBTree is a Tree of hashes to hosts, which is what the HashRing uses.
+type RBTree = Tree[uint64, string]
+
+// RBNode is a node of a RBTree.
+type RBNode = Node[uint64, string]
+
 // NewRBTree creates a new RBTree
 func NewRBTree() *RBTree {
-	return &RBTree{}
+	return NewTree[uint64, string](cmp.Compare[uint64])
+}
+
+// compareKeys compares the keys using the comparator of the tree. A tree
+// without a comparator, which is only ever the zero value, orders the keys of
+// the basic types in their natural order.
+func (t *Tree[K, V]) compareKeys(a, b K) int {
+	if t.compare != nil {
+		return t.compare(a, b)
+	}
+
+	switch x := any(a).(type) {
+	case uint64:
+		return cmp.Compare(x, any(b).(uint64))
+	case uint32:
+		return cmp.Compare(x, any(b).(uint32))
+	case int:
+		return cmp.Compare(x, any(b).(int))
+	case int64:
+		return cmp.Compare(x, any(b).(int64))
+	case string:
+		return cmp.Compare(x, any(b).(string))
+	}
+	panic(fmt.Sprintf("no comparator for keys of type %T", a))
+}
+
+// id returns the identity of the value. A tree without an identity, such as
+// the zero value, uses the value itself.
+func (t *Tree[K, V]) id(v V) any {
+	if t.identity != nil {
+		return t.identity(v)
+	}
+	return v
 }
 
 // Root returns the root node within the tree
-func (t *RBTree) Root() *RBNode {
+func (t *Tree[K, V]) Root() *Node[K, V] {
 	return t.root
 }
 
 // Size returns the number of nodes
-func (t *RBTree) Size() int {
+func (t *Tree[K, V]) Size() int {
 	return t.size
 }
 
-// Insert inserts a value and string into the tree
+// Insert inserts a key and value into the tree
 // Returns true on insertion and false if a duplicate exists
-func (t *RBTree) Insert(key int, value string) bool {
+func (t *Tree[K, V]) Insert(key K, value V) bool {
 	if t.root == nil {
-		t.root = &RBNode{
+		t.root = &Node[K, V]{
 			key:      key,
 			value:    value,
 			nodeType: Black,
@@ -71,9 +138,9 @@ func (t *RBTree) Insert(key int, value string) bool {
 
 	var (
 		insertion           bool
-		parent, grandParent *RBNode
+		parent, grandParent *Node[K, V]
 
-		head            = &RBNode{}
+		head            = &Node[K, V]{}
 		root            = head
 		node            = t.root
 		direction, last = true, true
@@ -83,7 +150,7 @@ func (t *RBTree) Insert(key int, value string) bool {
 
 	for {
 		if node == nil {
-			node = &RBNode{
+			node = &Node[K, V]{
 				key:      key,
 				value:    value,
 				nodeType: Red,
@@ -104,7 +171,7 @@ func (t *RBTree) Insert(key int, value string) bool {
 			}
 		}
 
-		comparator := node.key - key
+		comparator := t.compareKeys(node.key, key)
 
 		if comparator == 0 {
 			break
@@ -134,18 +201,18 @@ func (t *RBTree) Insert(key int, value string) bool {
 
 // Delete removes the entry for key from the redBlackTree. Returns true on
 // successful deletion, false if the key is not in tree
-func (t *RBTree) Delete(key int) bool {
+func (t *Tree[K, V]) Delete(key K) bool {
 	if t.root == nil {
 		return false
 	}
 
 	var (
-		head = &RBNode{
+		head = &Node[K, V]{
 			nodeType: Red,
 		}
 
-		parent, grandParent *RBNode
-		found               *RBNode
+		parent, grandParent *Node[K, V]
+		found               *Node[K, V]
 
 		node      = head
 		direction = true
@@ -165,7 +232,7 @@ func (t *RBTree) Delete(key int) bool {
 		parent = node
 		node = child
 
-		comparator := node.key - key
+		comparator := t.compareKeys(node.key, key)
 		if comparator == 0 {
 			found = node
 		}
@@ -214,40 +281,66 @@ func (t *RBTree) Delete(key int) bool {
 }
 
 // LookupNUniqueAt iterates through the tree from the last node that is smaller
-// than key or equal, and returns the next n unique values.
-func (t *RBTree) LookupNUniqueAt(n int, key int) []string {
+// than key or equal, and returns the next n values with a unique identity.
+func (t *Tree[K, V]) LookupNUniqueAt(n int, key K) []V {
 	var (
-		res    = make([]string, 0, n)
-		unique = make(map[string]struct{})
+		res    = make([]V, 0, n)
+		unique = make(map[any]struct{})
 	)
-	find(t.root, n, key, unique, &res)
+	t.find(t.root, n, &key, unique, &res)
 	if len(res) < n {
-		find(t.root, n, 0, unique, &res)
+		t.find(t.root, n, nil, unique, &res)
 	}
 	return res
 }
 
-// Search searches for a value in the redBlackTree, returns the string and true
-// if found or the empty string and false if val is not in the tree.
-func (t *RBTree) Search(key int) (string, bool) {
-	if t.root == nil {
-		return "", false
+// Search searches for a value in the redBlackTree, returns the value and true
+// if found or the zero value and false if val is not in the tree.
+func (t *Tree[K, V]) Search(key K) (V, bool) {
+	if n, ok := t.node(key); ok {
+		return n.value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// node returns the node with the key, if there is one.
+func (t *Tree[K, V]) node(key K) (*Node[K, V], bool) {
+	for n := t.root; n != nil; {
+		comparator := t.compareKeys(key, n.key)
+		switch {
+		case comparator == 0:
+			return n, true
+		case comparator < 0:
+			n = n.left
+		default:
+			n = n.right
+		}
 	}
-	return t.root.search(key)
+	return nil, false
 }
 
 // Walk over the tree in a deterministic manor, walking over the left and then
 // the right nodes.
 // If an error is returned whilst walking the nodes, it will stop walking
 // immediately and return that error.
-func (t *RBTree) Walk(fn func(*RBNode) error) error {
+func (t *Tree[K, V]) Walk(fn func(*Node[K, V]) error) error {
 	if t.root == nil {
 		return nil
 	}
 	return t.root.walk(fn)
 }
 
-func (t *RBTree) String() string {
+func (t *Tree[K, V]) clone() *Tree[K, V] {
+	return &Tree[K, V]{
+		root:     t.root.clone(),
+		size:     t.size,
+		compare:  t.compare,
+		identity: t.identity,
+	}
+}
+
+func (t *Tree[K, V]) String() string {
 	if t.root == nil {
 		return ""
 	}
@@ -257,7 +350,7 @@ func (t *RBTree) String() string {
 	return b.String()
 }
 
-func (t *RBTree) string(node *RBNode, level int, buf io.Writer) {
+func (t *Tree[K, V]) string(node *Node[K, V], level int, buf io.Writer) {
 	var joint string
 	if node.left == nil && node.right == nil {
 		joint = "└"
@@ -265,7 +358,7 @@ func (t *RBTree) string(node *RBNode, level int, buf io.Writer) {
 		joint = "└"
 	}
 
-	line := fmt.Sprintf("%s── <%s> %s\n", joint, node.nodeType.String(), node.value)
+	line := fmt.Sprintf("%s── <%s> %v\n", joint, node.nodeType.String(), node.value)
 	if _, err := buf.Write([]byte(line)); err != nil {
 		panic(err)
 	}
@@ -286,22 +379,22 @@ func (t *RBTree) string(node *RBNode, level int, buf io.Writer) {
 	}
 }
 
-// RBNode is a RBTree node
-type RBNode struct {
-	key         int
-	value       string
-	left, right *RBNode
+// Node is a Tree node
+type Node[K any, V any] struct {
+	key         K
+	value       V
+	left, right *Node[K, V]
 	nodeType    NodeType
 }
 
-func (n *RBNode) child(right bool) *RBNode {
+func (n *Node[K, V]) child(right bool) *Node[K, V] {
 	if right {
 		return n.right
 	}
 	return n.left
 }
 
-func (n *RBNode) setChild(right bool, node *RBNode) {
+func (n *Node[K, V]) setChild(right bool, node *Node[K, V]) {
 	if right {
 		n.right = node
 	} else {
@@ -309,22 +402,20 @@ func (n *RBNode) setChild(right bool, node *RBNode) {
 	}
 }
 
-func (n *RBNode) search(key int) (string, bool) {
-	if n.key == key {
-		return n.value, true
-	} else if key < n.key {
-		if n.left != nil {
-			return n.left.search(key)
-		}
-	} else {
-		if n.right != nil {
-			return n.right.search(key)
-		}
+func (n *Node[K, V]) clone() *Node[K, V] {
+	if n == nil {
+		return nil
+	}
+	return &Node[K, V]{
+		key:      n.key,
+		value:    n.value,
+		left:     n.left.clone(),
+		right:    n.right.clone(),
+		nodeType: n.nodeType,
 	}
-	return "", false
 }
 
-func (n *RBNode) walk(fn func(*RBNode) error) error {
+func (n *Node[K, V]) walk(fn func(*Node[K, V]) error) error {
 	if err := fn(n); err != nil {
 		return err
 	}
@@ -342,35 +433,38 @@ func (n *RBNode) walk(fn func(*RBNode) error) error {
 	return nil
 }
 
-func find(node *RBNode, n int, key int, m map[string]struct{}, s *[]string) {
+// find the next n unique values from the key, or from the start of the tree
+// if there is no key.
+func (t *Tree[K, V]) find(node *Node[K, V], n int, key *K, m map[any]struct{}, s *[]V) {
 	if len(m) >= n || node == nil {
 		return
 	}
 
-	comparator := node.key - key
-	if comparator >= 0 {
-		find(node.left, n, key, m, s)
+	after := key == nil || t.compareKeys(node.key, *key) >= 0
+	if after {
+		t.find(node.left, n, key, m, s)
 	}
 
 	if len(m) >= n {
 		return
 	}
 
-	if comparator >= 0 {
-		if _, ok := m[node.value]; !ok {
+	if after {
+		id := t.id(node.value)
+		if _, ok := m[id]; !ok {
 			*s = append(*s, node.value)
 		}
-		m[node.value] = struct{}{}
+		m[id] = struct{}{}
 	}
 
-	find(node.right, n, key, m, s)
+	t.find(node.right, n, key, m, s)
 }
 
-func isRed(n *RBNode) bool {
+func isRed[K any, V any](n *Node[K, V]) bool {
 	return n != nil && n.nodeType.IsRed()
 }
 
-func singleRotate(node *RBNode, dir bool) *RBNode {
+func singleRotate[K any, V any](node *Node[K, V], dir bool) *Node[K, V] {
 	root := node.child(!dir)
 
 	node.setChild(!dir, root.child(dir))
@@ -382,7 +476,7 @@ func singleRotate(node *RBNode, dir bool) *RBNode {
 	return root
 }
 
-func doubleRotate(node *RBNode, dir bool) *RBNode {
+func doubleRotate[K any, V any](node *Node[K, V], dir bool) *Node[K, V] {
 	node.setChild(!dir, singleRotate(node.child(!dir), !dir))
 	return singleRotate(node, dir)
 }
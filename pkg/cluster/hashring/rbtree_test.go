@@ -1,8 +1,11 @@
 package hashring
 
 import (
+	"cmp"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"testing/quick"
 
@@ -70,7 +73,7 @@ func TestInsert(t *testing.T) {
 			}
 
 			for i := 1; i <= 10; i++ {
-				if ok := tree.Insert(amount+i, fmt.Sprintf("%d", amount+1)); !ok {
+				if ok := tree.Insert(uint64(amount+i), fmt.Sprintf("%d", amount+1)); !ok {
 					t.Errorf("expected: %t, actual: %t", true, ok)
 				}
 
@@ -530,11 +533,104 @@ func TestSearch(t *testing.T) {
 	})
 }
 
+func TestGenericTree(t *testing.T) {
+	t.Parallel()
+
+	type vnode struct {
+		host   string
+		weight int
+	}
+
+	t.Run("comparator", func(t *testing.T) {
+		fn := func(a []string) bool {
+			tree := NewTree[string, *vnode](func(a, b string) int {
+				return strings.Compare(b, a)
+			})
+
+			var want []string
+			for k, v := range a {
+				if tree.Insert(v, &vnode{v, k}) {
+					want = append(want, v)
+				}
+			}
+			sort.Sort(sort.Reverse(sort.StringSlice(want)))
+
+			var got []string
+			tree.walkInOrder(func(n *Node[string, *vnode]) {
+				if n.key == n.value.host {
+					got = append(got, n.key)
+				}
+			})
+			return tree.Size() == len(want) && reflect.DeepEqual(want, got)
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("search", func(t *testing.T) {
+		tree := NewTree[string, *vnode](strings.Compare)
+		tree.Insert("a", &vnode{"a", 1})
+		tree.Insert("b", &vnode{"b", 2})
+
+		value, ok := tree.Search("b")
+		if expected, actual := true, ok; expected != actual {
+			t.Fatalf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 2, value.weight; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		value, ok = tree.Search("c")
+		if expected, actual := false, ok || value != nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("identity", func(t *testing.T) {
+		tree := NewTreeFunc[uint64, []string](cmp.Compare[uint64], func(v []string) any {
+			return v[0]
+		})
+		tree.Insert(1, []string{"a", "1"})
+		tree.Insert(2, []string{"b", "2"})
+		tree.Insert(3, []string{"a", "3"})
+		tree.Insert(4, []string{"c", "4"})
+
+		if expected, actual := [][]string{{"a", "1"}, {"b", "2"}, {"c", "4"}}, tree.LookupNUniqueAt(3, 0); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("nil comparator", func(t *testing.T) {
+		defer func() {
+			if expected, actual := true, recover() != nil; expected != actual {
+				t.Errorf("expected: %t, actual: %t", expected, actual)
+			}
+		}()
+		NewTree[*vnode, string](nil)
+	})
+
+	t.Run("zero value", func(t *testing.T) {
+		var tree RBTree
+		for _, v := range []uint64{5, 3, 8, 1} {
+			tree.Insert(v, fmt.Sprintf("%d", v))
+		}
+
+		err := verifyTreeStructure(tree.Root())
+		if expected, actual := true, err == nil; expected != actual {
+			t.Errorf("expected: %v, actual: %v, err: %v", expected, actual, err)
+		}
+		if expected, actual := []string{"3", "5", "8"}, tree.LookupNUniqueAt(3, 2); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
 func makeTreeWithAmount(amount int) *RBTree {
 	tree := NewRBTree()
 
 	for i := 1; i <= amount; i++ {
-		tree.Insert(i, fmt.Sprintf("%d", i))
+		tree.Insert(uint64(i), fmt.Sprintf("%d", i))
 	}
 
 	return tree
@@ -601,7 +697,7 @@ func verifyTree(tree *RBTree, height, size int) error {
 	return nil
 }
 
-func verifyNode(node *RBNode, key int, nodeType NodeType, presence Presence) error {
+func verifyNode(node *RBNode, key uint64, nodeType NodeType, presence Presence) error {
 	if expected, actual := key, node.key; expected != actual {
 		return errors.Errorf("node key - expected: %v, actual: %v", expected, actual)
 	}
@@ -636,8 +732,8 @@ func verifyTreeStructure(n *RBNode) error {
 		return err
 	}
 
-	if n.left != nil && n.left.key-n.key >= 0 ||
-		n.right != nil && n.right.key-n.key <= 0 {
+	if n.left != nil && n.left.key >= n.key ||
+		n.right != nil && n.right.key <= n.key {
 		return errors.Errorf("binary tree violation with key %v", n.key)
 	}
 	return nil
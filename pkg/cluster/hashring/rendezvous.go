@@ -0,0 +1,101 @@
+package hashring
+
+import (
+	"sort"
+	"sync"
+)
+
+// Rendezvous places keys using rendezvous (highest random weight) hashing.
+// Every host is scored against the key and the hosts with the highest scores
+// own the key, so only the keys of a removed host ever move. A lookup is
+// O(N) in the number of hosts.
+type Rendezvous struct {
+	mtx    sync.RWMutex
+	hashFn func([]byte) uint64
+	hosts  map[string]struct{}
+}
+
+// NewRendezvous creates a new Rendezvous placement
+func NewRendezvous(hashFn func([]byte) uint64) *Rendezvous {
+	return &Rendezvous{
+		hashFn: hashFn,
+		hosts:  make(map[string]struct{}),
+	}
+}
+
+// Add a host to the placement.
+// Returns true if the host was added.
+func (r *Rendezvous) Add(host string) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if _, ok := r.hosts[host]; ok {
+		return false
+	}
+	r.hosts[host] = struct{}{}
+	return true
+}
+
+// Remove a host from the placement.
+// Returns true if the host was removed.
+func (r *Rendezvous) Remove(host string) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if _, ok := r.hosts[host]; !ok {
+		return false
+	}
+	delete(r.hosts, host)
+	return true
+}
+
+// LookupN returns the N hosts with the highest score for the given key. If
+// there are less hosts than N, all the hosts are returned.
+func (r *Rendezvous) LookupN(key string, n int) []string {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	type score struct {
+		host  string
+		score uint64
+	}
+
+	scores := make([]score, 0, len(r.hosts))
+	for host := range r.hosts {
+		scores = append(scores, score{
+			host:  host,
+			score: r.hashFn([]byte(host + key)),
+		})
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].score == scores[j].score {
+			return scores[i].host < scores[j].host
+		}
+		return scores[i].score > scores[j].score
+	})
+
+	if n > len(scores) {
+		n = len(scores)
+	}
+	res := make([]string, n)
+	for k := range res {
+		res[k] = scores[k].host
+	}
+	return res
+}
+
+// Hosts returns the hosts in a slice.
+func (r *Rendezvous) Hosts() []string {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return sortedHosts(r.hosts)
+}
+
+// Checksum the placement to verify if there have been any changes
+func (r *Rendezvous) Checksum() (uint32, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return checksumHosts(r.hashFn, sortedHosts(r.hosts)), nil
+}
@@ -0,0 +1,87 @@
+package hashring
+
+// Snapshot is an immutable view of a HashRing at a point in time. Lookups
+// against a Snapshot never block, so it can be shared between goroutines and
+// used to do many lookups against a consistent view of the ring. The loads of
+// the hosts are the exception, they're shared with the HashRing so that a
+// change of load doesn't have to publish a new Snapshot.
+type Snapshot struct {
+	hashFn      hashFn
+	tree        *hostTree
+	hosts       map[string]*host
+	bounded     bool
+	epsilon     float64
+	totalLoad   *load
+	totalWeight int
+}
+
+// Snapshot returns the latest Snapshot of the HashRing. Changes to the
+// HashRing are built off to the side and then published as a new Snapshot,
+// so the returned Snapshot never changes.
+func (r *HashRing) Snapshot() *Snapshot {
+	return r.snapshot.Load().(*Snapshot)
+}
+
+// publish a new Snapshot of the HashRing, it should be called whilst holding
+// the write lock after every change to the hosts, a change of load is seen by
+// the Snapshot without publishing. The tree is only copied when it has
+// changed, otherwise the tree of the previous Snapshot is shared.
+func (r *HashRing) publish(treeChanged bool) {
+	s := &Snapshot{
+		hashFn:    r.hashFn,
+		hosts:     make(map[string]*host, len(r.hosts)),
+		bounded:   r.bounded,
+		epsilon:   r.epsilon,
+		totalLoad: r.totalLoad,
+	}
+	if prev, ok := r.snapshot.Load().(*Snapshot); ok && !treeChanged {
+		s.tree = prev.tree
+	} else {
+		s.tree = r.tree.clone()
+	}
+	for k, v := range r.hosts {
+		s.hosts[k] = v
+		s.totalWeight += v.weight
+	}
+	r.snapshot.Store(s)
+}
+
+// Lookup returns the owner of the given key and whether the Snapshot contains
+// the key at all.
+func (s *Snapshot) Lookup(key string) (string, bool) {
+	if res := s.LookupN(key, 1); len(res) > 0 {
+		return res[0], true
+	}
+	return "", false
+}
+
+// LookupN returns the N servers that own the given key, see
+// HashRing.LookupN.
+func (s *Snapshot) LookupN(key string, n int) []string {
+	if s.bounded {
+		return s.lookupNBounded(key, n)
+	}
+	return names(s.tree.LookupNUniqueAt(n, s.hashFn(key)))
+}
+
+// Hosts returns the hosts in a slice.
+func (s *Snapshot) Hosts() []string {
+	res := make([]string, 0, len(s.hosts))
+	for k := range s.hosts {
+		res = append(res, k)
+	}
+	return res
+}
+
+// Len returns the number of unique hosts
+func (s *Snapshot) Len() int {
+	return len(s.hosts)
+}
+
+// Tags returns the tags of a host.
+func (s *Snapshot) Tags(host string) map[string]string {
+	if h, ok := s.hosts[host]; ok {
+		return h.tags
+	}
+	return nil
+}
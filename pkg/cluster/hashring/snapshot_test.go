@@ -0,0 +1,120 @@
+package hashring
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/quick"
+
+	"github.com/spaolacci/murmur3"
+)
+
+func TestHashRingSnapshot(t *testing.T) {
+	t.Parallel()
+
+	t.Run("lookup", func(t *testing.T) {
+		fn := func(a ASCIISlice, key ASCII) bool {
+			ring := New(murmur3.Sum64, 10)
+			for _, v := range a.Slice() {
+				ring.Add(v)
+			}
+
+			snapshot := ring.Snapshot()
+			return reflect.DeepEqual(ring.LookupN(key.String(), 3), snapshot.LookupN(key.String(), 3))
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("immutable", func(t *testing.T) {
+		fn := func(a ASCIISlice, b ASCII, key ASCII) bool {
+			ring := New(murmur3.Sum64, 10)
+			for _, v := range a.Slice() {
+				ring.Add(v)
+			}
+
+			var (
+				snapshot = ring.Snapshot()
+				want     = snapshot.LookupN(key.String(), 3)
+			)
+			ring.Add(b.String())
+			for _, v := range a.Slice() {
+				ring.Remove(v)
+			}
+
+			return snapshot.Len() == len(a.Slice()) &&
+				reflect.DeepEqual(want, snapshot.LookupN(key.String(), 3))
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("replaced hosts", func(t *testing.T) {
+		ring := NewBoundedLoad(murmur3.Sum64, 10, 0)
+		ring.Add("a")
+		ring.Add("b")
+		ring.SetTags("a", map[string]string{"zone": "eu"})
+
+		snapshot := ring.Snapshot()
+		ring.Update("a", 3)
+		ring.SetTags("a", map[string]string{"zone": "us"})
+
+		if expected, actual := "eu", snapshot.Tags("a")["zone"]; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := "us", ring.Tags("a")["zone"]; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		// The load of the host is kept when the host is replaced.
+		ring.SetLoad("a", 4)
+		if expected, actual := 1.0, ring.MaxLoad(); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 2.0, snapshot.MaxLoad(); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("bounded loads are shared", func(t *testing.T) {
+		ring := NewBoundedLoad(murmur3.Sum64, 10, 0.25)
+		ring.Add("a")
+		ring.Add("b")
+
+		snapshot := ring.Snapshot()
+		ring.SetLoad("a", 10)
+
+		if expected, actual := snapshot, ring.Snapshot(); expected != actual {
+			t.Errorf("expected: %p, actual: %p", expected, actual)
+		}
+		if expected, actual := 6.25, snapshot.MaxLoad(); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		var (
+			ring = New(murmur3.Sum64, 10)
+			wg   sync.WaitGroup
+		)
+		ring.Add("host")
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				ring.Add(fmt.Sprintf("host-%d", i))
+			}
+		}()
+
+		for i := 0; i < 1000; i++ {
+			if expected, actual := 1, len(ring.LookupN(fmt.Sprintf("key-%d", i), 1)); expected != actual {
+				t.Fatalf("expected: %d, actual: %d", expected, actual)
+			}
+		}
+		wg.Wait()
+	})
+}
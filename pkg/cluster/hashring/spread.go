@@ -0,0 +1,69 @@
+package hashring
+
+// SetTags sets the tags of a host, which are used to spread the hosts
+// returned by LookupNSpread.
+// Returns false if the host isn't in the ring.
+func (r *HashRing) SetTags(name string, tags map[string]string) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	current, ok := r.hosts[name]
+	if !ok {
+		return false
+	}
+	r.replace(current, func(h *host) {
+		h.tags = tags
+	})
+
+	r.publish(true)
+
+	return true
+}
+
+// Tags returns the tags of a host.
+func (r *HashRing) Tags(host string) map[string]string {
+	return r.Snapshot().Tags(host)
+}
+
+// LookupNSpread returns the N servers that own the given key, much like
+// LookupN, but spreads the servers across the values of a tag, so that the
+// servers are in distinct zones or racks for example. The ring is walked from
+// the key choosing a server for each value of the tag that hasn't been seen,
+// before repeating values in the order of the ring. If there are less values
+// than N, the servers are still returned, they just share values. Servers
+// without the tag all share the empty value.
+func (r *HashRing) LookupNSpread(key string, n int, tagKey string) []string {
+	return r.Snapshot().LookupNSpread(key, n, tagKey)
+}
+
+// LookupNSpread returns the N servers that own the given key, spread across
+// the values of a tag, see HashRing.LookupNSpread.
+func (s *Snapshot) LookupNSpread(key string, n int, tagKey string) []string {
+	var (
+		hosts = s.tree.LookupNUniqueAt(len(s.hosts), s.hashFn(key))
+		seen  = make(map[string]struct{})
+
+		res     = make([]string, 0, n)
+		skipped []string
+	)
+	for _, host := range hosts {
+		if len(res) >= n {
+			return res
+		}
+
+		value := host.tags[tagKey]
+		if _, ok := seen[value]; ok {
+			skipped = append(skipped, host.name)
+			continue
+		}
+		seen[value] = struct{}{}
+		res = append(res, host.name)
+	}
+	for _, host := range skipped {
+		if len(res) >= n {
+			break
+		}
+		res = append(res, host)
+	}
+	return res
+}
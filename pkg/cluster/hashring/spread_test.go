@@ -0,0 +1,87 @@
+package hashring
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/spaolacci/murmur3"
+)
+
+func TestHashRingLookupNSpread(t *testing.T) {
+	t.Parallel()
+
+	zones := func(numHosts, numZones int) *HashRing {
+		ring := New(murmur3.Sum64, 10)
+		for i := 0; i < numHosts; i++ {
+			host := fmt.Sprintf("host-%d", i)
+			ring.Add(host)
+			ring.SetTags(host, map[string]string{
+				"zone": fmt.Sprintf("zone-%d", i%numZones),
+			})
+		}
+		return ring
+	}
+
+	t.Run("distinct zones", func(t *testing.T) {
+		fn := func(key ASCII) bool {
+			ring := zones(9, 3)
+
+			unique := make(map[string]struct{})
+			for _, v := range ring.LookupNSpread(key.String(), 3, "zone") {
+				unique[ring.Tags(v)["zone"]] = struct{}{}
+			}
+			return len(unique) == 3
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("fewer zones than n", func(t *testing.T) {
+		fn := func(key ASCII) bool {
+			ring := zones(6, 2)
+
+			var (
+				got    = ring.LookupNSpread(key.String(), 4, "zone")
+				unique = make(map[string]struct{})
+			)
+			for _, v := range got {
+				unique[v] = struct{}{}
+			}
+
+			// The first two hosts should always be in different zones.
+			return len(got) == 4 &&
+				len(unique) == 4 &&
+				ring.Tags(got[0])["zone"] != ring.Tags(got[1])["zone"]
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("without tags", func(t *testing.T) {
+		fn := func(a ASCIISlice, key ASCII) bool {
+			ring := New(murmur3.Sum64, 10)
+			for _, v := range a.Slice() {
+				ring.Add(v)
+			}
+
+			// Every host shares the same empty value, so the order of the
+			// ring is kept.
+			return reflect.DeepEqual(ring.LookupN(key.String(), 3), ring.LookupNSpread(key.String(), 3, "zone"))
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("set tags of missing host", func(t *testing.T) {
+		ring := New(murmur3.Sum64, 10)
+
+		if expected, actual := false, ring.SetTags("a", nil); expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+	})
+}
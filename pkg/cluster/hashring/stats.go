@@ -0,0 +1,114 @@
+package hashring
+
+import (
+	"math"
+)
+
+// keyspace is the number of hashes on the ring.
+const keyspace = float64(math.MaxUint64) + 1
+
+// HostRanges describes the ranges of hashes that a host owns on the ring.
+type HostRanges struct {
+	Ranges []Range
+
+	// Ownership is the fraction of the keyspace that is owned.
+	Ownership float64
+}
+
+// Stats describes how balanced the ownership of the ring is between the
+// hosts.
+type Stats struct {
+	Hosts  int
+	Points int
+
+	// Collisions is the number of points that had to be rehashed.
+	Collisions int
+
+	// Ownership is the fraction of the keyspace that each host owns.
+	Ownership map[string]float64
+
+	Mean        float64
+	StdDev      float64
+	Max         float64
+	MaxOverMean float64
+}
+
+// Ranges returns the ranges of hashes that each host owns, in the order of
+// the ring.
+func (r *HashRing) Ranges() map[string]HostRanges {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	res := make(map[string]HostRanges, len(r.hosts))
+
+	nodes := r.sortedNodes()
+	if len(nodes) == 0 {
+		return res
+	}
+
+	add := func(host string, start, end uint64) {
+		h := res[host]
+		h.Ranges = append(h.Ranges, Range{
+			Start: start,
+			End:   end,
+		})
+		h.Ownership += (float64(end-start) + 1) / keyspace
+		res[host] = h
+	}
+
+	var start uint64
+	for _, v := range nodes {
+		add(v.value.name, start, v.key)
+		start = v.key + 1
+	}
+
+	// The hashes after the last node wrap around to the first node.
+	if last := nodes[len(nodes)-1]; last.key < math.MaxUint64 {
+		add(nodes[0].value.name, last.key+1, math.MaxUint64)
+	}
+	return res
+}
+
+// Stats returns the statistics of how balanced the ownership of the ring is.
+func (r *HashRing) Stats() Stats {
+	ranges := r.Ranges()
+
+	r.mtx.RLock()
+	stats := Stats{
+		Hosts:      len(r.hosts),
+		Points:     r.tree.Size(),
+		Collisions: r.collisions(),
+		Ownership:  make(map[string]float64, len(ranges)),
+	}
+	r.mtx.RUnlock()
+
+	if len(ranges) == 0 {
+		return stats
+	}
+
+	for k, v := range ranges {
+		stats.Ownership[k] = v.Ownership
+		stats.Max = math.Max(stats.Max, v.Ownership)
+	}
+
+	// Every host owns part of the ring, so the mean is always the same.
+	stats.Mean = 1 / float64(len(ranges))
+	stats.MaxOverMean = stats.Max / stats.Mean
+
+	var variance float64
+	for _, v := range ranges {
+		variance += math.Pow(v.Ownership-stats.Mean, 2)
+	}
+	stats.StdDev = math.Sqrt(variance / float64(len(ranges)))
+
+	return stats
+}
+
+// sortedNodes returns the nodes of the tree in the order of the hashes.
+func (r *HashRing) sortedNodes() []*Node[uint64, *host] {
+	nodes := make([]*Node[uint64, *host], 0, r.tree.Size())
+	r.tree.walkInOrder(func(n *Node[uint64, *host]) {
+		nodes = append(nodes, n)
+	})
+	return nodes
+}
@@ -0,0 +1,113 @@
+package hashring
+
+import (
+	"math"
+	"testing"
+	"testing/quick"
+
+	"github.com/spaolacci/murmur3"
+)
+
+func TestHashRingRanges(t *testing.T) {
+	t.Parallel()
+
+	t.Run("covers keyspace", func(t *testing.T) {
+		fn := func(a ASCIISlice) bool {
+			ring := New(murmur3.Sum64, 10)
+			for _, v := range a.Slice() {
+				ring.Add(v)
+			}
+
+			var (
+				total  float64
+				hashes float64
+			)
+			for _, v := range ring.Ranges() {
+				total += v.Ownership
+				for _, r := range v.Ranges {
+					hashes += float64(r.End) - float64(r.Start) + 1
+				}
+			}
+
+			if len(a) == 0 {
+				return total == 0
+			}
+			return math.Abs(total-1) < 1e-9 && math.Abs(hashes-keyspace)/keyspace < 1e-9
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("owner of ranges", func(t *testing.T) {
+		fn := func(a ASCIISlice, key ASCII) bool {
+			if len(a) == 0 {
+				return true
+			}
+
+			ring := New(murmur3.Sum64, 10)
+			for _, v := range a.Slice() {
+				ring.Add(v)
+			}
+
+			var (
+				owner, _ = ring.Lookup(key.String())
+				hash     = ring.hashFn(key.String())
+			)
+			for host, v := range ring.Ranges() {
+				for _, r := range v.Ranges {
+					if hash >= r.Start && hash <= r.End {
+						return host == owner
+					}
+				}
+			}
+			return false
+		}
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestHashRingStats(t *testing.T) {
+	t.Parallel()
+
+	t.Run("empty", func(t *testing.T) {
+		stats := New(murmur3.Sum64, 10).Stats()
+
+		if expected, actual := 0, stats.Hosts; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("single host", func(t *testing.T) {
+		ring := New(murmur3.Sum64, 10)
+		ring.Add("a")
+		stats := ring.Stats()
+
+		if expected, actual := 1.0, stats.MaxOverMean; math.Abs(expected-actual) > 1e-9 {
+			t.Errorf("expected: %f, actual: %f", expected, actual)
+		}
+		if expected, actual := 10, stats.Points; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("more points are more balanced", func(t *testing.T) {
+		stats := func(vnodes int) Stats {
+			ring := New(murmur3.Sum64, vnodes)
+			for _, v := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+				ring.Add(v)
+			}
+			return ring.Stats()
+		}
+
+		few, many := stats(2), stats(256)
+		if few.StdDev <= many.StdDev {
+			t.Errorf("expected: %f > %f", few.StdDev, many.StdDev)
+		}
+		if many.MaxOverMean < 1 {
+			t.Errorf("expected: %f >= 1", many.MaxOverMean)
+		}
+	})
+}
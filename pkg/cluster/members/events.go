@@ -1,6 +1,11 @@
 package members
 
-import "github.com/hashicorp/serf/serf"
+import (
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+	"github.com/pkg/errors"
+)
 
 // EventType is the potential event type for member event
 type EventType int
@@ -83,19 +88,46 @@ func (UserEvent) Type() EventType {
 }
 
 // QueryEvent is an event that represents when a query from the cluster that
-// needs to be answered.
+// needs to be answered. A QueryEvent can also be dispatched to the cluster, in
+// which case every response to the query is passed to OnResponse.
 type QueryEvent struct {
-	Name    string
-	Payload []byte
-	query   *serf.Query
+	Name     string
+	Payload  []byte
+	deadline time.Time
+	respond  func([]byte) error
+
+	// Nodes restricts a dispatched query to the nodes with the names, every
+	// node is queried without any names.
+	Nodes []string
+
+	// Timeout is how long a dispatched query waits for the responses, the
+	// default of the cluster is used without a timeout.
+	Timeout time.Duration
+
+	// OnResponse is called with the name of the node and the payload of every
+	// response to a dispatched query.
+	OnResponse func(from string, payload []byte)
 }
 
 // NewQueryEvent creates a new QueryEvent with the correct dependencies
 func NewQueryEvent(name string, payload []byte, query *serf.Query) Event {
+	if query == nil {
+		return &QueryEvent{
+			Name:    name,
+			Payload: payload,
+		}
+	}
+	return NewQueryEventFunc(name, payload, query.Deadline(), query.Respond)
+}
+
+// NewQueryEventFunc creates a new QueryEvent that is answered by the respond
+// function, for queries that don't come from serf.
+func NewQueryEventFunc(name string, payload []byte, deadline time.Time, respond func([]byte) error) Event {
 	return &QueryEvent{
-		Name:    name,
-		Payload: payload,
-		query:   query,
+		Name:     name,
+		Payload:  payload,
+		deadline: deadline,
+		respond:  respond,
 	}
 }
 
@@ -104,6 +136,20 @@ func (QueryEvent) Type() EventType {
 	return EventQuery
 }
 
+// Respond answers a query that was received from the cluster.
+func (e *QueryEvent) Respond(payload []byte) error {
+	if e.respond == nil {
+		return errors.Errorf("query %q wasn't received from the cluster", e.Name)
+	}
+	return e.respond(payload)
+}
+
+// Deadline returns the time by which a query that was received from the
+// cluster has to be answered. The zero time means there's no deadline.
+func (e *QueryEvent) Deadline() time.Time {
+	return e.deadline
+}
+
 // ErrorEvent is an event that represents when an error comes from the cluster
 type ErrorEvent struct {
 	Error error
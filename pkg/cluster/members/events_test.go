@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"testing"
 	"testing/quick"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -82,6 +83,38 @@ func TestQueryEvent(t *testing.T) {
 			t.Error(err)
 		}
 	})
+
+	t.Run("respond", func(t *testing.T) {
+		var (
+			deadline = time.Now().Add(time.Second)
+			response []byte
+		)
+		evt := NewQueryEventFunc("query", nil, deadline, func(payload []byte) error {
+			response = payload
+			return nil
+		}).(*QueryEvent)
+
+		if err := evt.Respond([]byte("payload")); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := "payload", string(response); expected != actual {
+			t.Errorf("expected: %s, actual: %s", expected, actual)
+		}
+		if expected, actual := deadline, evt.Deadline(); !expected.Equal(actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("respond to a dispatched query", func(t *testing.T) {
+		evt := &QueryEvent{Name: "query"}
+
+		if expected, actual := false, evt.Respond([]byte("payload")) == nil; expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+		if expected, actual := true, evt.Deadline().IsZero(); expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+	})
 }
 
 func TestErrorEvent(t *testing.T) {
@@ -0,0 +1,241 @@
+// Package faultnet provides a memberlist Transport that injects faults in to
+// the traffic between the members of a cluster, so that the failure detection
+// and recovery of real members can be tested in a single process over
+// loopback.
+//
+// Every Transport belongs to a Network, which knows the name of the node
+// behind the address of each Transport. Faults are set on the Network between
+// the named nodes and take effect straight away.
+package faultnet
+
+import (
+	"io"
+	stdlog "log"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultSeed = 1
+)
+
+// Network holds the faults between the nodes of the Transports created from
+// it.
+type Network struct {
+	mtx    sync.Mutex
+	names  map[string]string
+	groups map[string]int
+	drops  map[link]float64
+	delays map[link]time.Duration
+	rand   *rand.Rand
+}
+
+// NewNetwork creates a Network without any faults.
+func NewNetwork() *Network {
+	return &Network{
+		names:  make(map[string]string),
+		groups: make(map[string]int),
+		drops:  make(map[link]float64),
+		delays: make(map[link]time.Duration),
+		rand:   rand.New(rand.NewSource(defaultSeed)),
+	}
+}
+
+// NewTransport creates a Transport for the node with the name, which listens
+// on the address and port. A port of zero picks any free port, the address
+// the Transport is advertised on can be found from the Address.
+func (n *Network) NewTransport(name, addr string, port int, logOutput io.Writer) (*Transport, error) {
+	inner, err := memberlist.NewNetTransport(&memberlist.NetTransportConfig{
+		BindAddrs: []string{addr},
+		BindPort:  port,
+		Logger:    stdlog.New(logOutput, "", stdlog.LstdFlags),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "net transport")
+	}
+
+	// The other nodes send to the advertised address, so that's the address
+	// the node is known by.
+	ip, advertisePort, err := inner.FinalAdvertiseAddr("", 0)
+	if err != nil {
+		inner.Shutdown()
+		return nil, errors.Wrap(err, "advertise address")
+	}
+
+	t := &Transport{
+		network: n,
+		name:    name,
+		address: net.JoinHostPort(ip.String(), strconv.Itoa(advertisePort)),
+		inner:   inner,
+	}
+
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	n.names[t.address] = name
+	return t, nil
+}
+
+// Partition splits the network in to the groups of node names, the nodes in
+// one group can't talk to the nodes in any other group. The nodes that aren't
+// in any group form a group of their own.
+func (n *Network) Partition(groups ...[]string) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	n.groups = make(map[string]int)
+	for k, v := range groups {
+		for _, name := range v {
+			n.groups[name] = k + 1
+		}
+	}
+}
+
+// Heal removes any partitions from the network.
+func (n *Network) Heal() {
+	n.Partition()
+}
+
+// SetDrop sets the rate of the packets from one node to another that are
+// dropped, from 0 where no packets are dropped to 1 where every packet is
+// dropped. Streams are never dropped, as they're reliable.
+func (n *Network) SetDrop(from, to string, rate float64) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if rate <= 0 {
+		delete(n.drops, link{from, to})
+		return
+	}
+	n.drops[link{from, to}] = rate
+}
+
+// SetDelay sets how long the packets and the new streams from one node to
+// another are delayed.
+func (n *Network) SetDelay(from, to string, d time.Duration) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if d <= 0 {
+		delete(n.delays, link{from, to})
+		return
+	}
+	n.delays[link{from, to}] = d
+}
+
+// route returns how long to delay the traffic from the node to the address.
+// Returns false if the traffic can't get through.
+func (n *Network) route(from, addr string, packet bool) (time.Duration, bool) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	// Traffic to an unknown address isn't faulted.
+	to, ok := n.names[addr]
+	if !ok {
+		return 0, true
+	}
+	if n.groups[from] != n.groups[to] {
+		return 0, false
+	}
+
+	l := link{from, to}
+	if rate, ok := n.drops[l]; packet && ok && n.rand.Float64() < rate {
+		return 0, false
+	}
+	return n.delays[l], true
+}
+
+func (n *Network) remove(addr string) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	delete(n.names, addr)
+}
+
+type link struct {
+	from, to string
+}
+
+// Transport is a memberlist Transport over UDP and TCP, which drops, delays
+// and partitions the traffic sent by the node, depending on the faults of the
+// Network.
+type Transport struct {
+	network *Network
+	name    string
+	address string
+	inner   *memberlist.NetTransport
+}
+
+// Name returns the name of the node of the Transport.
+func (t *Transport) Name() string {
+	return t.name
+}
+
+// Address returns the host:port the Transport is advertised on.
+func (t *Transport) Address() string {
+	return t.address
+}
+
+// FinalAdvertiseAddr returns the address to advertise to the cluster.
+func (t *Transport) FinalAdvertiseAddr(ip string, port int) (net.IP, int, error) {
+	return t.inner.FinalAdvertiseAddr(ip, port)
+}
+
+// WriteTo sends the packet to the address, unless the packet is dropped. A
+// dropped packet isn't an error, the same as a packet lost on the network.
+func (t *Transport) WriteTo(b []byte, addr string) (time.Time, error) {
+	delay, ok := t.network.route(t.name, addr, true)
+	if !ok {
+		return time.Now(), nil
+	}
+	if delay > 0 {
+		buf := append([]byte(nil), b...)
+		time.AfterFunc(delay, func() {
+			t.inner.WriteTo(buf, addr)
+		})
+		return time.Now(), nil
+	}
+	return t.inner.WriteTo(b, addr)
+}
+
+// PacketCh returns the channel of the packets received by the Transport.
+func (t *Transport) PacketCh() <-chan *memberlist.Packet {
+	return t.inner.PacketCh()
+}
+
+// DialTimeout opens a stream to the address. If the address can't be reached
+// the dial fails once the timeout has passed, the same as it would if the
+// network was partitioned.
+func (t *Transport) DialTimeout(addr string, timeout time.Duration) (net.Conn, error) {
+	delay, ok := t.network.route(t.name, addr, false)
+	if !ok {
+		time.Sleep(timeout)
+		return nil, errors.Errorf("dial %s: i/o timeout", addr)
+	}
+	if delay > 0 {
+		if delay >= timeout {
+			time.Sleep(timeout)
+			return nil, errors.Errorf("dial %s: i/o timeout", addr)
+		}
+		time.Sleep(delay)
+		timeout -= delay
+	}
+	return t.inner.DialTimeout(addr, timeout)
+}
+
+// StreamCh returns the channel of the streams opened to the Transport.
+func (t *Transport) StreamCh() <-chan net.Conn {
+	return t.inner.StreamCh()
+}
+
+// Shutdown stops the Transport listening.
+func (t *Transport) Shutdown() error {
+	t.network.remove(t.address)
+	return t.inner.Shutdown()
+}
@@ -0,0 +1,103 @@
+// +build integration
+
+package faultnet
+
+import (
+	"io/ioutil"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/go-kit/kit/log"
+)
+
+func TestRealMembers_Integration(t *testing.T) {
+	t.Parallel()
+
+	var (
+		network = NewNetwork()
+		names   = []string{"a", "b", "c"}
+		nodes   []members.Members
+		seed    string
+	)
+	for _, name := range names {
+		transport, err := network.NewTransport(name, "127.0.0.1", 0, ioutil.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seed == "" {
+			seed = transport.Address()
+		}
+
+		config, err := members.Build(
+			members.WithPeerType(members.PeerType("peertype:test")),
+			members.WithNodeName(name),
+			members.WithAPIAddrPort("127.0.0.1", 8080),
+			members.WithExisting([]string{seed}),
+			members.WithTransport(transport),
+			members.WithLogOutput(ioutil.Discard),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := members.NewRealMembers(config, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer m.Close()
+
+		if _, err := m.Join(); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, m)
+	}
+
+	wait(t, nodes[0], []string{"a", "b", "c"}, time.Second*10)
+
+	begin := time.Now()
+	network.Partition([]string{"a", "b"}, []string{"c"})
+	wait(t, nodes[0], []string{"a", "b"}, time.Second*30)
+	t.Logf("failure detected in %v", time.Since(begin))
+
+	begin = time.Now()
+	network.Heal()
+	wait(t, nodes[0], []string{"a", "b", "c"}, time.Second*60)
+	t.Logf("recovered in %v", time.Since(begin))
+}
+
+// wait until the members see the alive members with the names.
+func wait(t *testing.T, m members.Members, names []string, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for {
+		var alive []string
+		if err := m.Walk(func(info members.PeerInfo) error {
+			alive = append(alive, info.Name)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(alive)
+
+		if equal(names, alive) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected: %v, actual: %v", names, alive)
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if v != b[k] {
+			return false
+		}
+	}
+	return true
+}
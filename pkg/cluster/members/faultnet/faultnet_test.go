@@ -0,0 +1,118 @@
+package faultnet
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+
+	t.Run("packet", func(t *testing.T) {
+		network, a, b := newTransports(t)
+		defer a.Shutdown()
+		defer b.Shutdown()
+
+		send(t, a, b)
+		if expected, actual := true, received(b, time.Second); expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+
+		network.Partition([]string{"a"}, []string{"b"})
+		send(t, a, b)
+		if expected, actual := false, received(b, time.Millisecond*100); expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+
+		network.Heal()
+		send(t, a, b)
+		if expected, actual := true, received(b, time.Second); expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		network, a, b := newTransports(t)
+		defer a.Shutdown()
+		defer b.Shutdown()
+
+		network.SetDrop("a", "b", 1)
+		send(t, a, b)
+		if expected, actual := false, received(b, time.Millisecond*100); expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+
+		// Only the link from a to b drops packets.
+		send(t, b, a)
+		if expected, actual := true, received(a, time.Second); expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		network, a, b := newTransports(t)
+		defer a.Shutdown()
+		defer b.Shutdown()
+
+		network.SetDelay("a", "b", time.Millisecond*200)
+
+		begin := time.Now()
+		send(t, a, b)
+		if expected, actual := true, received(b, time.Second); expected != actual {
+			t.Fatalf("expected: %t, actual: %t", expected, actual)
+		}
+		if elapsed := time.Since(begin); elapsed < time.Millisecond*200 {
+			t.Errorf("expected: at least %v, actual: %v", time.Millisecond*200, elapsed)
+		}
+	})
+
+	t.Run("dial", func(t *testing.T) {
+		network, a, b := newTransports(t)
+		defer a.Shutdown()
+		defer b.Shutdown()
+
+		conn, err := a.DialTimeout(b.Address(), time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+
+		// The stream has to be accepted, before the transport can shutdown.
+		(<-b.StreamCh()).Close()
+
+		network.Partition([]string{"a"}, []string{"b"})
+		if _, err := a.DialTimeout(b.Address(), time.Millisecond*50); err == nil {
+			t.Errorf("expected: error, actual: %v", err)
+		}
+	})
+}
+
+func newTransports(t *testing.T) (*Network, *Transport, *Transport) {
+	network := NewNetwork()
+
+	a, err := network.NewTransport("a", "127.0.0.1", 0, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := network.NewTransport("b", "127.0.0.1", 0, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return network, a, b
+}
+
+func send(t *testing.T, from, to *Transport) {
+	if _, err := from.WriteTo([]byte("ping"), to.Address()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func received(t *Transport, timeout time.Duration) bool {
+	select {
+	case <-t.PacketCh():
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
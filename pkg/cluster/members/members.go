@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/hashicorp/memberlist"
 	"github.com/pkg/errors"
 )
 
@@ -38,6 +39,8 @@ type EventBus interface {
 	DeregisterEventHandler(EventHandler) error
 
 	// DispatchEvent dispatches an event to all the members in the cluster.
+	// The responses to a QueryEvent are passed to the event as they arrive,
+	// until the query times out.
 	DispatchEvent(Event) error
 }
 
@@ -60,6 +63,11 @@ type Members interface {
 	// Walk over a set of alive members
 	Walk(func(PeerInfo) error) error
 
+	// SetTags advertises additional tags for the local member, replacing any
+	// additional tags that were set before. The tags that describe the peer
+	// can not be replaced.
+	SetTags(map[string]string) error
+
 	// Close the current members cluster
 	Close() error
 }
@@ -112,6 +120,12 @@ type Config struct {
 	existing         []string
 	logOutput        io.Writer
 	broadcastTimeout time.Duration
+	datacenter       string
+	wan              bool
+	snapshotPath     string
+	weight           int
+	hash             string
+	transport        memberlist.Transport
 }
 
 // Option defines a option for generating a filesystem Config
@@ -206,12 +220,75 @@ func WithBroadcastTimeout(d time.Duration) Option {
 	}
 }
 
+// WithDatacenter adds a Datacenter to the configuration
+func WithDatacenter(dc string) Option {
+	return func(config *Config) error {
+		config.datacenter = dc
+		return nil
+	}
+}
+
+// WithWAN configures the members to gossip using timings that are tuned for a
+// wide area network, which is used when federating between datacenters.
+func WithWAN(wan bool) Option {
+	return func(config *Config) error {
+		config.wan = wan
+		return nil
+	}
+}
+
+// WithSnapshotPath adds a SnapshotPath to the configuration. The members
+// write the known peers to the snapshot, so that a restarted node can rejoin
+// the cluster without relying on the existing peers.
+func WithSnapshotPath(path string) Option {
+	return func(config *Config) error {
+		config.snapshotPath = path
+		return nil
+	}
+}
+
+// WithWeight adds a Weight to the configuration. The weight is advertised to
+// the cluster, so that larger members can take a larger share of the work.
+func WithWeight(weight int) Option {
+	return func(config *Config) error {
+		if weight < 1 {
+			return errors.Errorf("invalid weight %d", weight)
+		}
+		config.weight = weight
+		return nil
+	}
+}
+
+// WithHash adds the name of a Hash to the configuration. The hash is
+// advertised to the cluster, so that members hashing keys differently can be
+// detected.
+func WithHash(hash string) Option {
+	return func(config *Config) error {
+		config.hash = hash
+		return nil
+	}
+}
+
+// WithTransport adds a Transport to the configuration. The members talk to
+// the other members over the transport, instead of binding to the bind
+// address and port.
+func WithTransport(transport memberlist.Transport) Option {
+	return func(config *Config) error {
+		config.transport = transport
+		return nil
+	}
+}
+
 // PeerInfo describes what each peer is, along with the addr and port of each
 type PeerInfo struct {
-	Name     string
-	PeerType PeerType
-	APIAddr  string
-	APIPort  int
+	Name       string
+	PeerType   PeerType
+	APIAddr    string
+	APIPort    int
+	Datacenter string
+
+	// Tags holds all the tags of the peer, including any additional tags.
+	Tags map[string]string
 }
 
 // encodeTagPeerInfo encodes the peer information for the node tags.
@@ -221,9 +298,29 @@ func encodePeerInfoTag(info PeerInfo) map[string]string {
 		PeerTypeTag: info.PeerType.String(),
 		"api_addr":  info.APIAddr,
 		"api_port":  strconv.Itoa(info.APIPort),
+		"dc":        info.Datacenter,
 	}
 }
 
+// PeerInfoFromTags gets the peer information from the tags of a member.
+func PeerInfoFromTags(tags map[string]string) (PeerInfo, error) {
+	return decodePeerInfoTag(tags)
+}
+
+// TagsFromPeerInfo gets the tags of a member from the peer information, any
+// additional tags of the peer are kept, but can't replace the tags that
+// describe the peer.
+func TagsFromPeerInfo(info PeerInfo) map[string]string {
+	tags := make(map[string]string, len(info.Tags)+5)
+	for k, v := range info.Tags {
+		tags[k] = v
+	}
+	for k, v := range encodePeerInfoTag(info) {
+		tags[k] = v
+	}
+	return tags
+}
+
 // decodePeerInfoTag gets the peer information from the node tags.
 func decodePeerInfoTag(m map[string]string) (info PeerInfo, err error) {
 	name, ok := m["name"]
@@ -232,6 +329,7 @@ func decodePeerInfoTag(m map[string]string) (info PeerInfo, err error) {
 		return
 	}
 	info.Name = name
+	info.Tags = m
 
 	peerType, ok := m[PeerTypeTag]
 	if !ok {
@@ -254,5 +352,9 @@ func decodePeerInfoTag(m map[string]string) (info PeerInfo, err error) {
 		return
 	}
 
+	// Datacenter is optional, so older peers that don't advertise one are
+	// still decoded.
+	info.Datacenter = m["dc"]
+
 	return
 }
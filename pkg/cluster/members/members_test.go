@@ -7,6 +7,7 @@ import (
 	"testing/quick"
 	"time"
 
+	"github.com/hashicorp/memberlist"
 	"github.com/pkg/errors"
 )
 
@@ -47,6 +48,21 @@ func TestBuilding(t *testing.T) {
 		}
 	})
 
+	t.Run("transport", func(t *testing.T) {
+		transport := &memberlist.MockTransport{}
+		config, err := Build(
+			WithTransport(transport),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, serfConfig, _ := transformConfig(config)
+		if expected, actual := memberlist.Transport(transport), serfConfig.MemberlistConfig.Transport; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
 	t.Run("invalid build", func(t *testing.T) {
 		_, err := Build(
 			func(config *Config) error {
@@ -113,6 +129,69 @@ func TestPeerInfo(t *testing.T) {
 		}
 	})
 
+	t.Run("decode datacenter", func(t *testing.T) {
+		fn := func(name, peerType, addr string, port int, dc string) bool {
+			m := encodePeerInfoTag(PeerInfo{
+				Name:       name,
+				PeerType:   PeerType(peerType),
+				APIAddr:    addr,
+				APIPort:    port,
+				Datacenter: dc,
+			})
+
+			info, err := decodePeerInfoTag(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return info.Datacenter == dc
+		}
+
+		if err := quick.Check(fn, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("tags keep additional tags", func(t *testing.T) {
+		tags := TagsFromPeerInfo(PeerInfo{
+			Name:     "a",
+			PeerType: PeerType("x"),
+			APIAddr:  "y",
+			APIPort:  1,
+			Tags: map[string]string{
+				"zone": "eu",
+				"name": "b",
+			},
+		})
+
+		info, err := PeerInfoFromTags(tags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := "a", info.Name; expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+		if expected, actual := "eu", info.Tags["zone"]; expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("decode without datacenter", func(t *testing.T) {
+		info, err := decodePeerInfoTag(map[string]string{
+			"name":      "x",
+			PeerTypeTag: "x",
+			"api_addr":  "y",
+			"api_port":  "1",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := "", info.Datacenter; expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
 	t.Run("decode type failure", func(t *testing.T) {
 		_, err := decodePeerInfoTag(map[string]string{
 			"api_port": "1",
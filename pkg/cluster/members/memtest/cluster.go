@@ -0,0 +1,434 @@
+// Package memtest provides an in-process cluster of members.Members, which
+// talk to each other over a simulated network. The network can be
+// partitioned, drop messages, delay messages and crash members, all driven by
+// a clock that only moves when it's advanced, so that failover can be tested
+// deterministically.
+//
+// The members gossip in a simplified form of SWIM. Every probe interval each
+// member pings every other member it knows about, the ping and the reply
+// carry the members known to the sender. A member that hasn't been heard from
+// for the failure timeout is failed, a failed member that is heard from again
+// rejoins. User events and queries, along with the responses to the queries,
+// are sent straight to the members over the same network.
+package memtest
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultSeed           = 1
+	defaultProbeInterval  = time.Second
+	defaultFailureTimeout = time.Second * 5
+	defaultLatency        = time.Millisecond * 10
+	defaultQueryTimeout   = time.Second * 5
+	defaultPort           = 7946
+)
+
+// Option defines a option for configuring a Cluster
+type Option func(*Cluster)
+
+// WithSeed sets the seed of the random numbers used to drop messages, the
+// same seed drops the same messages.
+func WithSeed(seed int64) Option {
+	return func(c *Cluster) {
+		c.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// WithStart sets the time the clock of the Cluster starts at.
+func WithStart(start time.Time) Option {
+	return func(c *Cluster) {
+		c.now = start
+	}
+}
+
+// WithProbeInterval sets how often every member pings the other members.
+func WithProbeInterval(d time.Duration) Option {
+	return func(c *Cluster) {
+		c.probeInterval = d
+	}
+}
+
+// WithFailureTimeout sets how long a member can't be heard from, before it's
+// failed.
+func WithFailureTimeout(d time.Duration) Option {
+	return func(c *Cluster) {
+		c.failureTimeout = d
+	}
+}
+
+// WithLatency sets how long every message takes to be delivered, unless the
+// latency of the link is set with SetLinkLatency.
+func WithLatency(d time.Duration) Option {
+	return func(c *Cluster) {
+		c.latency = d
+	}
+}
+
+// WithQueryTimeout sets how long a query waits for the responses, unless the
+// timeout of the query is set.
+func WithQueryTimeout(d time.Duration) Option {
+	return func(c *Cluster) {
+		c.queryTimeout = d
+	}
+}
+
+// Cluster is a simulated network of members. Nothing happens until the clock
+// of the Cluster is advanced, at which point the messages are delivered and
+// the members are probed in time order. The event handlers of the members are
+// called from Advance.
+type Cluster struct {
+	mtx            sync.Mutex
+	now            time.Time
+	nextProbe      time.Time
+	probeInterval  time.Duration
+	failureTimeout time.Duration
+	latency        time.Duration
+	queryTimeout   time.Duration
+	loss           float64
+	rand           *rand.Rand
+	links          map[link]time.Duration
+	groups         map[string]int
+	nodes          map[string]*node
+	order          []*node
+	queue          []envelope
+	seq            uint64
+}
+
+// NewCluster creates a Cluster without any members.
+func NewCluster(opts ...Option) *Cluster {
+	c := &Cluster{
+		now:            time.Unix(0, 0).UTC(),
+		probeInterval:  defaultProbeInterval,
+		failureTimeout: defaultFailureTimeout,
+		latency:        defaultLatency,
+		queryTimeout:   defaultQueryTimeout,
+		rand:           rand.New(rand.NewSource(defaultSeed)),
+		links:          make(map[link]time.Duration),
+		groups:         make(map[string]int),
+		nodes:          make(map[string]*node),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.nextProbe = c.now.Add(c.probeInterval)
+	return c
+}
+
+// NewMembers creates the members of a node in the Cluster, which joins the
+// members with the existing names when Join is called. The node name has to be
+// unique in the Cluster.
+func (c *Cluster) NewMembers(info members.PeerInfo, existing ...string) (members.Members, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, ok := c.nodes[info.Name]; ok {
+		return nil, errors.Errorf("duplicate node name %q", info.Name)
+	}
+
+	// Every node gets a unique address, in the order they're created.
+	n := len(c.order) + 1
+	addr := net.JoinHostPort(fmt.Sprintf("10.0.%d.%d", n/256, n%256), strconv.Itoa(defaultPort))
+
+	node := &node{
+		cluster:  c,
+		name:     info.Name,
+		address:  addr,
+		tags:     members.TagsFromPeerInfo(info),
+		existing: existing,
+		running:  true,
+		peers:    make(map[string]*peerState),
+		queries:  make(map[uint64]*query),
+	}
+	node.base = copyTags(node.tags)
+	c.nodes[info.Name] = node
+	c.order = append(c.order, node)
+	return node, nil
+}
+
+// Now returns the current time of the clock of the Cluster.
+func (c *Cluster) Now() time.Time {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.now
+}
+
+// Advance moves the clock of the Cluster forward, delivering the messages and
+// probing the members on the way.
+func (c *Cluster) Advance(d time.Duration) {
+	c.mtx.Lock()
+	target := c.now.Add(d)
+	for {
+		var (
+			next    = c.nextProbe
+			deliver = len(c.queue) > 0 && !c.queue[0].at.After(next)
+		)
+		if deliver {
+			next = c.queue[0].at
+		}
+		if next.After(target) {
+			break
+		}
+		c.now = next
+
+		var dispatches []dispatch
+		if deliver {
+			env := c.queue[0]
+			c.queue = c.queue[1:]
+			dispatches = c.deliver(env)
+		} else {
+			c.nextProbe = c.nextProbe.Add(c.probeInterval)
+			dispatches = c.probe()
+		}
+
+		// The handlers are free to call back in to the members.
+		c.mtx.Unlock()
+		for _, v := range dispatches {
+			v.run()
+		}
+		c.mtx.Lock()
+	}
+	c.now = target
+	c.mtx.Unlock()
+}
+
+// Partition splits the network in to the groups of node names, the nodes in
+// one group can't talk to the nodes in any other group. The nodes that aren't
+// in any group form a group of their own.
+func (c *Cluster) Partition(groups ...[]string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.groups = make(map[string]int)
+	for k, v := range groups {
+		for _, name := range v {
+			c.groups[name] = k + 1
+		}
+	}
+}
+
+// Heal removes any partitions from the network.
+func (c *Cluster) Heal() {
+	c.Partition()
+}
+
+// SetLoss sets the rate of the messages that are dropped, from 0 where no
+// messages are dropped to 1 where every message is dropped.
+func (c *Cluster) SetLoss(rate float64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.loss = rate
+}
+
+// SetLatency sets how long every message takes to be delivered, unless the
+// latency of the link is set.
+func (c *Cluster) SetLatency(d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.latency = d
+}
+
+// SetLinkLatency sets how long the messages from one node to another take to
+// be delivered.
+func (c *Cluster) SetLinkLatency(from, to string, d time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.links[link{from, to}] = d
+}
+
+// Crash stops the node with the name, it doesn't send or receive any messages
+// until it's restarted.
+func (c *Cluster) Crash(name string) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	node, ok := c.nodes[name]
+	if !ok {
+		return errors.Errorf("unknown node %q", name)
+	}
+	node.running = false
+	return nil
+}
+
+// Restart a crashed node with the name, as if the node was paused. The node
+// picks up where it left off, so any member it knows about isn't failed until
+// the failure timeout has passed again.
+func (c *Cluster) Restart(name string) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	node, ok := c.nodes[name]
+	if !ok {
+		return errors.Errorf("unknown node %q", name)
+	}
+	if node.running {
+		return nil
+	}
+	node.running = true
+	node.version++
+	for _, v := range node.peers {
+		v.heard = c.now
+	}
+	return nil
+}
+
+// probe fails the members that haven't been heard from, then pings the rest.
+func (c *Cluster) probe() []dispatch {
+	var res []dispatch
+	for _, node := range c.order {
+		if !node.active() {
+			continue
+		}
+		node.expire()
+
+		for _, name := range node.peerNames() {
+			peer := node.peers[name]
+			if peer.status == statusAlive && c.now.Sub(peer.heard) > c.failureTimeout {
+				peer.status = statusFailed
+				res = append(res, node.memberEvent(members.EventMemberFailed, peer))
+			}
+			// Failed members are still pinged, so that they can rejoin
+			// once they can be reached again.
+			if peer.status != statusLeft {
+				c.send(node, name, message{kind: kindPing})
+			}
+		}
+	}
+	return res
+}
+
+// send a message from the node to the node with the name.
+// Returns false if the message can't be delivered.
+func (c *Cluster) send(from *node, to string, msg message) bool {
+	node, ok := c.nodes[to]
+	if !ok || !node.running || !c.reachable(from.name, to) {
+		return false
+	}
+
+	// A node always reaches itself straight away.
+	var latency time.Duration
+	if from.name != to {
+		if c.loss > 0 && c.rand.Float64() < c.loss {
+			return false
+		}
+
+		var ok bool
+		if latency, ok = c.links[link{from.name, to}]; !ok {
+			latency = c.latency
+		}
+	}
+
+	msg.from = from.name
+	if msg.kind.gossips() {
+		msg.state = from.state()
+		msg.gossip = from.gossip()
+	}
+
+	c.seq++
+	env := envelope{
+		at:  c.now.Add(latency),
+		seq: c.seq,
+		to:  to,
+		msg: msg,
+	}
+	i := sort.Search(len(c.queue), func(i int) bool {
+		return env.before(c.queue[i])
+	})
+	c.queue = append(c.queue, envelope{})
+	copy(c.queue[i+1:], c.queue[i:])
+	c.queue[i] = env
+	return true
+}
+
+// deliver the message in the envelope, a message to a node that has crashed
+// since it was sent is dropped.
+func (c *Cluster) deliver(env envelope) []dispatch {
+	node := c.nodes[env.to]
+	if !node.running || node.closed {
+		return nil
+	}
+	return node.receive(env.msg)
+}
+
+func (c *Cluster) reachable(from, to string) bool {
+	return c.groups[from] == c.groups[to]
+}
+
+type link struct {
+	from, to string
+}
+
+type envelope struct {
+	at  time.Time
+	seq uint64
+	to  string
+	msg message
+}
+
+func (e envelope) before(other envelope) bool {
+	if e.at.Equal(other.at) {
+		return e.seq < other.seq
+	}
+	return e.at.Before(other.at)
+}
+
+type kind int
+
+const (
+	kindPing kind = iota
+	kindAck
+	kindLeave
+	kindUser
+	kindQuery
+	kindResponse
+)
+
+// gossips returns true if the messages of the kind carry what the sender
+// knows about the members.
+func (k kind) gossips() bool {
+	return k == kindPing || k == kindAck || k == kindLeave
+}
+
+type message struct {
+	kind   kind
+	from   string
+	state  peerState
+	gossip []peerState
+	event  members.UserEvent
+
+	// The id and the deadline of the query a query or a response is for.
+	id       uint64
+	deadline time.Time
+}
+
+// dispatch is an event that's waiting to be handled by the event handlers of
+// a node, or a response that's waiting to be passed to the query.
+type dispatch struct {
+	handlers []members.EventHandler
+	event    members.Event
+	response func()
+}
+
+func (d dispatch) run() {
+	if d.response != nil {
+		d.response()
+	}
+	for _, v := range d.handlers {
+		// Errors are ignored by the real members, other than logging them.
+		v.HandleEvent(d.event)
+	}
+}
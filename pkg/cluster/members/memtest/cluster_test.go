@@ -0,0 +1,528 @@
+package memtest
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+)
+
+func TestCluster(t *testing.T) {
+	t.Parallel()
+
+	t.Run("join", func(t *testing.T) {
+		c := NewCluster()
+		nodes := join(t, c, "a", "b", "c")
+		c.Advance(time.Second * 2)
+
+		for _, v := range nodes {
+			if expected, actual := []string{"a", "b", "c"}, walk(t, v); !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("join without existing", func(t *testing.T) {
+		c := NewCluster()
+		m := newMembers(t, c, "a", "b")
+
+		if _, err := m.Join(); err == nil {
+			t.Errorf("expected: error, actual: %v", err)
+		}
+	})
+
+	t.Run("partition", func(t *testing.T) {
+		c := NewCluster()
+		nodes := join(t, c, "a", "b", "c")
+		c.Advance(time.Second * 2)
+
+		events := record(t, nodes[0])
+		c.Partition([]string{"a", "b"}, []string{"c"})
+		c.Advance(time.Second * 10)
+
+		if expected, actual := []string{"a", "b"}, walk(t, nodes[0]); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := []string{"c"}, walk(t, nodes[2]); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := []string{"failed:c"}, events.names(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		c.Heal()
+		c.Advance(time.Second * 2)
+
+		if expected, actual := []string{"a", "b", "c"}, walk(t, nodes[2]); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := []string{"failed:c", "joined:c"}, events.names(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("failure timeout", func(t *testing.T) {
+		c := NewCluster(WithFailureTimeout(time.Second * 3))
+		nodes := join(t, c, "a", "b")
+		c.Advance(time.Second * 2)
+
+		events := record(t, nodes[0])
+		c.Crash("b")
+
+		c.Advance(time.Second * 3)
+		if expected, actual := 0, len(events.names()); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+
+		c.Advance(time.Second * 2)
+		if expected, actual := []string{"failed:b"}, events.names(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("crash and restart", func(t *testing.T) {
+		c := NewCluster()
+		nodes := join(t, c, "a", "b", "c")
+		c.Advance(time.Second * 2)
+
+		if err := c.Crash("b"); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(time.Second * 10)
+
+		if expected, actual := []string{"a", "c"}, walk(t, nodes[0]); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		if err := c.Restart("b"); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(time.Second * 2)
+
+		for _, v := range nodes {
+			if expected, actual := []string{"a", "b", "c"}, walk(t, v); !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("leave", func(t *testing.T) {
+		c := NewCluster()
+		nodes := join(t, c, "a", "b")
+		c.Advance(time.Second * 2)
+
+		events := record(t, nodes[0])
+		if err := nodes[1].Leave(); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(time.Second * 10)
+
+		if expected, actual := []string{"left:b"}, events.names(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 1, nodes[0].MemberList().NumMembers(); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		c := NewCluster()
+		nodes := join(t, c, "a", "b")
+		c.Advance(time.Second * 2)
+
+		events := record(t, nodes[0])
+		if err := nodes[1].SetTags(map[string]string{"zone": "eu", "name": "x"}); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(time.Second * 2)
+
+		if expected, actual := []string{"updated:b"}, events.names(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		var tags map[string]string
+		for _, v := range nodes[0].MemberList().Members() {
+			if v.Name() == "b" {
+				tags = v.Tags()
+			}
+		}
+		if expected, actual := "eu", tags["zone"]; expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+		if expected, actual := "b", tags["name"]; expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("user events", func(t *testing.T) {
+		c := NewCluster()
+		nodes := join(t, c, "a", "b", "c")
+		c.Advance(time.Second * 2)
+
+		var recorders []*recorder
+		for _, v := range nodes {
+			recorders = append(recorders, record(t, v))
+		}
+		if err := nodes[0].DispatchEvent(members.NewUserEvent("ping", []byte("1"))); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(time.Millisecond * 10)
+
+		for _, v := range recorders {
+			if expected, actual := []string{"user:ping"}, v.names(); !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		c := NewCluster()
+		nodes := join(t, c, "a", "b")
+		c.Advance(time.Second * 2)
+
+		events := record(t, nodes[1])
+		c.SetLinkLatency("a", "b", time.Millisecond*500)
+		if err := nodes[0].DispatchEvent(members.NewUserEvent("ping", nil)); err != nil {
+			t.Fatal(err)
+		}
+
+		c.Advance(time.Millisecond * 499)
+		if expected, actual := 0, len(events.names()); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		c.Advance(time.Millisecond)
+		if expected, actual := []string{"user:ping"}, events.names(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("loss", func(t *testing.T) {
+		c := NewCluster()
+		nodes := join(t, c, "a", "b")
+		c.Advance(time.Second * 2)
+
+		events := record(t, nodes[1])
+		c.SetLoss(1)
+		if err := nodes[0].DispatchEvent(members.NewUserEvent("ping", nil)); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(time.Second * 10)
+
+		if expected, actual := []string{"failed:a"}, events.names(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("queries", func(t *testing.T) {
+		c := NewCluster()
+		nodes := join(t, c, "a", "b", "c")
+		c.Advance(time.Second * 2)
+
+		var recorders []*recorder
+		for _, v := range nodes {
+			recorders = append(recorders, respond(t, v))
+		}
+		responses := &responses{}
+		if err := nodes[0].DispatchEvent(responses.query("ping", "b", "c")); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(time.Millisecond * 20)
+
+		if expected, actual := []string{"b:b", "c:c"}, responses.names(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		// Only the nodes with the names are queried.
+		for k, v := range []int{0, 1, 1} {
+			if expected, actual := v, len(recorders[k].names()); expected != actual {
+				t.Errorf("expected: %d, actual: %d", expected, actual)
+			}
+		}
+	})
+
+	t.Run("query every node", func(t *testing.T) {
+		c := NewCluster()
+		nodes := join(t, c, "a", "b")
+		c.Advance(time.Second * 2)
+
+		for _, v := range nodes {
+			respond(t, v)
+		}
+		responses := &responses{}
+		if err := nodes[0].DispatchEvent(responses.query("ping")); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(time.Millisecond * 20)
+
+		if expected, actual := []string{"a:a", "b:b"}, responses.names(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("late response", func(t *testing.T) {
+		c := NewCluster()
+		nodes := join(t, c, "a", "b")
+		c.Advance(time.Second * 2)
+
+		respond(t, nodes[1])
+		c.SetLinkLatency("b", "a", time.Millisecond*500)
+
+		responses := &responses{}
+		query := responses.query("ping", "b")
+		query.Timeout = time.Millisecond * 100
+		if err := nodes[0].DispatchEvent(query); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(time.Second)
+
+		// The response arrives after the timeout of the query.
+		if expected, actual := 0, len(responses.names()); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("late query", func(t *testing.T) {
+		c := NewCluster()
+		nodes := join(t, c, "a", "b")
+		c.Advance(time.Second * 2)
+
+		events := respond(t, nodes[1])
+		c.SetLinkLatency("a", "b", time.Millisecond*500)
+
+		responses := &responses{}
+		query := responses.query("ping", "b")
+		query.Timeout = time.Millisecond * 100
+		if err := nodes[0].DispatchEvent(query); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(time.Second)
+
+		// The query arrives after its deadline, so it's never handled.
+		if expected, actual := 0, len(events.names()); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("query partition", func(t *testing.T) {
+		c := NewCluster()
+		nodes := join(t, c, "a", "b")
+		c.Advance(time.Second * 2)
+
+		events := respond(t, nodes[1])
+		c.Partition([]string{"a"}, []string{"b"})
+
+		responses := &responses{}
+		if err := nodes[0].DispatchEvent(responses.query("ping", "b")); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(time.Millisecond * 20)
+
+		if expected, actual := 0, len(events.names()); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := 0, len(responses.names()); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("lost response", func(t *testing.T) {
+		c := NewCluster()
+		nodes := join(t, c, "a", "b")
+		c.Advance(time.Second * 2)
+
+		// The query gets through, but the response is lost.
+		events := record(t, nodes[1])
+		responses := &responses{}
+		if err := nodes[0].DispatchEvent(responses.query("ping", "b")); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(time.Millisecond * 10)
+
+		c.SetLoss(1)
+		if err := events.last().(*members.QueryEvent).Respond([]byte("b")); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(time.Millisecond * 10)
+
+		if expected, actual := 0, len(responses.names()); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("respond once", func(t *testing.T) {
+		c := NewCluster()
+		nodes := join(t, c, "a", "b")
+		c.Advance(time.Second * 2)
+
+		events := record(t, nodes[1])
+		if err := nodes[0].DispatchEvent((&responses{}).query("ping", "b")); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(time.Millisecond * 10)
+
+		query := events.last().(*members.QueryEvent)
+		if err := query.Respond(nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := query.Respond(nil); err == nil {
+			t.Errorf("expected: error, actual: %v", err)
+		}
+	})
+
+	t.Run("deterministic", func(t *testing.T) {
+		run := func() []string {
+			c := NewCluster(WithSeed(42))
+			nodes := join(t, c, "a", "b", "c", "d")
+			events := record(t, nodes[0])
+
+			c.SetLoss(0.6)
+			c.Advance(time.Second * 30)
+			return events.names()
+		}
+
+		expected := run()
+		if len(expected) == 0 {
+			t.Fatalf("expected: events, actual: %v", expected)
+		}
+		if actual := run(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+// join creates the members of the names, every node joins the first node.
+func join(t *testing.T, c *Cluster, names ...string) []members.Members {
+	var res []members.Members
+	for _, v := range names {
+		m := newMembers(t, c, v, names[0])
+		if _, err := m.Join(); err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, m)
+	}
+	return res
+}
+
+func newMembers(t *testing.T, c *Cluster, name string, existing ...string) members.Members {
+	m, err := c.NewMembers(members.PeerInfo{
+		Name:     name,
+		PeerType: members.PeerType("peertype:test"),
+		APIAddr:  "127.0.0.1",
+		APIPort:  8080,
+	}, existing...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func walk(t *testing.T, m members.Members) []string {
+	var res []string
+	if err := m.Walk(func(info members.PeerInfo) error {
+		res = append(res, info.Name)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func record(t *testing.T, m members.Members) *recorder {
+	r := &recorder{}
+	if err := m.RegisterEventHandler(r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// respond records the events of the members and responds to every query with
+// the name of the local member.
+func respond(t *testing.T, m members.Members) *recorder {
+	r := &recorder{
+		respond: m.MemberList().LocalNode().Name(),
+	}
+	if err := m.RegisterEventHandler(r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+type recorder struct {
+	mtx     sync.Mutex
+	events  []string
+	event   members.Event
+	respond string
+}
+
+func (r *recorder) HandleEvent(e members.Event) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.event = e
+
+	switch t := e.(type) {
+	case *members.MemberEvent:
+		prefix := map[members.MemberEventType]string{
+			members.EventMemberJoined:  "joined",
+			members.EventMemberLeft:    "left",
+			members.EventMemberFailed:  "failed",
+			members.EventMemberUpdated: "updated",
+		}[t.EventType]
+		for _, v := range t.Members {
+			r.events = append(r.events, prefix+":"+v.Name())
+		}
+	case *members.UserEvent:
+		r.events = append(r.events, "user:"+t.Name)
+	case *members.QueryEvent:
+		r.events = append(r.events, "query:"+t.Name)
+		if r.respond != "" {
+			return t.Respond([]byte(r.respond))
+		}
+	}
+	return nil
+}
+
+func (r *recorder) names() []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return append([]string(nil), r.events...)
+}
+
+func (r *recorder) last() members.Event {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return r.event
+}
+
+// responses records the responses to the queries, as the name of the node
+// that responded and the payload of the response.
+type responses struct {
+	mtx       sync.Mutex
+	responses []string
+}
+
+func (r *responses) query(name string, nodes ...string) *members.QueryEvent {
+	return &members.QueryEvent{
+		Name:  name,
+		Nodes: nodes,
+		OnResponse: func(from string, payload []byte) {
+			r.mtx.Lock()
+			defer r.mtx.Unlock()
+
+			r.responses = append(r.responses, from+":"+string(payload))
+		},
+	}
+}
+
+func (r *responses) names() []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	res := append([]string(nil), r.responses...)
+	sort.Strings(res)
+	return res
+}
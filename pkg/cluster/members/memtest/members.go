@@ -0,0 +1,543 @@
+package memtest
+
+import (
+	"sort"
+	"time"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/pkg/errors"
+)
+
+type status int
+
+const (
+	statusAlive status = iota
+	statusFailed
+	statusLeft
+)
+
+// peerState is what a node knows about another node. The version of a node
+// only goes up, so that newer information always replaces older information.
+type peerState struct {
+	member  member
+	version uint64
+	status  status
+	heard   time.Time
+}
+
+type node struct {
+	cluster  *Cluster
+	name     string
+	address  string
+	base     map[string]string
+	tags     map[string]string
+	version  uint64
+	existing []string
+	running  bool
+	left     bool
+	closed   bool
+	peers    map[string]*peerState
+	queries  map[uint64]*query
+	handlers []members.EventHandler
+}
+
+// query is a query the node dispatched, which is waiting for the responses.
+type query struct {
+	deadline   time.Time
+	onResponse func(from string, payload []byte)
+}
+
+func (n *node) Join() (int, error) {
+	c := n.cluster
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if n.closed {
+		return 0, errors.Errorf("members closed")
+	}
+	if n.left {
+		n.left = false
+		n.version++
+	}
+
+	var attempted, contacted int
+	for _, v := range n.existing {
+		if v == n.name {
+			continue
+		}
+		attempted++
+		if c.send(n, v, message{kind: kindPing}) {
+			contacted++
+		}
+	}
+	if contacted == 0 && attempted > 0 {
+		return 0, errors.Errorf("no nodes could be contacted")
+	}
+	return contacted, nil
+}
+
+func (n *node) Leave() error {
+	c := n.cluster
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if n.left || n.closed {
+		return nil
+	}
+	n.left = true
+	n.version++
+	for _, name := range n.peerNames() {
+		if n.peers[name].status != statusLeft {
+			c.send(n, name, message{kind: kindLeave})
+		}
+	}
+	return nil
+}
+
+func (n *node) MemberList() members.MemberList {
+	return memberList{n}
+}
+
+func (n *node) Walk(fn func(members.PeerInfo) error) error {
+	for _, v := range n.alive() {
+		if info, err := members.PeerInfoFromTags(v.tags); err == nil {
+			if e := fn(info); e != nil {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+func (n *node) SetTags(tags map[string]string) error {
+	c := n.cluster
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	merged := make(map[string]string, len(n.base)+len(tags))
+	for k, v := range tags {
+		merged[k] = v
+	}
+	for k, v := range n.base {
+		merged[k] = v
+	}
+	n.tags = merged
+	n.version++
+	return nil
+}
+
+func (n *node) Close() error {
+	if err := n.Leave(); err != nil {
+		return err
+	}
+
+	c := n.cluster
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	n.closed = true
+	return nil
+}
+
+func (n *node) RegisterEventHandler(fn members.EventHandler) error {
+	c := n.cluster
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	n.handlers = append(n.handlers, fn)
+	return nil
+}
+
+func (n *node) DeregisterEventHandler(fn members.EventHandler) error {
+	c := n.cluster
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for k, v := range n.handlers {
+		if v == fn {
+			n.handlers = append(n.handlers[:k:k], n.handlers[k+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// DispatchEvent sends the user event to every alive member, including the
+// local member. Unlike the real members, the event isn't gossiped, so a
+// dropped message means the member never sees the event. A query is sent the
+// same way, to the alive members with the names of the query, and the
+// responses that arrive before the timeout of the query are passed to the
+// query.
+func (n *node) DispatchEvent(e members.Event) error {
+	c := n.cluster
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !n.active() {
+		return errors.Errorf("members not running")
+	}
+
+	switch t := e.(type) {
+	case *members.UserEvent:
+		msg := message{
+			kind: kindUser,
+			event: members.UserEvent{
+				Name:    t.Name,
+				Payload: append([]byte(nil), t.Payload...),
+			},
+		}
+		for _, name := range n.recipients(nil) {
+			c.send(n, name, msg)
+		}
+		return nil
+
+	case *members.QueryEvent:
+		timeout := t.Timeout
+		if timeout <= 0 {
+			timeout = c.queryTimeout
+		}
+
+		c.seq++
+		msg := message{
+			kind: kindQuery,
+			event: members.UserEvent{
+				Name:    t.Name,
+				Payload: append([]byte(nil), t.Payload...),
+			},
+			id:       c.seq,
+			deadline: c.now.Add(timeout),
+		}
+		n.queries[msg.id] = &query{
+			deadline:   msg.deadline,
+			onResponse: t.OnResponse,
+		}
+		for _, name := range n.recipients(t.Nodes) {
+			c.send(n, name, msg)
+		}
+		return nil
+
+	default:
+		return errors.Errorf("Unsupported event type %v", e.Type())
+	}
+}
+
+// recipients returns the names of the local member and the alive members,
+// only including the names given, unless there are none.
+func (n *node) recipients(names []string) []string {
+	filter := make(map[string]struct{}, len(names))
+	for _, v := range names {
+		filter[v] = struct{}{}
+	}
+	include := func(name string) bool {
+		_, ok := filter[name]
+		return len(filter) == 0 || ok
+	}
+
+	var res []string
+	if include(n.name) {
+		res = append(res, n.name)
+	}
+	for _, name := range n.peerNames() {
+		if n.peers[name].status == statusAlive && include(name) {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// receive a message, returning the events for the event handlers.
+func (n *node) receive(msg message) []dispatch {
+	if n.left {
+		return nil
+	}
+
+	var res []dispatch
+	switch msg.kind {
+	case kindUser:
+		event := msg.event
+		return append(res, n.userEvent(&event))
+	case kindQuery:
+		// A query that arrives after its deadline can't be answered.
+		if n.cluster.now.After(msg.deadline) {
+			return nil
+		}
+		return append(res, n.userEvent(n.queryEvent(msg)))
+	case kindResponse:
+		q, ok := n.queries[msg.id]
+		if !ok || n.cluster.now.After(q.deadline) || q.onResponse == nil {
+			return nil
+		}
+		var (
+			from    = msg.from
+			payload = msg.event.Payload
+		)
+		return append(res, dispatch{
+			response: func() {
+				q.onResponse(from, payload)
+			},
+		})
+	}
+
+	// Hearing from a node directly means it's alive, unless it's leaving.
+	if msg.kind == kindLeave {
+		res = append(res, n.merge(msg.state)...)
+	} else {
+		res = append(res, n.heard(msg.state)...)
+	}
+	for _, v := range msg.gossip {
+		res = append(res, n.merge(v)...)
+	}
+
+	if msg.kind == kindPing {
+		n.cluster.send(n, msg.from, message{kind: kindAck})
+	}
+	return res
+}
+
+// heard from the node directly.
+func (n *node) heard(state peerState) []dispatch {
+	if state.member.name == n.name {
+		return nil
+	}
+
+	peer, ok := n.peers[state.member.name]
+	if !ok {
+		state.status = statusAlive
+		state.heard = n.cluster.now
+		n.peers[state.member.name] = &state
+		return []dispatch{n.memberEvent(members.EventMemberJoined, &state)}
+	}
+
+	var res []dispatch
+	peer.heard = n.cluster.now
+	if peer.status != statusAlive {
+		peer.status = statusAlive
+		peer.member = state.member
+		peer.version = state.version
+		res = append(res, n.memberEvent(members.EventMemberJoined, peer))
+	} else if state.version > peer.version {
+		peer.member = state.member
+		peer.version = state.version
+		res = append(res, n.memberEvent(members.EventMemberUpdated, peer))
+	}
+	return res
+}
+
+// merge what another node knows about a node, only newer information is
+// merged.
+func (n *node) merge(state peerState) []dispatch {
+	if state.member.name == n.name {
+		return nil
+	}
+
+	peer, ok := n.peers[state.member.name]
+	if !ok {
+		if state.status != statusAlive {
+			return nil
+		}
+		state.heard = n.cluster.now
+		n.peers[state.member.name] = &state
+		return []dispatch{n.memberEvent(members.EventMemberJoined, &state)}
+	}
+	if state.version <= peer.version {
+		return nil
+	}
+
+	peer.member = state.member
+	peer.version = state.version
+	switch {
+	case state.status == statusLeft && peer.status != statusLeft:
+		peer.status = statusLeft
+		return []dispatch{n.memberEvent(members.EventMemberLeft, peer)}
+	case state.status == statusAlive && peer.status != statusAlive:
+		peer.status = statusAlive
+		peer.heard = n.cluster.now
+		return []dispatch{n.memberEvent(members.EventMemberJoined, peer)}
+	case state.status == statusAlive:
+		return []dispatch{n.memberEvent(members.EventMemberUpdated, peer)}
+	}
+	return nil
+}
+
+// state of the local node, as it's sent to the other nodes.
+func (n *node) state() peerState {
+	status := statusAlive
+	if n.left {
+		status = statusLeft
+	}
+	return peerState{
+		member:  n.member(),
+		version: n.version,
+		status:  status,
+	}
+}
+
+// gossip returns what the node knows about the other nodes. Failed nodes
+// aren't gossiped, every node has to find out for itself.
+func (n *node) gossip() []peerState {
+	var res []peerState
+	for _, name := range n.peerNames() {
+		if peer := n.peers[name]; peer.status != statusFailed {
+			res = append(res, *peer)
+		}
+	}
+	return res
+}
+
+func (n *node) memberEvent(eventType members.MemberEventType, peer *peerState) dispatch {
+	return dispatch{
+		handlers: append([]members.EventHandler(nil), n.handlers...),
+		event:    members.NewMemberEvent(eventType, []members.Member{peer.member}),
+	}
+}
+
+func (n *node) userEvent(event members.Event) dispatch {
+	return dispatch{
+		handlers: append([]members.EventHandler(nil), n.handlers...),
+		event:    event,
+	}
+}
+
+// queryEvent creates the event for a query the node received, which responds
+// to the node that sent the query.
+func (n *node) queryEvent(msg message) members.Event {
+	var (
+		c         = n.cluster
+		responded bool
+	)
+	return members.NewQueryEventFunc(msg.event.Name, msg.event.Payload, msg.deadline, func(payload []byte) error {
+		c.mtx.Lock()
+		defer c.mtx.Unlock()
+
+		switch {
+		case responded:
+			return errors.Errorf("response already sent")
+		case c.now.After(msg.deadline):
+			return errors.Errorf("response is past the deadline")
+		case !n.active():
+			return errors.Errorf("members not running")
+		}
+		responded = true
+
+		c.send(n, msg.from, message{
+			kind: kindResponse,
+			event: members.UserEvent{
+				Name:    msg.event.Name,
+				Payload: append([]byte(nil), payload...),
+			},
+			id: msg.id,
+		})
+		return nil
+	})
+}
+
+// expire the queries that are past their deadline.
+func (n *node) expire() {
+	for k, v := range n.queries {
+		if n.cluster.now.After(v.deadline) {
+			delete(n.queries, k)
+		}
+	}
+}
+
+func (n *node) member() member {
+	return member{
+		name:    n.name,
+		address: n.address,
+		tags:    copyTags(n.tags),
+	}
+}
+
+// active returns true if the node is taking part in the cluster.
+func (n *node) active() bool {
+	return n.running && !n.left && !n.closed
+}
+
+// alive returns the alive members in the order of their names, including the
+// local member.
+func (n *node) alive() []member {
+	c := n.cluster
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var res []member
+	if !n.left && !n.closed {
+		res = append(res, n.member())
+	}
+	for _, v := range n.peers {
+		if v.status == statusAlive {
+			res = append(res, v.member)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].name < res[j].name
+	})
+	return res
+}
+
+func (n *node) peerNames() []string {
+	res := make([]string, 0, len(n.peers))
+	for k := range n.peers {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+type memberList struct {
+	node *node
+}
+
+func (m memberList) NumMembers() int {
+	return len(m.node.alive())
+}
+
+func (m memberList) LocalNode() members.Member {
+	c := m.node.cluster
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return m.node.member()
+}
+
+func (m memberList) Members() []members.Member {
+	alive := m.node.alive()
+	res := make([]members.Member, len(alive))
+	for k, v := range alive {
+		res[k] = v
+	}
+	return res
+}
+
+type member struct {
+	name    string
+	address string
+	tags    map[string]string
+}
+
+func (m member) Name() string {
+	return m.name
+}
+
+func (m member) Address() string {
+	return m.address
+}
+
+func (m member) PeerType() members.PeerType {
+	if t, ok := m.tags[members.PeerTypeTag]; ok {
+		return members.PeerType(t)
+	}
+	return members.PeerTypeUnknown
+}
+
+func (m member) Tags() map[string]string {
+	return m.tags
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	res := make(map[string]string, len(tags))
+	for k, v := range tags {
+		res[k] = v
+	}
+	return res
+}
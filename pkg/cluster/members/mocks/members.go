@@ -118,6 +118,18 @@ func (mr *MockMembersMockRecorder) RegisterEventHandler(arg0 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterEventHandler", reflect.TypeOf((*MockMembers)(nil).RegisterEventHandler), arg0)
 }
 
+// SetTags mocks base method
+func (m *MockMembers) SetTags(arg0 map[string]string) error {
+	ret := m.ctrl.Call(m, "SetTags", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetTags indicates an expected call of SetTags
+func (mr *MockMembersMockRecorder) SetTags(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTags", reflect.TypeOf((*MockMembers)(nil).SetTags), arg0)
+}
+
 // Walk mocks base method
 func (m *MockMembers) Walk(arg0 func(members.PeerInfo) error) error {
 	ret := m.ctrl.Call(m, "Walk", arg0)
@@ -10,6 +10,7 @@ func (nopMembers) Join() (int, error)              { return 0, nil }
 func (nopMembers) Leave() error                    { return nil }
 func (nopMembers) MemberList() MemberList          { return nopMemberList{} }
 func (nopMembers) Walk(func(PeerInfo) error) error { return nil }
+func (nopMembers) SetTags(map[string]string) error { return nil }
 func (nopMembers) Close() error                    { return nil }
 
 func (nopMembers) RegisterEventHandler(EventHandler) error   { return nil }
@@ -18,6 +18,12 @@ import (
 const (
 	// PeerTypeTag defines the key for the PeerType tag
 	PeerTypeTag = "peertype"
+
+	// WeightTag defines the key for the Weight tag
+	WeightTag = "weight"
+
+	// HashTag defines the key for the Hash tag
+	HashTag = "hash"
 )
 
 const (
@@ -26,6 +32,7 @@ const (
 
 type realMembers struct {
 	config        Config
+	tags          map[string]string
 	mutex         sync.Mutex
 	agent         *agent.Agent
 	members       *serf.Serf
@@ -35,7 +42,8 @@ type realMembers struct {
 
 // NewRealMembers creates a new members list to join.
 func NewRealMembers(config Config, logger log.Logger) (Members, error) {
-	actor, err := agent.Create(transformConfig(config))
+	agentConfig, serfConfig, logOutput := transformConfig(config)
+	actor, err := agent.Create(agentConfig, serfConfig, logOutput)
 	if err != nil {
 		return nil, err
 	}
@@ -46,6 +54,7 @@ func NewRealMembers(config Config, logger log.Logger) (Members, error) {
 
 	return &realMembers{
 		config:        config,
+		tags:          serfConfig.Tags,
 		agent:         actor,
 		members:       actor.Serf(),
 		eventHandlers: make(map[EventHandler]agent.EventHandler),
@@ -76,13 +85,24 @@ func (r *realMembers) Walk(fn func(PeerInfo) error) error {
 
 		if info, err := decodePeerInfoTag(v.Tags); err == nil {
 			if e := fn(info); e != nil {
-				return err
+				return e
 			}
 		}
 	}
 	return nil
 }
 
+func (r *realMembers) SetTags(tags map[string]string) error {
+	merged := make(map[string]string, len(r.tags)+len(tags))
+	for k, v := range tags {
+		merged[k] = v
+	}
+	for k, v := range r.tags {
+		merged[k] = v
+	}
+	return r.members.SetTags(merged)
+}
+
 func (r *realMembers) Close() error {
 	if err := r.members.Leave(); err != nil {
 		level.Warn(r.logger).Log("err", err)
@@ -120,11 +140,33 @@ func (r *realMembers) DispatchEvent(e Event) error {
 	switch t := e.(type) {
 	case *UserEvent:
 		return r.agent.UserEvent(t.Name, t.Payload, true)
+	case *QueryEvent:
+		return r.query(t)
 	default:
 		return errors.Errorf("Unsupported event type %v", e.Type())
 	}
 }
 
+// query dispatches the query to the cluster, the responses are passed on in
+// the background until the query times out.
+func (r *realMembers) query(e *QueryEvent) error {
+	resp, err := r.agent.Query(e.Name, e.Payload, &serf.QueryParam{
+		FilterNodes: e.Nodes,
+		Timeout:     e.Timeout,
+	})
+	if err != nil {
+		return err
+	}
+	go func() {
+		for v := range resp.ResponseCh() {
+			if e.OnResponse != nil {
+				e.OnResponse(v.From, v.Payload)
+			}
+		}
+	}()
+	return nil
+}
+
 type realMemberList struct {
 	list   *memberlist.Memberlist
 	logger log.Logger
@@ -239,6 +281,9 @@ func transformConfig(config Config) (*agent.Config, *serf.Config, io.Writer) {
 	}
 
 	serfConfig := serf.DefaultConfig()
+	if config.wan {
+		serfConfig.MemberlistConfig = memberlist.DefaultWANConfig()
+	}
 
 	serfConfig.NodeName = config.nodeName
 	serfConfig.MemberlistConfig.BindAddr = config.bindAddr
@@ -247,15 +292,31 @@ func transformConfig(config Config) (*agent.Config, *serf.Config, io.Writer) {
 		serfConfig.MemberlistConfig.AdvertiseAddr = config.advertiseAddr
 		serfConfig.MemberlistConfig.AdvertisePort = config.advertisePort
 	}
+	if config.transport != nil {
+		serfConfig.MemberlistConfig.Transport = config.transport
+	}
 	serfConfig.MemberlistConfig.LogOutput = config.logOutput
 	serfConfig.LogOutput = config.logOutput
 	serfConfig.BroadcastTimeout = config.broadcastTimeout
+	if config.snapshotPath != "" {
+		serfConfig.SnapshotPath = config.snapshotPath
+		// Closing the members leaves the cluster, without rejoining after a
+		// leave the snapshot would be ignored on the next start.
+		serfConfig.RejoinAfterLeave = true
+	}
 	serfConfig.Tags = encodePeerInfoTag(PeerInfo{
-		Name:     config.nodeName,
-		PeerType: config.peerType,
-		APIAddr:  config.apiAddr,
-		APIPort:  config.apiPort,
+		Name:       config.nodeName,
+		PeerType:   config.peerType,
+		APIAddr:    config.apiAddr,
+		APIPort:    config.apiPort,
+		Datacenter: config.datacenter,
 	})
+	if config.weight > 0 {
+		serfConfig.Tags[WeightTag] = strconv.Itoa(config.weight)
+	}
+	if config.hash != "" {
+		serfConfig.Tags[HashTag] = config.hash
+	}
 	serfConfig.Init()
 
 	return agentConfig, serfConfig, config.logOutput
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/pborman/uuid"
@@ -198,4 +199,46 @@ func TestRealMemberList(t *testing.T) {
 			t.Errorf("expected: %d, actual: %d", expected, actual)
 		}
 	})
+
+	t.Run("query", func(t *testing.T) {
+		members, err := NewRealMembers(config, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer members.Close()
+
+		if err := members.RegisterEventHandler(queryResponder{}); err != nil {
+			t.Fatal(err)
+		}
+
+		responses := make(chan string, 1)
+		if err := members.DispatchEvent(&QueryEvent{
+			Name:    "ping",
+			Payload: []byte("ping"),
+			Timeout: time.Second,
+			OnResponse: func(from string, payload []byte) {
+				responses <- string(payload)
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case actual := <-responses:
+			if expected := "pong"; expected != actual {
+				t.Errorf("expected: %s, actual: %s", expected, actual)
+			}
+		case <-time.After(time.Second * 2):
+			t.Fatal("timed out waiting for response")
+		}
+	})
+}
+
+type queryResponder struct{}
+
+func (queryResponder) HandleEvent(e Event) error {
+	if q, ok := e.(*QueryEvent); ok && q.Name == "ping" {
+		return q.Respond([]byte("pong"))
+	}
+	return nil
 }
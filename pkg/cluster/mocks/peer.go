@@ -153,6 +153,18 @@ func (mr *MockPeerMockRecorder) RegisterEventHandler(arg0 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterEventHandler", reflect.TypeOf((*MockPeer)(nil).RegisterEventHandler), arg0)
 }
 
+// SetTags mocks base method
+func (m *MockPeer) SetTags(arg0 map[string]string) error {
+	ret := m.ctrl.Call(m, "SetTags", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetTags indicates an expected call of SetTags
+func (mr *MockPeerMockRecorder) SetTags(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTags", reflect.TypeOf((*MockPeer)(nil).SetTags), arg0)
+}
+
 // State mocks base method
 func (m *MockPeer) State() map[string]interface{} {
 	ret := m.ctrl.Call(m, "State")
@@ -164,3 +176,15 @@ func (m *MockPeer) State() map[string]interface{} {
 func (mr *MockPeerMockRecorder) State() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "State", reflect.TypeOf((*MockPeer)(nil).State))
 }
+
+// Walk mocks base method
+func (m *MockPeer) Walk(arg0 func(members.PeerInfo) error) error {
+	ret := m.ctrl.Call(m, "Walk", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Walk indicates an expected call of Walk
+func (mr *MockPeerMockRecorder) Walk(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Walk", reflect.TypeOf((*MockPeer)(nil).Walk), arg0)
+}
@@ -0,0 +1,315 @@
+package partition
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/hashring"
+	"github.com/pkg/errors"
+)
+
+const (
+	// PlacementPartition places keys on a fixed number of partitions, which
+	// are explicitly assigned to the hosts.
+	PlacementPartition = "partition"
+
+	// DefaultPartitions is the number of partitions the keyspace is split in
+	// to, unless told otherwise.
+	DefaultPartitions = 1024
+)
+
+// Table is the assignment of every partition to its owner, the index of the
+// owner is the partition. The version goes up every time a partition changes
+// owner, so that a newer assignment can be told apart from an older one. The
+// checksum only depends on the owners, so a table can be compared with the
+// table of another node.
+type Table struct {
+	Version  uint64   `json:"version"`
+	Checksum uint32   `json:"checksum"`
+	Owners   []string `json:"owners"`
+}
+
+// Owner returns the owner of the partition.
+// Returns false if the partition doesn't exist or isn't owned by anyone.
+func (t Table) Owner(partition int) (string, bool) {
+	if partition < 0 || partition >= len(t.Owners) || t.Owners[partition] == "" {
+		return "", false
+	}
+	return t.Owners[partition], true
+}
+
+// Partitions returns the partitions owned by the host, in order.
+func (t Table) Partitions(host string) []int {
+	var res []int
+	for k, v := range t.Owners {
+		if v == host {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
+// Partitioner splits the keyspace in to a fixed number of partitions and
+// assigns the partitions to the hosts. Every time the hosts change the
+// partitions are rebalanced, so that each host owns the same number of
+// partitions give or take one, whilst moving as few partitions as possible.
+// Only the partitions of a removed host, or the partitions over the share of
+// a host, ever move.
+//
+// Every host ranks the partitions by hashing the host with the partition,
+// much like rendezvous hashing, which decides the partitions a host gives up
+// and the host a partition moves to. So every node that sees the same
+// changes to the hosts, in the same order, agrees on the owners.
+type Partitioner struct {
+	mtx     sync.RWMutex
+	hashFn  func([]byte) uint64
+	hosts   map[string]struct{}
+	owners  []string
+	version uint64
+}
+
+// New creates a new Partitioner with the number of partitions, which hashes
+// the keys on to the partitions with the hash.
+func New(hashFn func([]byte) uint64, partitions int) (*Partitioner, error) {
+	if partitions < 1 {
+		return nil, errors.Errorf("invalid number of partitions %d", partitions)
+	}
+	return &Partitioner{
+		hashFn: hashFn,
+		hosts:  make(map[string]struct{}),
+		owners: make([]string, partitions),
+	}, nil
+}
+
+// Add a host to the placement, taking its share of the partitions from the
+// hosts that own more than their share.
+// Returns true if the host was added.
+func (p *Partitioner) Add(host string) bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if _, ok := p.hosts[host]; ok {
+		return false
+	}
+	p.hosts[host] = struct{}{}
+	p.rebalance()
+	return true
+}
+
+// Remove a host from the placement, handing its partitions to the hosts that
+// own less than their share.
+// Returns true if the host was removed.
+func (p *Partitioner) Remove(host string) bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if _, ok := p.hosts[host]; !ok {
+		return false
+	}
+	delete(p.hosts, host)
+	p.rebalance()
+	return true
+}
+
+// Partition returns the partition of the key. The hash of the key is mixed
+// first, as not every hash has entropy in its lower bits.
+func (p *Partitioner) Partition(key string) int {
+	return int(hashring.Mix(p.hashFn([]byte(key))) % uint64(len(p.owners)))
+}
+
+// LookupN returns the owner of the partition of the key, followed by the
+// owners of the next partitions. If there are less hosts than N, all the
+// hosts are returned.
+func (p *Partitioner) LookupN(key string, n int) []string {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	if n > len(p.hosts) {
+		n = len(p.hosts)
+	}
+
+	var (
+		res       = make([]string, 0, n)
+		seen      = make(map[string]struct{}, n)
+		partition = p.Partition(key)
+	)
+	for i := 0; i < len(p.owners) && len(res) < n; i++ {
+		owner := p.owners[(partition+i)%len(p.owners)]
+		if _, ok := seen[owner]; ok || owner == "" {
+			continue
+		}
+		seen[owner] = struct{}{}
+		res = append(res, owner)
+	}
+	return res
+}
+
+// Hosts returns the hosts in a sorted slice.
+func (p *Partitioner) Hosts() []string {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	return p.sortedHosts()
+}
+
+// Checksum the placement to verify if there have been any changes. Only the
+// owners are part of the checksum, as the version depends on how many
+// changes a node has seen.
+func (p *Partitioner) Checksum() (uint32, error) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	return p.checksum(), nil
+}
+
+// Table returns a copy of the current assignment of the partitions.
+func (p *Partitioner) Table() Table {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	owners := make([]string, len(p.owners))
+	copy(owners, p.owners)
+	return Table{
+		Version:  p.version,
+		Checksum: p.checksum(),
+		Owners:   owners,
+	}
+}
+
+func (p *Partitioner) checksum() uint32 {
+	return crc32.ChecksumIEEE([]byte(strings.Join(p.owners, ";")))
+}
+
+// rebalance assigns the partitions so that every host owns its share,
+// changing the version if any of the partitions changed owner.
+func (p *Partitioner) rebalance() {
+	if p.assign() {
+		p.version++
+	}
+}
+
+// assign the partitions to the hosts, keeping the partitions that already
+// have an owner where they are. The hosts that already own the most
+// partitions keep the remainder of the partitions that can't be shared
+// evenly, the other hosts over their share give up the partitions they rank
+// the lowest. The free partitions are then handed out to the hosts under
+// their share, from the highest ranked pair of host and partition down.
+// Returns true if any of the partitions changed owner.
+func (p *Partitioner) assign() bool {
+	var (
+		hosts = p.sortedHosts()
+		owned = make(map[string][]int, len(hosts))
+		free  []int
+	)
+	for k, v := range p.owners {
+		if _, ok := p.hosts[v]; ok {
+			owned[v] = append(owned[v], k)
+		} else {
+			free = append(free, k)
+		}
+	}
+
+	if len(hosts) == 0 {
+		var changed bool
+		for _, v := range free {
+			if p.owners[v] != "" {
+				p.owners[v] = ""
+				changed = true
+			}
+		}
+		return changed
+	}
+
+	// Work out the share of each host, the hosts with the most partitions
+	// get the remainder.
+	sort.SliceStable(hosts, func(i, j int) bool {
+		return len(owned[hosts[i]]) > len(owned[hosts[j]])
+	})
+	var (
+		share     = len(p.owners) / len(hosts)
+		remainder = len(p.owners) % len(hosts)
+		quotas    = make(map[string]int, len(hosts))
+	)
+	for k, v := range hosts {
+		quotas[v] = share
+		if k < remainder {
+			quotas[v]++
+		}
+	}
+	sort.Strings(hosts)
+
+	// Release the partitions over the share of each host.
+	var under []string
+	for _, v := range hosts {
+		partitions := owned[v]
+		if over := len(partitions) - quotas[v]; over > 0 {
+			sort.SliceStable(partitions, func(i, j int) bool {
+				return p.score(v, partitions[i]) < p.score(v, partitions[j])
+			})
+			free = append(free, partitions[:over]...)
+			owned[v] = partitions[over:]
+		} else if over < 0 {
+			under = append(under, v)
+		}
+	}
+	if len(free) == 0 {
+		return false
+	}
+	sort.Ints(free)
+
+	type pair struct {
+		host      string
+		partition int
+		score     uint64
+	}
+	pairs := make([]pair, 0, len(under)*len(free))
+	for _, host := range under {
+		for _, partition := range free {
+			pairs = append(pairs, pair{
+				host:      host,
+				partition: partition,
+				score:     p.score(host, partition),
+			})
+		}
+	}
+	// The hosts and the partitions are sorted and the sort is stable, so
+	// pairs with the same score are always in the same order.
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].score > pairs[j].score
+	})
+
+	var (
+		changed  bool
+		assigned = make(map[int]struct{}, len(free))
+	)
+	for _, v := range pairs {
+		if _, ok := assigned[v.partition]; ok || len(owned[v.host]) >= quotas[v.host] {
+			continue
+		}
+		if p.owners[v.partition] != v.host {
+			p.owners[v.partition] = v.host
+			changed = true
+		}
+		owned[v.host] = append(owned[v.host], v.partition)
+		assigned[v.partition] = struct{}{}
+	}
+	return changed
+}
+
+// score ranks the partition for the host, the higher the score the more the
+// host wants the partition.
+func (p *Partitioner) score(host string, partition int) uint64 {
+	return p.hashFn([]byte(host + "/" + strconv.Itoa(partition)))
+}
+
+func (p *Partitioner) sortedHosts() []string {
+	res := make([]string, 0, len(p.hosts))
+	for k := range p.hosts {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,283 @@
+package partition
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/hashring"
+	"github.com/spaolacci/murmur3"
+)
+
+func TestPartitioner(t *testing.T) {
+	t.Parallel()
+
+	build := func(t *testing.T, partitions int, hosts ...string) *Partitioner {
+		p, err := New(murmur3.Sum64, partitions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range hosts {
+			p.Add(v)
+		}
+		return p
+	}
+
+	// Every quick check builds tables of many partitions, so keep the number
+	// of checks down.
+	config := &quick.Config{MaxCount: 20}
+
+	hostNames := func(n uint8) []string {
+		res := make([]string, int(n%16)+1)
+		for k := range res {
+			res[k] = fmt.Sprintf("host-%d", k)
+		}
+		return res
+	}
+
+	t.Run("invalid partitions", func(t *testing.T) {
+		_, err := New(murmur3.Sum64, 0)
+		if expected, actual := false, err == nil; expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+	})
+
+	t.Run("balanced", func(t *testing.T) {
+		fn := func(n uint8, partitions uint16) bool {
+			var (
+				hosts = hostNames(n)
+				p     = build(t, int(partitions%2048)+1, hosts...)
+				table = p.Table()
+			)
+
+			min, max := len(table.Owners), 0
+			for _, v := range hosts {
+				owned := len(table.Partitions(v))
+				if owned < min {
+					min = owned
+				}
+				if owned > max {
+					max = owned
+				}
+			}
+			for k := range table.Owners {
+				if _, ok := table.Owner(k); !ok {
+					return false
+				}
+			}
+			return max-min <= 1
+		}
+		if err := quick.Check(fn, config); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("add moves few partitions", func(t *testing.T) {
+		fn := func(n uint8) bool {
+			var (
+				hosts  = hostNames(n)
+				p      = build(t, DefaultPartitions, hosts...)
+				before = p.Table()
+			)
+			p.Add("new")
+			after := p.Table()
+
+			// Only the share of the new host moves, and it only moves to the
+			// new host.
+			var moved int
+			for k, v := range after.Owners {
+				if v != before.Owners[k] {
+					if v != "new" {
+						return false
+					}
+					moved++
+				}
+			}
+			return moved == len(after.Partitions("new")) &&
+				moved <= DefaultPartitions/(len(hosts)+1)+1
+		}
+		if err := quick.Check(fn, config); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("remove moves few partitions", func(t *testing.T) {
+		fn := func(n uint8) bool {
+			var (
+				hosts   = hostNames(n)
+				p       = build(t, DefaultPartitions, hosts...)
+				before  = p.Table()
+				removed = hosts[0]
+			)
+			p.Remove(removed)
+			after := p.Table()
+
+			// Only the partitions of the removed host move.
+			for k, v := range before.Owners {
+				if v != removed && v != after.Owners[k] {
+					return false
+				}
+			}
+			return len(after.Partitions(removed)) == 0
+		}
+		if err := quick.Check(fn, config); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("balanced after remove", func(t *testing.T) {
+		p := build(t, 10, "a", "b", "c")
+		p.Remove("b")
+		table := p.Table()
+
+		if expected, actual := 5, len(table.Partitions("a")); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := 5, len(table.Partitions("c")); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("version", func(t *testing.T) {
+		p := build(t, 8)
+		if expected, actual := uint64(0), p.Table().Version; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+
+		p.Add("a")
+		p.Add("b")
+		if expected, actual := uint64(2), p.Table().Version; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+
+		// Nothing moves, so the version stays the same.
+		p.Add("a")
+		if expected, actual := uint64(2), p.Table().Version; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+
+		p.Remove("a")
+		if expected, actual := uint64(3), p.Table().Version; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("remove all", func(t *testing.T) {
+		p := build(t, 8, "a", "b")
+		p.Remove("a")
+		p.Remove("b")
+
+		if expected, actual := make([]string, 8), p.Table().Owners; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 0, len(p.LookupN("key", 1)); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("table checksum", func(t *testing.T) {
+		p := build(t, 8, "a", "b")
+		checksum, _ := p.Checksum()
+		if expected, actual := checksum, p.Table().Checksum; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+
+		// Adding a host with the same name doesn't move anything.
+		p.Add("a")
+		if expected, actual := checksum, p.Table().Checksum; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("same changes", func(t *testing.T) {
+		fn := func(n uint8) bool {
+			hosts := hostNames(n)
+			var (
+				a = build(t, DefaultPartitions, hosts...)
+				b = build(t, DefaultPartitions, hosts...)
+			)
+			a.Remove(hosts[0])
+			b.Remove(hosts[0])
+
+			x, _ := a.Checksum()
+			y, _ := b.Checksum()
+			return x == y && reflect.DeepEqual(a.Table(), b.Table())
+		}
+		if err := quick.Check(fn, config); err != nil {
+			t.Error(err)
+		}
+	})
+
+	for _, name := range hashring.Hashes() {
+		name := name
+
+		t.Run(fmt.Sprintf("spread of keys with %s", name), func(t *testing.T) {
+			hashFn, err := hashring.NewHash(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := New(hashFn, DefaultPartitions)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Spreading the keys at random would fill around 630 of the
+			// partitions.
+			partitions := make(map[int]struct{})
+			for i := 0; i < 1000; i++ {
+				partitions[p.Partition(fmt.Sprintf("key-%d", i))] = struct{}{}
+			}
+			if expected, actual := 550, len(partitions); actual < expected {
+				t.Errorf("expected: >= %d, actual: %d", expected, actual)
+			}
+		})
+	}
+
+	t.Run("lookup", func(t *testing.T) {
+		fn := func(n uint8, key string) bool {
+			var (
+				hosts = hostNames(n)
+				p     = build(t, DefaultPartitions, hosts...)
+				res   = p.LookupN(key, 3)
+			)
+
+			owner, _ := p.Table().Owner(p.Partition(key))
+			want := 3
+			if len(hosts) < want {
+				want = len(hosts)
+			}
+			return len(res) == want && res[0] == owner
+		}
+		if err := quick.Check(fn, config); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		var (
+			a = build(t, 16, "a", "b", "c")
+			b = build(t, 16, "a", "b", "c")
+		)
+		x, _ := a.Checksum()
+		y, _ := b.Checksum()
+		if expected, actual := x, y; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+
+		// Only the owners are checksummed, not the version.
+		var (
+			c = build(t, 16, "a")
+			d = build(t, 16, "b", "a")
+		)
+		d.Remove("b")
+		x, _ = c.Checksum()
+		y, _ = d.Checksum()
+		if expected, actual := x, y; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := c.Table().Version, d.Table().Version; expected == actual {
+			t.Errorf("expected: different versions, actual: %d", actual)
+		}
+	})
+}
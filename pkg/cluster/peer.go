@@ -108,6 +108,14 @@ func (p *peer) Current(peerType members.PeerType) (map[members.PeerType][]string
 	})
 }
 
+func (p *peer) Walk(fn func(members.PeerInfo) error) error {
+	return p.members.Walk(fn)
+}
+
+func (p *peer) SetTags(tags map[string]string) error {
+	return p.members.SetTags(tags)
+}
+
 func (p *peer) RegisterEventHandler(fn members.EventHandler) error {
 	return p.members.RegisterEventHandler(fn)
 }
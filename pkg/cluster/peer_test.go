@@ -274,10 +274,10 @@ func (m funcMatcher) Matches(x interface{}) bool {
 	if fn, ok := x.(func(members.PeerInfo) error); ok {
 		for _, v := range m.hosts {
 			if err := fn(members.PeerInfo{
-				Type:    PeerTypeAny,
-				Name:    uuid.New(),
-				APIAddr: v,
-				APIPort: 8080,
+				PeerType: PeerTypeAny,
+				Name:     uuid.New(),
+				APIAddr:  v,
+				APIPort:  8080,
 			}); err != nil {
 				panic(err)
 			}
@@ -5,8 +5,11 @@
 package mocks
 
 import (
+	hashring "github.com/SimonRichardson/alchemy/pkg/cluster/hashring"
+	partition "github.com/SimonRichardson/alchemy/pkg/cluster/partition"
 	registry "github.com/SimonRichardson/alchemy/pkg/cluster/registry"
 	gomock "github.com/golang/mock/gomock"
+	io "io"
 	reflect "reflect"
 )
 
@@ -45,6 +48,93 @@ func (mr *MockRegistryMockRecorder) Add(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockRegistry)(nil).Add), arg0)
 }
 
+// Checksums mocks base method
+func (m *MockRegistry) Checksums() map[string]uint32 {
+	ret := m.ctrl.Call(m, "Checksums")
+	ret0, _ := ret[0].(map[string]uint32)
+	return ret0
+}
+
+// Checksums indicates an expected call of Checksums
+func (mr *MockRegistryMockRecorder) Checksums() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Checksums", reflect.TypeOf((*MockRegistry)(nil).Checksums))
+}
+
+// DeregisterDiffHandler mocks base method
+func (m *MockRegistry) DeregisterDiffHandler(arg0 registry.DiffHandler) error {
+	ret := m.ctrl.Call(m, "DeregisterDiffHandler", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeregisterDiffHandler indicates an expected call of DeregisterDiffHandler
+func (mr *MockRegistryMockRecorder) DeregisterDiffHandler(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeregisterDiffHandler", reflect.TypeOf((*MockRegistry)(nil).DeregisterDiffHandler), arg0)
+}
+
+// Info mocks base method
+func (m *MockRegistry) Info(arg0 string) (registry.Info, bool) {
+	ret := m.ctrl.Call(m, "Info", arg0)
+	ret0, _ := ret[0].(registry.Info)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// Info indicates an expected call of Info
+func (mr *MockRegistryMockRecorder) Info(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Info", reflect.TypeOf((*MockRegistry)(nil).Info), arg0)
+}
+
+// Lookup mocks base method
+func (m *MockRegistry) Lookup(arg0 string, arg1 string, arg2 int) ([]registry.Key, bool) {
+	ret := m.ctrl.Call(m, "Lookup", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]registry.Key)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// Lookup indicates an expected call of Lookup
+func (mr *MockRegistryMockRecorder) Lookup(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Lookup", reflect.TypeOf((*MockRegistry)(nil).Lookup), arg0, arg1, arg2)
+}
+
+// LookupSpread mocks base method
+func (m *MockRegistry) LookupSpread(arg0 string, arg1 string, arg2 int, arg3 string) ([]registry.Key, bool) {
+	ret := m.ctrl.Call(m, "LookupSpread", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]registry.Key)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// LookupSpread indicates an expected call of LookupSpread
+func (mr *MockRegistryMockRecorder) LookupSpread(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LookupSpread", reflect.TypeOf((*MockRegistry)(nil).LookupSpread), arg0, arg1, arg2, arg3)
+}
+
+// Partitions mocks base method
+func (m *MockRegistry) Partitions() map[string]partition.Table {
+	ret := m.ctrl.Call(m, "Partitions")
+	ret0, _ := ret[0].(map[string]partition.Table)
+	return ret0
+}
+
+// Partitions indicates an expected call of Partitions
+func (mr *MockRegistryMockRecorder) Partitions() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Partitions", reflect.TypeOf((*MockRegistry)(nil).Partitions))
+}
+
+// RegisterDiffHandler mocks base method
+func (m *MockRegistry) RegisterDiffHandler(arg0 registry.DiffHandler, arg1 int) error {
+	ret := m.ctrl.Call(m, "RegisterDiffHandler", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RegisterDiffHandler indicates an expected call of RegisterDiffHandler
+func (mr *MockRegistryMockRecorder) RegisterDiffHandler(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterDiffHandler", reflect.TypeOf((*MockRegistry)(nil).RegisterDiffHandler), arg0, arg1)
+}
+
 // Remove mocks base method
 func (m *MockRegistry) Remove(arg0 registry.Key) bool {
 	ret := m.ctrl.Call(m, "Remove", arg0)
@@ -57,6 +147,55 @@ func (mr *MockRegistryMockRecorder) Remove(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockRegistry)(nil).Remove), arg0)
 }
 
+// Replicas mocks base method
+func (m *MockRegistry) Replicas() int {
+	ret := m.ctrl.Call(m, "Replicas")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Replicas indicates an expected call of Replicas
+func (mr *MockRegistryMockRecorder) Replicas() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Replicas", reflect.TypeOf((*MockRegistry)(nil).Replicas))
+}
+
+// Restore mocks base method
+func (m *MockRegistry) Restore(arg0 io.Reader) ([]registry.Key, error) {
+	ret := m.ctrl.Call(m, "Restore", arg0)
+	ret0, _ := ret[0].([]registry.Key)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Restore indicates an expected call of Restore
+func (mr *MockRegistryMockRecorder) Restore(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restore", reflect.TypeOf((*MockRegistry)(nil).Restore), arg0)
+}
+
+// Snapshot mocks base method
+func (m *MockRegistry) Snapshot(arg0 io.Writer) error {
+	ret := m.ctrl.Call(m, "Snapshot", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Snapshot indicates an expected call of Snapshot
+func (mr *MockRegistryMockRecorder) Snapshot(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Snapshot", reflect.TypeOf((*MockRegistry)(nil).Snapshot), arg0)
+}
+
+// Stats mocks base method
+func (m *MockRegistry) Stats() map[string]hashring.Stats {
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(map[string]hashring.Stats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats
+func (mr *MockRegistryMockRecorder) Stats() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockRegistry)(nil).Stats))
+}
+
 // Update mocks base method
 func (m *MockRegistry) Update(arg0 registry.Key) bool {
 	ret := m.ctrl.Call(m, "Update", arg0)
@@ -1,60 +1,105 @@
 package registry
 
 import (
+	"strconv"
 	"sync"
 
 	"github.com/SimonRichardson/alchemy/pkg/cluster/hashring"
 	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/partition"
+	"github.com/pkg/errors"
 )
 
+// DefaultReplicas is the number of keys that own a given key, when a lookup
+// doesn't ask for a number of keys.
+const DefaultReplicas = 1
+
 type real struct {
-	mtx               sync.RWMutex
-	hashRings         map[string]*hashring.HashRing
-	keys              map[string]map[string]Key
-	hashFn            func([]byte) uint32
-	replicationFactor int
+	mtx          sync.RWMutex
+	placements   map[string]hashring.Placement
+	keys         map[string]map[string]Key
+	placementFn  PlacementFn
+	replicas     int
+	diffHandlers map[DiffHandler]int
 }
 
-func New(hashFn func([]byte) uint32, replicationFactor int) Registry {
-	return &real{
-		hashRings:         make(map[string]*hashring.HashRing),
-		keys:              make(map[string]map[string]Key),
-		hashFn:            hashFn,
-		replicationFactor: replicationFactor,
+// PlacementFn creates the Placement for a key type.
+type PlacementFn func(keyType string) hashring.Placement
+
+// Option defines a option for configuring a Registry
+type Option func(*real)
+
+// WithReplicas sets the number of keys that own a given key, when a lookup
+// doesn't ask for a number of keys. Not to be confused with the number of
+// virtual nodes of a HashRing, which only changes how evenly the keys are
+// spread.
+func WithReplicas(replicas int) Option {
+	return func(r *real) {
+		r.replicas = replicas
 	}
 }
 
+// New creates a Registry that places the keys of every key type on a
+// HashRing, with the number of virtual nodes per key.
+func New(hashFn func([]byte) uint64, vnodes int, opts ...Option) Registry {
+	return NewWithPlacement(func(string) hashring.Placement {
+		return hashring.New(hashFn, vnodes)
+	}, opts...)
+}
+
+// NewWithPlacement creates a Registry that places the keys of each key type
+// using the Placement from the PlacementFn.
+func NewWithPlacement(fn PlacementFn, opts ...Option) Registry {
+	r := &real{
+		placements:   make(map[string]hashring.Placement),
+		keys:         make(map[string]map[string]Key),
+		placementFn:  fn,
+		replicas:     DefaultReplicas,
+		diffHandlers: make(map[DiffHandler]int),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
 func (r *real) Add(key Key) bool {
 	r.mtx.Lock()
-	defer r.mtx.Unlock()
 
 	keyType := key.Type()
-	if _, ok := r.hashRings[keyType]; !ok {
-		r.hashRings[keyType] = hashring.New(r.hashFn, r.replicationFactor)
+	if _, ok := r.placements[keyType]; !ok {
+		r.placements[keyType] = r.placementFn(keyType)
 	}
+	defer r.unlockWithDiff(keyType, r.cloneHashRing(keyType))
 
 	var (
 		addr = key.Address()
-		res  = r.hashRings[keyType].Add(addr)
+		res  bool
 	)
+	if weighted, ok := r.placements[keyType].(hashring.Weighted); ok {
+		res = weighted.AddWeighted(addr, keyWeight(key))
+	} else {
+		res = r.placements[keyType].Add(addr)
+	}
 	if _, ok := r.keys[addr]; !ok {
 		r.keys[addr] = make(map[string]Key)
 	}
 	r.keys[addr][key.Name()] = key
+	r.setTags(keyType, addr, key.Tags())
 
 	return res
 }
 
 func (r *real) Remove(key Key) bool {
 	r.mtx.Lock()
-	defer r.mtx.Unlock()
+	defer r.unlockWithDiff(key.Type(), r.cloneHashRing(key.Type()))
 
 	var (
 		keyType = key.Type()
 		addr    = key.Address()
 	)
-	if _, ok := r.hashRings[keyType]; ok {
-		r.hashRings[keyType].Remove(addr)
+	if _, ok := r.placements[keyType]; ok {
+		r.placements[keyType].Remove(addr)
 	}
 	if keys, ok := r.keys[addr]; ok {
 		delete(keys, key.Name())
@@ -64,13 +109,13 @@ func (r *real) Remove(key Key) bool {
 
 func (r *real) Update(key Key) bool {
 	r.mtx.Lock()
-	defer r.mtx.Unlock()
+	defer r.unlockWithDiff(key.Type(), r.cloneHashRing(key.Type()))
 
 	var (
 		keyType = key.Type()
 		addr    = key.Address()
 	)
-	if _, ok := r.hashRings[keyType]; !ok || (ok && !r.hashRings[keyType].Contains(addr)) {
+	if _, ok := r.placements[keyType]; !ok || (ok && !contains(r.placements[keyType], addr)) {
 		return false
 	}
 
@@ -83,6 +128,12 @@ func (r *real) Update(key Key) bool {
 		return false
 	}
 	r.keys[addr][name] = key
+	r.setTags(keyType, addr, key.Tags())
+
+	// Re-weighting to the same weight leaves the placement untouched.
+	if weighted, ok := r.placements[keyType].(hashring.Weighted); ok {
+		weighted.Update(addr, keyWeight(key))
+	}
 
 	return true
 }
@@ -91,23 +142,31 @@ func (r *real) Info(s string) (Info, bool) {
 	r.mtx.RLock()
 	defer r.mtx.RUnlock()
 
-	hashRing, ok := r.hashRings[s]
+	placement, ok := r.placements[s]
 	if !ok {
 		return Info{}, false
 	}
 
+	// Only the placements that are rings have hashes, for the rest the hosts
+	// are used as the hashes.
 	hashes := make(map[string]string)
-	if err := hashRing.Walk(func(hash, addr string) error {
-		hashes[hash] = addr
-		return nil
-	}); err != nil {
-		return Info{}, false
+	if walker, ok := placement.(hashring.Walker); ok {
+		if err := walker.Walk(func(hash, addr string) error {
+			hashes[hash] = addr
+			return nil
+		}); err != nil {
+			return Info{}, false
+		}
+	} else {
+		for _, v := range placement.Hosts() {
+			hashes[v] = v
+		}
 	}
 
 	keys := make(map[string][]Key)
 	for _, v := range hashes {
 		if k := r.getKeysByAddress(v); len(k) > 0 {
-			keys[v] = append(keys[v], k...)
+			keys[v] = k
 		}
 	}
 
@@ -117,6 +176,151 @@ func (r *real) Info(s string) (Info, bool) {
 	}, true
 }
 
+func (r *real) Lookup(keyType, key string, n int) ([]Key, bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	placement, ok := r.placements[keyType]
+	if !ok {
+		return nil, false
+	}
+
+	return r.getKeysByAddresses(keyType, placement.LookupN(key, n)), true
+}
+
+func (r *real) LookupSpread(keyType, key string, n int, tagKey string) ([]Key, bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	placement, ok := r.placements[keyType]
+	if !ok {
+		return nil, false
+	}
+
+	// Only a HashRing knows how to spread the keys, every other placement
+	// falls back to a plain lookup.
+	var addrs []string
+	if hashRing, ok := placement.(*hashring.HashRing); ok {
+		addrs = hashRing.LookupNSpread(key, n, tagKey)
+	} else {
+		addrs = placement.LookupN(key, n)
+	}
+	return r.getKeysByAddresses(keyType, addrs), true
+}
+
+func (r *real) Replicas() int {
+	return r.replicas
+}
+
+func (r *real) Stats() map[string]hashring.Stats {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	res := make(map[string]hashring.Stats)
+	for k, v := range r.placements {
+		if hashRing, ok := v.(*hashring.HashRing); ok {
+			res[k] = hashRing.Stats()
+		}
+	}
+	return res
+}
+
+func (r *real) Checksums() map[string]uint32 {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	res := make(map[string]uint32, len(r.placements))
+	for k, v := range r.placements {
+		if checksum, err := v.Checksum(); err == nil {
+			res[k] = checksum
+		}
+	}
+	return res
+}
+
+func (r *real) Partitions() map[string]partition.Table {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	res := make(map[string]partition.Table)
+	for k, v := range r.placements {
+		if partitioner, ok := v.(*partition.Partitioner); ok {
+			res[k] = partitioner.Table()
+		}
+	}
+	return res
+}
+
+func (r *real) RegisterDiffHandler(fn DiffHandler, n int) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if n < 1 {
+		return errors.Errorf("invalid number of replicas %d", n)
+	}
+	r.diffHandlers[fn] = n
+	return nil
+}
+
+func (r *real) DeregisterDiffHandler(fn DiffHandler) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	delete(r.diffHandlers, fn)
+	return nil
+}
+
+// cloneHashRing clones the HashRing of a key type before it's changed, so
+// that it can be diffed after the change. Nothing is cloned if there are no
+// diff handlers or the placement isn't a HashRing.
+func (r *real) cloneHashRing(keyType string) *hashring.HashRing {
+	if len(r.diffHandlers) == 0 {
+		return nil
+	}
+	if hashRing, ok := r.placements[keyType].(*hashring.HashRing); ok {
+		return hashRing.Clone()
+	}
+	return nil
+}
+
+// unlockWithDiff diffs the HashRing of a key type against the HashRing from
+// before the change, then unlocks the registry before dispatching the
+// changes, so that a handler can query the registry.
+func (r *real) unlockWithDiff(keyType string, before *hashring.HashRing) {
+	changes := make(map[DiffHandler][]hashring.RangeChange)
+	if after, ok := r.placements[keyType].(*hashring.HashRing); ok && before != nil {
+		for fn, n := range r.diffHandlers {
+			if c := hashring.DiffN(before, after, n); len(c) > 0 {
+				changes[fn] = c
+			}
+		}
+	}
+	r.mtx.Unlock()
+
+	for fn, c := range changes {
+		fn.HandleDiff(keyType, c)
+	}
+}
+
+// setTags sets the tags of an address on the HashRing of a key type, so that
+// lookups can be spread by the tags.
+func (r *real) setTags(keyType, addr string, tags map[string]string) {
+	if hashRing, ok := r.placements[keyType].(*hashring.HashRing); ok {
+		hashRing.SetTags(addr, tags)
+	}
+}
+
+func (r *real) getKeysByAddresses(keyType string, addrs []string) (res []Key) {
+	for _, addr := range addrs {
+		for _, k := range r.getKeysByAddress(addr) {
+			if k.Type() == keyType {
+				res = append(res, k)
+			}
+		}
+	}
+	return
+}
+
 func (r *real) getKeysByAddress(addr string) (res []Key) {
 	if keys, ok := r.keys[addr]; ok {
 		for _, v := range keys {
@@ -126,6 +330,26 @@ func (r *real) getKeysByAddress(addr string) (res []Key) {
 	return
 }
 
+func contains(placement hashring.Placement, addr string) bool {
+	for _, v := range placement.Hosts() {
+		if v == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// keyWeight returns the weight of the key from the tags, any key without a
+// valid weight has a weight of 1.
+func keyWeight(key Key) int {
+	if v, ok := key.Tags()[members.WeightTag]; ok {
+		if weight, err := strconv.Atoi(v); err == nil && weight > 0 {
+			return weight
+		}
+	}
+	return 1
+}
+
 type key struct {
 	member members.Member
 }
@@ -0,0 +1,222 @@
+package registry
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/hashring"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/partition"
+	"github.com/spaolacci/murmur3"
+)
+
+func TestRegistryWeight(t *testing.T) {
+	t.Parallel()
+
+	t.Run("add", func(t *testing.T) {
+		reg := New(murmur3.Sum64, 3)
+		reg.Add(weightedKey("a", "2"))
+
+		info, _ := reg.Info("peertype:registry")
+		if expected, actual := 6, len(info.Hashes); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("add invalid weight", func(t *testing.T) {
+		reg := New(murmur3.Sum64, 3)
+		reg.Add(weightedKey("a", "bad"))
+
+		info, _ := reg.Info("peertype:registry")
+		if expected, actual := 3, len(info.Hashes); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		reg := New(murmur3.Sum64, 3)
+		reg.Add(weightedKey("a", "1"))
+
+		if expected, actual := true, reg.Update(weightedKey("a", "4")); expected != actual {
+			t.Fatalf("expected: %t, actual: %t", expected, actual)
+		}
+
+		info, _ := reg.Info("peertype:registry")
+		if expected, actual := 12, len(info.Hashes); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+}
+
+func TestRegistryDiff(t *testing.T) {
+	t.Parallel()
+
+	t.Run("add", func(t *testing.T) {
+		var (
+			reg     = New(murmur3.Sum64, 3)
+			handler = &diffHandler{}
+		)
+		if err := reg.RegisterDiffHandler(handler, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		reg.Add(addressKey("a", "10.0.0.1:8079"))
+		reg.Add(addressKey("b", "10.0.0.2:8079"))
+
+		if expected, actual := 2, len(handler.changes); expected != actual {
+			t.Fatalf("expected: %d, actual: %d", expected, actual)
+		}
+		for _, v := range handler.changes[1] {
+			if expected, actual := []string{"10.0.0.2:8079"}, v.To; !reflect.DeepEqual(expected, actual) {
+				t.Errorf("expected: %v, actual: %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("deregister", func(t *testing.T) {
+		var (
+			reg     = New(murmur3.Sum64, 3)
+			handler = &diffHandler{}
+		)
+		reg.RegisterDiffHandler(handler, 1)
+		reg.DeregisterDiffHandler(handler)
+
+		reg.Add(addressKey("a", "10.0.0.1:8079"))
+
+		if expected, actual := 0, len(handler.changes); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("invalid replicas", func(t *testing.T) {
+		reg := New(murmur3.Sum64, 3)
+
+		err := reg.RegisterDiffHandler(&diffHandler{}, 0)
+
+		if expected, actual := false, err == nil; expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+	})
+}
+
+func TestRegistryStats(t *testing.T) {
+	t.Parallel()
+
+	reg := New(murmur3.Sum64, 3)
+	reg.Add(addressKey("a", "10.0.0.1:8079"))
+	reg.Add(addressKey("b", "10.0.0.2:8079"))
+
+	stats, ok := reg.Stats()["peertype:registry"]
+	if expected, actual := true, ok; expected != actual {
+		t.Fatalf("expected: %t, actual: %t", expected, actual)
+	}
+	if expected, actual := 2, stats.Hosts; expected != actual {
+		t.Errorf("expected: %d, actual: %d", expected, actual)
+	}
+}
+
+func TestRegistryReplicas(t *testing.T) {
+	t.Parallel()
+
+	t.Run("default", func(t *testing.T) {
+		if expected, actual := DefaultReplicas, New(murmur3.Sum64, 10).Replicas(); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("independent of vnodes", func(t *testing.T) {
+		reg := New(murmur3.Sum64, 10, WithReplicas(2))
+		reg.Add(addressKey("a", "10.0.0.1:8079"))
+		reg.Add(addressKey("b", "10.0.0.2:8079"))
+		reg.Add(addressKey("c", "10.0.0.3:8079"))
+
+		keys, ok := reg.Lookup("peertype:registry", "key", reg.Replicas())
+		if expected, actual := true, ok; expected != actual {
+			t.Fatalf("expected: %t, actual: %t", expected, actual)
+		}
+		if expected, actual := 2, len(keys); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+}
+
+func TestRegistryPartitions(t *testing.T) {
+	t.Parallel()
+
+	reg := NewWithPlacement(func(string) hashring.Placement {
+		p, _ := partition.New(murmur3.Sum64, 8)
+		return p
+	})
+	reg.Add(addressKey("a", "10.0.0.1:8079"))
+	reg.Add(addressKey("b", "10.0.0.2:8079"))
+
+	table, ok := reg.Partitions()["peertype:registry"]
+	if expected, actual := true, ok; expected != actual {
+		t.Fatalf("expected: %t, actual: %t", expected, actual)
+	}
+	if expected, actual := 8, len(table.Owners); expected != actual {
+		t.Errorf("expected: %d, actual: %d", expected, actual)
+	}
+	if expected, actual := uint64(2), table.Version; expected != actual {
+		t.Errorf("expected: %d, actual: %d", expected, actual)
+	}
+	if expected, actual := 4, len(table.Partitions("10.0.0.2:8079")); expected != actual {
+		t.Errorf("expected: %d, actual: %d", expected, actual)
+	}
+
+	// Only partitioned key types have an assignment.
+	if expected, actual := 0, len(New(murmur3.Sum64, 3).Partitions()); expected != actual {
+		t.Errorf("expected: %d, actual: %d", expected, actual)
+	}
+}
+
+func TestRegistryLookupSpread(t *testing.T) {
+	t.Parallel()
+
+	reg := New(murmur3.Sum64, 10)
+	for i, zone := range []string{"a", "a", "a", "b"} {
+		reg.Add(snapshotKey{
+			KeyName:    fmt.Sprintf("node-%d", i),
+			KeyType:    "peertype:registry",
+			KeyAddress: fmt.Sprintf("10.0.0.%d:8079", i+1),
+			KeyTags:    map[string]string{"zone": zone},
+		})
+	}
+
+	keys, ok := reg.LookupSpread("peertype:registry", "key", 2, "zone")
+	if expected, actual := true, ok; expected != actual {
+		t.Fatalf("expected: %t, actual: %t", expected, actual)
+	}
+	if expected, actual := 2, len(keys); expected != actual {
+		t.Fatalf("expected: %d, actual: %d", expected, actual)
+	}
+	if keys[0].Tags()["zone"] == keys[1].Tags()["zone"] {
+		t.Errorf("expected: different zones, actual: %q", keys[0].Tags()["zone"])
+	}
+}
+
+type diffHandler struct {
+	changes [][]hashring.RangeChange
+}
+
+func (h *diffHandler) HandleDiff(keyType string, changes []hashring.RangeChange) {
+	h.changes = append(h.changes, changes)
+}
+
+func addressKey(name, addr string) Key {
+	return snapshotKey{
+		KeyName:    name,
+		KeyType:    "peertype:registry",
+		KeyAddress: addr,
+	}
+}
+
+func weightedKey(name, weight string) Key {
+	return snapshotKey{
+		KeyName:    name,
+		KeyType:    "peertype:registry",
+		KeyAddress: "10.0.0.1:8079",
+		KeyTags:    map[string]string{members.WeightTag: weight},
+	}
+}
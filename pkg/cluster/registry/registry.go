@@ -2,6 +2,13 @@
 
 package registry
 
+import (
+	"io"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/hashring"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/partition"
+)
+
 type Key interface {
 
 	// Name returns the registry key
@@ -36,10 +43,59 @@ type Registry interface {
 	// Info returns back the information for a particular key type
 	// Returns true if the information is available
 	Info(string) (Info, bool)
+
+	// Lookup returns the N keys of a key type that own the given key.
+	// Returns true if the key type is available
+	Lookup(string, string, int) ([]Key, bool)
+
+	// LookupSpread returns the N keys of a key type that own the given key,
+	// spread across the distinct values of a tag where possible.
+	// Returns true if the key type is available
+	LookupSpread(string, string, int, string) ([]Key, bool)
+
+	// Replicas returns the number of keys that own a given key, for lookups
+	// that don't ask for a number of keys.
+	Replicas() int
+
+	// Snapshot writes all the keys of the registry to the writer, so that
+	// the registry can be restored at a later date.
+	Snapshot(io.Writer) error
+
+	// Restore adds all the keys from a snapshot to the registry.
+	// Returns the keys that were restored.
+	Restore(io.Reader) ([]Key, error)
+
+	// RegisterDiffHandler attaches a handler that receives the ranges that
+	// moved between the N replicas of a key type, every time the members of
+	// the key type change. Only key types that are placed on a HashRing have
+	// ranges.
+	RegisterDiffHandler(DiffHandler, int) error
+
+	// DeregisterDiffHandler removes the handler.
+	DeregisterDiffHandler(DiffHandler) error
+
+	// Stats returns how balanced the ownership is for each key type. Only key
+	// types that are placed on a HashRing have statistics.
+	Stats() map[string]hashring.Stats
+
+	// Checksums returns the checksum of the placement for each key type, so
+	// that the placements can be compared across the cluster.
+	Checksums() map[string]uint32
+
+	// Partitions returns the assignment of the partitions for each key type.
+	// Only key types that are placed on partitions have an assignment.
+	Partitions() map[string]partition.Table
+}
+
+// DiffHandler receives the ranges that moved for a key type.
+type DiffHandler interface {
+	HandleDiff(string, []hashring.RangeChange)
 }
 
 // Info represents information for a registry key type
 type Info struct {
+	// Hashes of the placement to the address, placements that don't place
+	// addresses on hashes use the address as the hash.
 	Hashes map[string]string
 	Keys   map[string][]Key
 }
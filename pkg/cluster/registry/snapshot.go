@@ -0,0 +1,67 @@
+package registry
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// snapshotVersion is the version of the snapshot format, which allows the
+// format to change without restoring garbage.
+const snapshotVersion = 1
+
+type snapshot struct {
+	Version int           `json:"version"`
+	Keys    []snapshotKey `json:"keys"`
+}
+
+// snapshotKey is a copy of a key at the point the snapshot was taken.
+type snapshotKey struct {
+	KeyName    string            `json:"name"`
+	KeyType    string            `json:"type"`
+	KeyAddress string            `json:"address"`
+	KeyTags    map[string]string `json:"tags,omitempty"`
+}
+
+func (k snapshotKey) Name() string            { return k.KeyName }
+func (k snapshotKey) Type() string            { return k.KeyType }
+func (k snapshotKey) Address() string         { return k.KeyAddress }
+func (k snapshotKey) Tags() map[string]string { return k.KeyTags }
+
+func (r *real) Snapshot(w io.Writer) error {
+	r.mtx.RLock()
+	s := snapshot{
+		Version: snapshotVersion,
+	}
+	for _, keys := range r.keys {
+		for _, v := range keys {
+			s.Keys = append(s.Keys, snapshotKey{
+				KeyName:    v.Name(),
+				KeyType:    v.Type(),
+				KeyAddress: v.Address(),
+				KeyTags:    v.Tags(),
+			})
+		}
+	}
+	r.mtx.RUnlock()
+
+	return json.NewEncoder(w).Encode(s)
+}
+
+func (r *real) Restore(rd io.Reader) ([]Key, error) {
+	var s snapshot
+	if err := json.NewDecoder(rd).Decode(&s); err != nil {
+		return nil, errors.Wrap(err, "decoding snapshot")
+	}
+	if s.Version != snapshotVersion {
+		return nil, errors.Errorf("unexpected snapshot version %d", s.Version)
+	}
+
+	res := make([]Key, len(s.Keys))
+	for k, v := range s.Keys {
+		r.Add(v)
+		res[k] = v
+	}
+	return res, nil
+}
@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spaolacci/murmur3"
+)
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+
+	t.Run("restore", func(t *testing.T) {
+		var (
+			src = New(murmur3.Sum64, 3)
+			dst = New(murmur3.Sum64, 3)
+			buf = new(bytes.Buffer)
+		)
+
+		key := snapshotKey{
+			KeyName:    "a",
+			KeyType:    "peertype:registry",
+			KeyAddress: "10.0.0.1:8079",
+			KeyTags:    map[string]string{"zone": "eu"},
+		}
+		src.Add(key)
+
+		if err := src.Snapshot(buf); err != nil {
+			t.Fatal(err)
+		}
+		restored, err := dst.Restore(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := []Key{key}, restored; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		keys, ok := dst.Lookup("peertype:registry", "key", 1)
+		if expected, actual := true, ok; expected != actual {
+			t.Fatalf("expected: %t, actual: %t", expected, actual)
+		}
+		if expected, actual := []Key{key}, keys; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("restore invalid version", func(t *testing.T) {
+		reg := New(murmur3.Sum64, 3)
+
+		_, err := reg.Restore(strings.NewReader(`{"version":0}`))
+
+		if expected, actual := false, err == nil; expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+	})
+}
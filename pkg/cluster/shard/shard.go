@@ -0,0 +1,536 @@
+package shard
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/hashring"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/spaolacci/murmur3"
+)
+
+const (
+	// RequestQueryName is the name of the query that a new owner sends to the
+	// previous owner to ask for a shard. The previous owner only responds once
+	// it has released the shard, or straight away if it doesn't hold the
+	// shard.
+	RequestQueryName = "shard:request"
+)
+
+const (
+	defaultVNodes         = 50
+	defaultInterval       = time.Second
+	defaultHandoffTimeout = time.Second * 30
+)
+
+// Handler is notified when the local node acquires or releases a shard. A
+// shard isn't acquired or released if the handler returns an error, instead
+// it's tried again a little later.
+type Handler interface {
+
+	// OnAcquire is called when the local node becomes the owner of the shard.
+	OnAcquire(shard int) error
+
+	// OnRelease is called when the local node stops being the owner of the
+	// shard.
+	OnRelease(shard int) error
+}
+
+// HandlerFuncs adapts a pair of functions in to a Handler.
+type HandlerFuncs struct {
+	Acquire func(int) error
+	Release func(int) error
+}
+
+// OnAcquire calls the acquire function.
+func (h HandlerFuncs) OnAcquire(shard int) error {
+	return h.Acquire(shard)
+}
+
+// OnRelease calls the release function.
+func (h HandlerFuncs) OnRelease(shard int) error {
+	return h.Release(shard)
+}
+
+// Option defines a option for configuring a Manager
+type Option func(*Manager)
+
+// WithHash sets the hash used to place the shards on the ring, every node
+// must use the same hash.
+func WithHash(hashFn func([]byte) uint64) Option {
+	return func(m *Manager) {
+		m.hashFn = hashFn
+	}
+}
+
+// WithVNodes sets the number of virtual nodes each peer has on the ring.
+func WithVNodes(vnodes int) Option {
+	return func(m *Manager) {
+		m.vnodes = vnodes
+	}
+}
+
+// WithInterval sets how often the ownership of the shards is checked,
+// regardless of any changes to the members.
+func WithInterval(interval time.Duration) Option {
+	return func(m *Manager) {
+		m.interval = interval
+	}
+}
+
+// WithHandoffTimeout sets how long a node waits for the previous owner to
+// release a shard, before warning that the handoff is stuck. The node keeps
+// on waiting after the timeout, as the shard is only ever acquired without
+// being released if the previous owner has left or failed.
+func WithHandoffTimeout(timeout time.Duration) Option {
+	return func(m *Manager) {
+		m.handoffTimeout = timeout
+	}
+}
+
+// WithClock sets the clock the Manager uses to time the handoffs, which has to
+// be the same clock the members use for the deadlines of the queries.
+func WithClock(now func() time.Time) Option {
+	return func(m *Manager) {
+		m.now = now
+	}
+}
+
+// Manager decides which shards the local node owns, by placing the shards on
+// a ring of the peers of a type. When the owner of a shard changes, the new
+// owner queries the previous owner for the shard and waits for the response,
+// which is only sent once the shard is released, before acquiring it. That
+// way a shard is never owned by two nodes at once. The shard is only acquired
+// without a response if the previous owner has left or failed.
+type Manager struct {
+	peer           cluster.Peer
+	peerType       members.PeerType
+	shards         int
+	handler        Handler
+	hashFn         func([]byte) uint64
+	vnodes         int
+	interval       time.Duration
+	handoffTimeout time.Duration
+	now            func() time.Time
+	changed        chan struct{}
+	stop           chan chan struct{}
+	logger         log.Logger
+
+	mtx      sync.RWMutex
+	owned    map[int]struct{}
+	notices  map[int]notice
+	requests map[int][]*members.QueryEvent
+
+	// The previous hosts and the pending handoffs are only used by the
+	// reconcile loop.
+	previous []string
+	pending  map[int]handoff
+}
+
+// NewManager creates a Manager for the number of shards, which are placed on
+// the peers of the peer type.
+func NewManager(peer cluster.Peer,
+	peerType members.PeerType,
+	shards int,
+	handler Handler,
+	logger log.Logger,
+	opts ...Option,
+) *Manager {
+	m := &Manager{
+		peer:           peer,
+		peerType:       peerType,
+		shards:         shards,
+		handler:        handler,
+		hashFn:         murmur3.Sum64,
+		vnodes:         defaultVNodes,
+		interval:       defaultInterval,
+		handoffTimeout: defaultHandoffTimeout,
+		now:            time.Now,
+		changed:        make(chan struct{}, 1),
+		stop:           make(chan chan struct{}),
+		logger:         logger,
+		owned:          make(map[int]struct{}),
+		notices:        make(map[int]notice),
+		requests:       make(map[int][]*members.QueryEvent),
+		pending:        make(map[int]handoff),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Run the Manager until Stop is called. Once stopped every shard the local
+// node owns is released.
+func (m *Manager) Run() error {
+	if err := m.peer.RegisterEventHandler(m); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.reconcile(m.now()); err != nil {
+			level.Warn(m.logger).Log("reason", "reconcile shards", "err", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-m.changed:
+
+		case c := <-m.stop:
+			defer close(c)
+
+			m.releaseAll()
+			return m.peer.DeregisterEventHandler(m)
+		}
+	}
+}
+
+// Stop the Manager, releasing all the shards.
+func (m *Manager) Stop() {
+	c := make(chan struct{})
+	m.stop <- c
+	<-c
+}
+
+// Owned returns the shards the local node owns, in order.
+func (m *Manager) Owned() []int {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	res := make([]int, 0, len(m.owned))
+	for k := range m.owned {
+		res = append(res, k)
+	}
+	sort.Ints(res)
+	return res
+}
+
+// Shard returns the shard of the key. The hash of the key is mixed first, as
+// not every hash has entropy in its lower bits.
+func (m *Manager) Shard(key []byte) int {
+	return int(hashring.Mix(m.hashFn(key)) % uint64(m.shards))
+}
+
+// HandleEvent handles the member events and the handoff queries of the
+// cluster. A query is answered by the reconcile loop, once the shard has been
+// released.
+func (m *Manager) HandleEvent(e members.Event) error {
+	switch t := e.(type) {
+	case *members.MemberEvent:
+		m.notify()
+
+	case *members.QueryEvent:
+		if t.Name != RequestQueryName {
+			return nil
+		}
+
+		var msg message
+		if err := json.Unmarshal(t.Payload, &msg); err != nil {
+			return errors.Wrap(err, "decoding handoff")
+		}
+		if msg.PeerType != m.peerType || msg.From != m.peer.Name() {
+			return nil
+		}
+
+		m.mtx.Lock()
+		m.requests[msg.Shard] = append(m.requests[msg.Shard], t)
+		m.mtx.Unlock()
+
+		m.notify()
+	}
+	return nil
+}
+
+// notify the reconcile loop of a change, without ever blocking the sender.
+func (m *Manager) notify() {
+	select {
+	case m.changed <- struct{}{}:
+	default:
+	}
+}
+
+// reconcile works out the owner of every shard, releasing the shards that
+// the local node no longer owns and acquiring the shards it now owns.
+func (m *Manager) reconcile(now time.Time) error {
+	var (
+		self       = m.peer.Name()
+		hosts, err = m.hosts()
+	)
+	if err != nil {
+		return err
+	}
+
+	// Without a previous view of the cluster, every shard is assumed to be
+	// owned by the other hosts.
+	previous := m.previous
+	if previous == nil {
+		for _, v := range hosts {
+			if v != self {
+				previous = append(previous, v)
+			}
+		}
+	}
+
+	var (
+		ring         = m.ring(hosts)
+		previousRing = m.ring(previous)
+		alive        = make(map[string]struct{}, len(hosts))
+		requests     = m.takeRequests()
+	)
+	for _, v := range hosts {
+		alive[v] = struct{}{}
+	}
+	m.expireNotices(now)
+
+	for shard := 0; shard < m.shards; shard++ {
+		key := strconv.Itoa(shard)
+
+		owner := first(ring.LookupN(key, 1))
+		if owner != self {
+			delete(m.pending, shard)
+			if m.owns(shard) {
+				m.release(shard)
+			}
+			// Once the shard isn't held, the new owner can be told.
+			if !m.owns(shard) {
+				m.respond(shard, requests[shard])
+				continue
+			}
+		}
+		// The local node still holds the shard, so the requests are
+		// answered later on.
+		m.keepRequests(shard, requests[shard], now)
+		if owner != self || m.owns(shard) {
+			continue
+		}
+
+		h, ok := m.pending[shard]
+		if !ok {
+			from := first(previousRing.LookupN(key, 1))
+			if _, ok := alive[from]; !ok || from == self {
+				m.acquire(shard)
+				continue
+			}
+
+			h = handoff{from: from, since: now}
+		}
+
+		// Without a response the shard is only acquired once the previous
+		// owner has left or failed, otherwise two nodes could hold it.
+		if _, ok := alive[h.from]; !ok || m.released(shard, h.from) {
+			m.acquire(shard)
+			continue
+		}
+		if now.Sub(h.asked) >= m.interval {
+			h.asked = now
+			m.request(shard, h.from)
+		}
+		if now.Sub(h.since) >= m.handoffTimeout && !h.warned {
+			h.warned = true
+			level.Warn(m.logger).Log("reason", "handoff timeout", "shard", shard, "from", h.from)
+		}
+		m.pending[shard] = h
+	}
+
+	m.previous = hosts
+	return nil
+}
+
+// hosts returns the names of the alive peers of the peer type, in order.
+func (m *Manager) hosts() ([]string, error) {
+	var res []string
+	if err := m.peer.Walk(func(info members.PeerInfo) error {
+		if info.PeerType == m.peerType {
+			res = append(res, info.Name)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (m *Manager) ring(hosts []string) *hashring.HashRing {
+	ring := hashring.New(m.hashFn, m.vnodes)
+	for _, v := range hosts {
+		ring.Add(v)
+	}
+	return ring
+}
+
+func (m *Manager) owns(shard int) bool {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	_, ok := m.owned[shard]
+	return ok
+}
+
+// takeRequests returns the requests of the new owners for each shard.
+func (m *Manager) takeRequests() map[int][]*members.QueryEvent {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	res := m.requests
+	m.requests = make(map[int][]*members.QueryEvent)
+	return res
+}
+
+// keepRequests puts back the requests for a shard the local node still holds,
+// so they're answered once the shard is released. Requests past their
+// deadline can't be answered, so they're dropped.
+func (m *Manager) keepRequests(shard int, requests []*members.QueryEvent, now time.Time) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	for _, v := range requests {
+		if deadline := v.Deadline(); deadline.IsZero() || now.Before(deadline) {
+			m.requests[shard] = append(m.requests[shard], v)
+		}
+	}
+}
+
+// respond to the requests for a shard, telling the new owners that the shard
+// has been released.
+func (m *Manager) respond(shard int, requests []*members.QueryEvent) {
+	for _, v := range requests {
+		if err := v.Respond(nil); err != nil {
+			level.Debug(m.logger).Log("reason", "respond to handoff", "shard", shard, "err", err)
+		}
+	}
+}
+
+// released returns true if the host has told the cluster it has released the
+// shard.
+func (m *Manager) released(shard int, from string) bool {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	n, ok := m.notices[shard]
+	return ok && n.from == from
+}
+
+func (m *Manager) acquire(shard int) {
+	if err := m.handler.OnAcquire(shard); err != nil {
+		level.Warn(m.logger).Log("reason", "acquire shard", "shard", shard, "err", err)
+		return
+	}
+
+	m.mtx.Lock()
+	m.owned[shard] = struct{}{}
+	delete(m.notices, shard)
+	m.mtx.Unlock()
+
+	delete(m.pending, shard)
+}
+
+// release the shard, any requests for the shard are answered by the caller.
+func (m *Manager) release(shard int) {
+	if err := m.handler.OnRelease(shard); err != nil {
+		level.Warn(m.logger).Log("reason", "release shard", "shard", shard, "err", err)
+		return
+	}
+
+	m.mtx.Lock()
+	delete(m.owned, shard)
+	m.mtx.Unlock()
+}
+
+// request the shard from the previous owner, the shard is marked as released
+// once the previous owner responds.
+func (m *Manager) request(shard int, from string) {
+	payload, err := json.Marshal(message{
+		PeerType: m.peerType,
+		Shard:    shard,
+		From:     from,
+	})
+	if err == nil {
+		err = m.peer.DispatchEvent(&members.QueryEvent{
+			Name:    RequestQueryName,
+			Payload: payload,
+			Nodes:   []string{from},
+			Timeout: m.interval,
+			OnResponse: func(node string, _ []byte) {
+				if node != from {
+					return
+				}
+
+				m.mtx.Lock()
+				m.notices[shard] = notice{
+					from: from,
+					at:   m.now(),
+				}
+				m.mtx.Unlock()
+
+				m.notify()
+			},
+		})
+	}
+	if err != nil {
+		level.Warn(m.logger).Log("reason", "request handoff", "shard", shard, "from", from, "err", err)
+	}
+}
+
+// releaseAll releases every shard, answering any requests for the shards so
+// the new owners don't have to wait for the local node to leave.
+func (m *Manager) releaseAll() {
+	for _, v := range m.Owned() {
+		m.release(v)
+	}
+	for shard, requests := range m.takeRequests() {
+		if !m.owns(shard) {
+			m.respond(shard, requests)
+		}
+	}
+}
+
+// expireNotices forgets about the notices that are too old to be part of a
+// handoff that's in progress.
+func (m *Manager) expireNotices(now time.Time) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	for k, v := range m.notices {
+		if now.Sub(v.at) >= m.handoffTimeout {
+			delete(m.notices, k)
+		}
+	}
+}
+
+// message is the payload of the handoff queries, from is always the previous
+// owner of the shard.
+type message struct {
+	PeerType members.PeerType `json:"peer_type"`
+	Shard    int              `json:"shard"`
+	From     string           `json:"from"`
+}
+
+type notice struct {
+	from string
+	at   time.Time
+}
+
+type handoff struct {
+	from   string
+	since  time.Time
+	asked  time.Time
+	warned bool
+}
+
+func first(hosts []string) string {
+	if len(hosts) == 0 {
+		return ""
+	}
+	return hosts[0]
+}
@@ -0,0 +1,510 @@
+package shard
+
+import (
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/hashring"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members/memtest"
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const peerType members.PeerType = "peertype:consumer"
+
+func TestManager(t *testing.T) {
+	t.Parallel()
+
+	t.Run("single node", func(t *testing.T) {
+		var (
+			c = newFakeCluster()
+			a = c.join("a")
+		)
+		if err := a.reconcile(time.Now()); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := shards(0, 1, 2, 3, 4, 5, 6, 7), a.Owned(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("handoff", func(t *testing.T) {
+		c := newMemCluster()
+		a := c.join(t, "a")
+		c.reconcile(t, a)
+
+		b := c.join(t, "b")
+		c.Advance(time.Second * 2)
+		c.reconcile(t, b)
+
+		// b has to wait for a to answer the request.
+		if expected, actual := 0, len(b.Owned()); expected != actual {
+			t.Fatalf("expected: %d, actual: %d", expected, actual)
+		}
+
+		// a gets the request and releases the shards.
+		c.Advance(time.Millisecond * 10)
+		c.reconcile(t, a)
+		c.reconcile(t, b)
+		if expected, actual := 0, len(b.Owned()); expected != actual {
+			t.Fatalf("expected: %d, actual: %d", expected, actual)
+		}
+
+		// b gets the response and acquires the shards.
+		c.Advance(time.Millisecond * 10)
+		c.reconcile(t, b)
+
+		if expected, actual := 8, len(a.Owned())+len(b.Owned()); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := true, len(b.Owned()) > 0; expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+		c.handedOff(t, "a", "b")
+	})
+
+	t.Run("bootstrap", func(t *testing.T) {
+		var (
+			c   = newFakeCluster()
+			now = time.Now()
+			a   = c.join("a")
+			b   = c.join("b")
+		)
+
+		// Neither node holds the shards of the other, so answering the
+		// requests is enough to hand them off without waiting.
+		for i := 0; i < 2; i++ {
+			for _, v := range []*Manager{a, b} {
+				if err := v.reconcile(now); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		owned := append(a.Owned(), b.Owned()...)
+		sort.Ints(owned)
+		if expected, actual := shards(0, 1, 2, 3, 4, 5, 6, 7), owned; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("lost response", func(t *testing.T) {
+		c := newMemCluster()
+		a := c.join(t, "a")
+		c.reconcile(t, a)
+
+		b := c.join(t, "b")
+		c.Advance(time.Second * 2)
+		c.reconcile(t, b)
+
+		// a gets the request, but the response never reaches b.
+		c.Advance(time.Millisecond * 10)
+		c.Partition([]string{"a"}, []string{"b"})
+		c.reconcile(t, a)
+		c.Heal()
+
+		c.Advance(time.Millisecond * 10)
+		c.reconcile(t, b)
+		if expected, actual := 0, len(b.Owned()); expected != actual {
+			t.Fatalf("expected: %d, actual: %d", expected, actual)
+		}
+
+		// b asks again after the interval, which a answers straight away as
+		// it no longer holds the shards.
+		c.Advance(time.Second)
+		c.reconcile(t, b)
+		c.Advance(time.Millisecond * 10)
+		c.reconcile(t, a)
+		c.Advance(time.Millisecond * 10)
+		c.reconcile(t, b)
+
+		if expected, actual := true, len(b.Owned()) > 0; expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+		if expected, actual := 8, len(a.Owned())+len(b.Owned()); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		c.handedOff(t, "a", "b")
+	})
+
+	t.Run("handoff timeout", func(t *testing.T) {
+		c := newMemCluster()
+		a := c.join(t, "a")
+		c.reconcile(t, a)
+
+		b := c.join(t, "b")
+		c.Advance(time.Second * 2)
+		c.reconcile(t, b)
+
+		// Every response from a arrives after the request has timed out.
+		c.SetLinkLatency("a", "b", time.Second*2)
+		for i := 0; i < 5; i++ {
+			c.Advance(time.Second)
+			c.reconcile(t, a, b)
+		}
+
+		// a is still alive, so b keeps on waiting, even after the timeout.
+		if expected, actual := 0, len(b.Owned()); expected != actual {
+			t.Fatalf("expected: %d, actual: %d", expected, actual)
+		}
+
+		if err := c.Crash("a"); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(time.Second * 10)
+		c.reconcile(t, b)
+
+		if expected, actual := shards(0, 1, 2, 3, 4, 5, 6, 7), b.Owned(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("request for a held shard", func(t *testing.T) {
+		var (
+			c   = newFakeCluster()
+			now = time.Now()
+			a   = c.join("a")
+		)
+		if err := a.reconcile(now); err != nil {
+			t.Fatal(err)
+		}
+
+		// The request reaches a before a knows of b, so a still owns the
+		// shards and can't answer yet.
+		b := c.join("b")
+		c.hide("b")
+		if err := b.reconcile(now); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.reconcile(now); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.reconcile(now); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 0, len(b.Owned()); expected != actual {
+			t.Fatalf("expected: %d, actual: %d", expected, actual)
+		}
+
+		c.show("b")
+		if err := a.reconcile(now); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.reconcile(now); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := true, len(b.Owned()) > 0; expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+		if expected, actual := 8, len(a.Owned())+len(b.Owned()); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("failed owner", func(t *testing.T) {
+		c := newMemCluster()
+		a := c.join(t, "a")
+		b := c.join(t, "b")
+		c.Advance(time.Second * 2)
+
+		for i := 0; i < 3; i++ {
+			c.reconcile(t, a, b)
+			c.Advance(time.Millisecond * 20)
+		}
+		if expected, actual := true, len(a.Owned()) > 0 && len(b.Owned()) > 0; expected != actual {
+			t.Fatalf("expected: %t, actual: %t", expected, actual)
+		}
+
+		// The shards of a failed node are acquired once it's failed.
+		if err := c.Crash("a"); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(time.Second * 10)
+		c.reconcile(t, b)
+
+		if expected, actual := shards(0, 1, 2, 3, 4, 5, 6, 7), b.Owned(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("shard of keys", func(t *testing.T) {
+		m := NewManager(nil, peerType, 8, nil, log.NewNopLogger(), WithHash(hashring.Widen(crc32.ChecksumIEEE)))
+
+		seen := make(map[int]struct{})
+		for i := 0; i < 100; i++ {
+			seen[m.Shard([]byte(fmt.Sprintf("key-%d", i)))] = struct{}{}
+		}
+		if expected, actual := 8, len(seen); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("acquire error", func(t *testing.T) {
+		var (
+			c = newFakeCluster()
+			a = c.join("a")
+		)
+		c.fail = errors.New("bad")
+		if err := a.reconcile(time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 0, len(a.Owned()); expected != actual {
+			t.Fatalf("expected: %d, actual: %d", expected, actual)
+		}
+
+		c.fail = nil
+		if err := a.reconcile(time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 8, len(a.Owned()); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		var (
+			c = newFakeCluster()
+			a = c.join("a")
+		)
+
+		done := make(chan error)
+		go func() {
+			done <- a.Run()
+		}()
+		for len(a.Owned()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		a.Stop()
+
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		if expected, actual := 0, len(a.Owned()); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+}
+
+func shards(s ...int) []int {
+	return s
+}
+
+type entry struct {
+	node    string
+	shard   int
+	acquire bool
+}
+
+// ledger records the shards the nodes acquire and release.
+type ledger struct {
+	mtx     sync.Mutex
+	entries []entry
+	fail    error
+}
+
+func (l *ledger) handler(name string) Handler {
+	return HandlerFuncs{
+		Acquire: func(shard int) error {
+			return l.record(name, shard, true)
+		},
+		Release: func(shard int) error {
+			return l.record(name, shard, false)
+		},
+	}
+}
+
+func (l *ledger) record(name string, shard int, acquire bool) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.fail != nil {
+		return l.fail
+	}
+	l.entries = append(l.entries, entry{name, shard, acquire})
+	return nil
+}
+
+// handedOff checks that every shard the new owner acquired was released by
+// the previous owner beforehand.
+func (l *ledger) handedOff(t *testing.T, from, to string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	released := make(map[int]bool)
+	for _, v := range l.entries {
+		switch {
+		case v.node == from && !v.acquire:
+			released[v.shard] = true
+		case v.node == to && v.acquire && !released[v.shard]:
+			t.Errorf("expected: shard %d released before acquired", v.shard)
+		}
+	}
+}
+
+// memCluster runs the managers on an in-memory cluster of members, so that
+// the handoff queries go over a simulated network.
+type memCluster struct {
+	*memtest.Cluster
+	ledger
+	seed string
+}
+
+func newMemCluster(opts ...memtest.Option) *memCluster {
+	return &memCluster{
+		Cluster: memtest.NewCluster(opts...),
+	}
+}
+
+// join creates a node that joins the first node of the cluster.
+func (c *memCluster) join(t *testing.T, name string) *Manager {
+	if c.seed == "" {
+		c.seed = name
+	}
+	m, err := c.NewMembers(members.PeerInfo{
+		Name:     name,
+		PeerType: peerType,
+		APIAddr:  "127.0.0.1",
+		APIPort:  8080,
+	}, c.seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Join(); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewManager(cluster.NewPeer(m, log.NewNopLogger()),
+		peerType,
+		8,
+		c.handler(name),
+		log.NewNopLogger(),
+		WithVNodes(10),
+		WithHandoffTimeout(time.Second),
+		WithClock(c.Now),
+	)
+	if err := m.RegisterEventHandler(manager); err != nil {
+		t.Fatal(err)
+	}
+	return manager
+}
+
+// reconcile the managers at the time of the clock of the cluster.
+func (c *memCluster) reconcile(t *testing.T, managers ...*Manager) {
+	for _, v := range managers {
+		if err := v.reconcile(c.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// fakeCluster delivers the events dispatched by a peer to every peer in the
+// cluster straight away. Queries are delivered to the queried peers and the
+// responses are passed straight back.
+type fakeCluster struct {
+	ledger
+	mtx      sync.Mutex
+	peers    []string
+	hidden   map[string]bool
+	handlers map[string]members.EventHandler
+}
+
+func newFakeCluster() *fakeCluster {
+	return &fakeCluster{
+		hidden:   make(map[string]bool),
+		handlers: make(map[string]members.EventHandler),
+	}
+}
+
+func (c *fakeCluster) join(name string) *Manager {
+	c.mtx.Lock()
+	c.peers = append(c.peers, name)
+	c.mtx.Unlock()
+
+	m := NewManager(fakePeer{name: name, cluster: c},
+		peerType,
+		8,
+		c.handler(name),
+		log.NewNopLogger(),
+		WithVNodes(10),
+		WithHandoffTimeout(time.Second),
+	)
+	c.handlers[name] = m
+	return m
+}
+
+// hide the peer from the other peers, but not from itself, as if the other
+// peers hadn't heard of the peer joining yet.
+func (c *fakeCluster) hide(name string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.hidden[name] = true
+}
+
+func (c *fakeCluster) show(name string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	delete(c.hidden, name)
+}
+
+type fakePeer struct {
+	cluster.Peer
+	name    string
+	cluster *fakeCluster
+}
+
+func (p fakePeer) Name() string { return p.name }
+
+func (p fakePeer) Walk(fn func(members.PeerInfo) error) error {
+	p.cluster.mtx.Lock()
+	var peers []string
+	for _, v := range p.cluster.peers {
+		if v == p.name || !p.cluster.hidden[v] {
+			peers = append(peers, v)
+		}
+	}
+	p.cluster.mtx.Unlock()
+
+	for _, v := range peers {
+		if err := fn(members.PeerInfo{Name: v, PeerType: peerType}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p fakePeer) DispatchEvent(e members.Event) error {
+	query, ok := e.(*members.QueryEvent)
+	if !ok {
+		for _, v := range p.cluster.handlers {
+			if err := v.HandleEvent(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, name := range query.Nodes {
+		name := name
+		event := members.NewQueryEventFunc(query.Name, query.Payload, time.Time{}, func(payload []byte) error {
+			query.OnResponse(name, payload)
+			return nil
+		})
+		if err := p.cluster.handlers[name].HandleEvent(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p fakePeer) RegisterEventHandler(members.EventHandler) error   { return nil }
+func (p fakePeer) DeregisterEventHandler(members.EventHandler) error { return nil }
@@ -0,0 +1,3 @@
+// Package dns implements a DNS interface for querying the cluster registry,
+// so that services which can only resolve via DNS can still discover peers.
+package dns
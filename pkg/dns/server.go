@@ -0,0 +1,271 @@
+package dns
+
+import (
+	"encoding/hex"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/registry"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultDomain is the domain that the DNS server is authoritative for.
+	DefaultDomain = "alchemy."
+
+	labelPeerType = "peertype"
+	labelAddr     = "addr"
+)
+
+// Server answers DNS queries for the peers that are found in the cluster
+// registry.
+//
+//	<type>.peertype.<domain>
+//	    Returns A, AAAA or SRV records for the peers of the peer type.
+//
+//	<key>-<value>.<type>.peertype.<domain>
+//	    Returns the records for the peers of the peer type, that have a tag
+//	    matching the key and value. Multiple tag filters can be given.
+//
+//	<hex ip>.addr.<domain>
+//	    Returns the A or AAAA record of the encoded ip, which is used as the
+//	    target for the SRV records.
+//
+// Returns NXDOMAIN if the name isn't within the domain, or the name is in an
+// invalid format.
+type Server struct {
+	registry registry.Registry
+	domain   []string
+	ttl      time.Duration
+	logger   log.Logger
+}
+
+// NewServer creates a Server with the correct dependencies.
+// The Server is a dns.Handler and can ServeDNS.
+func NewServer(registry registry.Registry,
+	domain string,
+	ttl time.Duration,
+	logger log.Logger,
+) *Server {
+	return &Server{
+		registry: registry,
+		domain:   dns.SplitDomainName(strings.ToLower(dns.Fqdn(domain))),
+		ttl:      ttl,
+		logger:   logger,
+	}
+}
+
+// ServeDNS answers the first question in the message.
+func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+
+	if len(r.Question) > 0 {
+		q := r.Question[0]
+		level.Debug(s.logger).Log("name", q.Name, "type", dns.TypeToString[q.Qtype])
+
+		answer, extra, ok := s.answer(q)
+		if !ok {
+			m.SetRcode(r, dns.RcodeNameError)
+		}
+		m.Answer = answer
+		m.Extra = extra
+	}
+
+	if err := w.WriteMsg(m); err != nil {
+		level.Warn(s.logger).Log("err", err)
+	}
+}
+
+func (s *Server) answer(q dns.Question) (answer, extra []dns.RR, ok bool) {
+	labels, ok := s.trimDomain(q.Name)
+	if !ok || len(labels) < 2 {
+		return nil, nil, false
+	}
+
+	switch labels[len(labels)-1] {
+	case labelAddr:
+		if len(labels) != 2 {
+			return nil, nil, false
+		}
+		ip, err := decodeAddr(labels[0])
+		if err != nil {
+			return nil, nil, false
+		}
+		if rr := s.addrRecord(q.Name, q.Qtype, ip); rr != nil {
+			answer = append(answer, rr)
+		}
+		return answer, nil, true
+
+	case labelPeerType:
+		filters, ok := parseFilters(labels[:len(labels)-2])
+		if !ok {
+			return nil, nil, false
+		}
+
+		peerType := members.PeerType(labelPeerType + ":" + labels[len(labels)-2])
+		peers, ok := s.peers(peerType, filters)
+		if !ok {
+			return nil, nil, false
+		}
+
+		for _, k := range rand.Perm(len(peers)) {
+			p := peers[k]
+			switch q.Qtype {
+			case dns.TypeA, dns.TypeAAAA, dns.TypeANY:
+				if rr := s.addrRecord(q.Name, q.Qtype, p.IP); rr != nil {
+					answer = append(answer, rr)
+				}
+			case dns.TypeSRV:
+				target := s.addrName(p.IP)
+				answer = append(answer, &dns.SRV{
+					Hdr:      s.header(q.Name, dns.TypeSRV),
+					Priority: 1,
+					Weight:   1,
+					Port:     uint16(p.Port),
+					Target:   target,
+				})
+				if rr := s.addrRecord(target, dns.TypeANY, p.IP); rr != nil {
+					extra = append(extra, rr)
+				}
+			}
+		}
+		return answer, extra, true
+	}
+
+	return nil, nil, false
+}
+
+// trimDomain removes the domain suffix from the name, returning false if the
+// name isn't with in the domain.
+func (s *Server) trimDomain(name string) ([]string, bool) {
+	labels := dns.SplitDomainName(strings.ToLower(name))
+	if len(labels) < len(s.domain) {
+		return nil, false
+	}
+
+	offset := len(labels) - len(s.domain)
+	for k, v := range s.domain {
+		if labels[offset+k] != v {
+			return nil, false
+		}
+	}
+	return labels[:offset], true
+}
+
+type peer struct {
+	IP   net.IP
+	Port int
+}
+
+// peers returns all the peers of a peer type that match the tag filters.
+// Returns false if the peer type isn't known to the registry.
+func (s *Server) peers(peerType members.PeerType, filters map[string]string) ([]peer, bool) {
+	info, ok := s.registry.Info(peerType.String())
+	if !ok {
+		return nil, false
+	}
+
+	var res []peer
+	for _, keys := range info.Keys {
+		for _, key := range keys {
+			tags := key.Tags()
+			if !matchFilters(tags, filters) {
+				continue
+			}
+
+			peerInfo, err := members.PeerInfoFromTags(tags)
+			if err != nil {
+				level.Debug(s.logger).Log("key", key.Name(), "err", err)
+				continue
+			}
+
+			ip := net.ParseIP(peerInfo.APIAddr)
+			if ip == nil {
+				continue
+			}
+			res = append(res, peer{
+				IP:   ip,
+				Port: peerInfo.APIPort,
+			})
+		}
+	}
+	return res, true
+}
+
+func (s *Server) addrRecord(name string, qtype uint16, ip net.IP) dns.RR {
+	if ip4 := ip.To4(); ip4 != nil {
+		if qtype != dns.TypeA && qtype != dns.TypeANY {
+			return nil
+		}
+		return &dns.A{
+			Hdr: s.header(name, dns.TypeA),
+			A:   ip4,
+		}
+	}
+	if qtype != dns.TypeAAAA && qtype != dns.TypeANY {
+		return nil
+	}
+	return &dns.AAAA{
+		Hdr:  s.header(name, dns.TypeAAAA),
+		AAAA: ip,
+	}
+}
+
+func (s *Server) addrName(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	labels := append([]string{hex.EncodeToString(ip), labelAddr}, s.domain...)
+	return dns.Fqdn(strings.Join(labels, "."))
+}
+
+func (s *Server) header(name string, rrtype uint16) dns.RR_Header {
+	return dns.RR_Header{
+		Name:   name,
+		Rrtype: rrtype,
+		Class:  dns.ClassINET,
+		Ttl:    uint32(s.ttl / time.Second),
+	}
+}
+
+func decodeAddr(label string) (net.IP, error) {
+	b, err := hex.DecodeString(label)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != net.IPv4len && len(b) != net.IPv6len {
+		return nil, errors.Errorf("invalid address length %d", len(b))
+	}
+	return net.IP(b), nil
+}
+
+// parseFilters parses the tag filters from the labels, each label is in the
+// format of "key-value".
+func parseFilters(labels []string) (map[string]string, bool) {
+	res := make(map[string]string, len(labels))
+	for _, v := range labels {
+		parts := strings.SplitN(v, "-", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, false
+		}
+		res[parts[0]] = parts[1]
+	}
+	return res, true
+}
+
+func matchFilters(tags, filters map[string]string) bool {
+	for k, v := range filters {
+		if t, ok := tags[k]; !ok || strings.ToLower(t) != v {
+			return false
+		}
+	}
+	return true
+}
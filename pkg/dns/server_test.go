@@ -0,0 +1,193 @@
+package dns
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/registry"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/registry/mocks"
+	"github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+	"github.com/miekg/dns"
+)
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	info := registry.Info{
+		Keys: map[string][]registry.Key{
+			"10.0.0.1:8079": []registry.Key{
+				newKey("a", "10.0.0.1", 8080, map[string]string{"zone": "eu"}),
+			},
+			"10.0.0.2:8079": []registry.Key{
+				newKey("b", "10.0.0.2", 8080, map[string]string{"zone": "us"}),
+			},
+		},
+	}
+
+	t.Run("a", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		reg := mocks.NewMockRegistry(ctrl)
+		reg.EXPECT().Info("peertype:registry").Return(info, true)
+
+		res := query(t, reg, "registry.peertype.alchemy.", dns.TypeA)
+
+		if expected, actual := dns.RcodeSuccess, res.Rcode; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := 2, len(res.Answer); expected != actual {
+			t.Fatalf("expected: %d, actual: %d", expected, actual)
+		}
+		for _, v := range res.Answer {
+			if expected, actual := uint32(5), v.Header().Ttl; expected != actual {
+				t.Errorf("expected: %d, actual: %d", expected, actual)
+			}
+		}
+	})
+
+	t.Run("a with tag filter", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		reg := mocks.NewMockRegistry(ctrl)
+		reg.EXPECT().Info("peertype:registry").Return(info, true)
+
+		res := query(t, reg, "zone-eu.registry.peertype.alchemy.", dns.TypeA)
+
+		if expected, actual := 1, len(res.Answer); expected != actual {
+			t.Fatalf("expected: %d, actual: %d", expected, actual)
+		}
+		a, ok := res.Answer[0].(*dns.A)
+		if !ok {
+			t.Fatalf("expected: A record, actual: %T", res.Answer[0])
+		}
+		if expected, actual := "10.0.0.1", a.A.String(); expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("srv", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		reg := mocks.NewMockRegistry(ctrl)
+		reg.EXPECT().Info("peertype:registry").Return(info, true)
+
+		res := query(t, reg, "zone-us.registry.peertype.alchemy.", dns.TypeSRV)
+
+		if expected, actual := 1, len(res.Answer); expected != actual {
+			t.Fatalf("expected: %d, actual: %d", expected, actual)
+		}
+		srv, ok := res.Answer[0].(*dns.SRV)
+		if !ok {
+			t.Fatalf("expected: SRV record, actual: %T", res.Answer[0])
+		}
+		if expected, actual := uint16(8080), srv.Port; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := "0a000002.addr.alchemy.", srv.Target; expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+		if expected, actual := 1, len(res.Extra); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("addr", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		reg := mocks.NewMockRegistry(ctrl)
+
+		res := query(t, reg, "0a000002.addr.alchemy.", dns.TypeA)
+
+		if expected, actual := 1, len(res.Answer); expected != actual {
+			t.Fatalf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := "10.0.0.2", res.Answer[0].(*dns.A).A.String(); expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		reg := mocks.NewMockRegistry(ctrl)
+		reg.EXPECT().Info("peertype:missing").Return(registry.Info{}, false)
+
+		res := query(t, reg, "missing.peertype.alchemy.", dns.TypeA)
+
+		if expected, actual := dns.RcodeNameError, res.Rcode; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("outside domain", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		reg := mocks.NewMockRegistry(ctrl)
+
+		res := query(t, reg, "registry.peertype.example.", dns.TypeA)
+
+		if expected, actual := dns.RcodeNameError, res.Rcode; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+}
+
+func query(t *testing.T, reg registry.Registry, name string, qtype uint16) *dns.Msg {
+	var (
+		server = NewServer(reg, DefaultDomain, time.Second*5, log.NewNopLogger())
+		writer = &responseWriter{}
+		req    = new(dns.Msg)
+	)
+	req.SetQuestion(name, qtype)
+	server.ServeDNS(writer, req)
+
+	if writer.msg == nil {
+		t.Fatal("expected a response")
+	}
+	return writer.msg
+}
+
+type key struct {
+	name string
+	tags map[string]string
+}
+
+func newKey(name, addr string, port int, tags map[string]string) registry.Key {
+	t := map[string]string{
+		"name":     name,
+		"peertype": "peertype:registry",
+		"api_addr": addr,
+		"api_port": strconv.Itoa(port),
+	}
+	for k, v := range tags {
+		t[k] = v
+	}
+	return key{name, t}
+}
+
+func (k key) Name() string            { return k.name }
+func (k key) Type() string            { return "peertype:registry" }
+func (k key) Address() string         { return k.tags["api_addr"] }
+func (k key) Tags() map[string]string { return k.tags }
+
+type responseWriter struct {
+	msg *dns.Msg
+}
+
+func (w *responseWriter) LocalAddr() net.Addr       { return &net.UDPAddr{} }
+func (w *responseWriter) RemoteAddr() net.Addr      { return &net.UDPAddr{} }
+func (w *responseWriter) WriteMsg(m *dns.Msg) error { w.msg = m; return nil }
+func (w *responseWriter) Write([]byte) (int, error) { return 0, nil }
+func (w *responseWriter) Close() error              { return nil }
+func (w *responseWriter) TsigStatus() error         { return nil }
+func (w *responseWriter) TsigTimersOnly(bool)       {}
+func (w *responseWriter) Hijack()                   {}
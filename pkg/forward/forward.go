@@ -0,0 +1,182 @@
+package forward
+
+import (
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+
+	"github.com/SimonRichardson/alchemy/pkg/api"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/registry"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	// HeaderHop counts the number of times a request has been forwarded.
+	HeaderHop = "X-Forwarded-Hop"
+
+	// HeaderForwardedBy names the node that forwarded the request.
+	HeaderForwardedBy = "X-Forwarded-By"
+)
+
+const (
+	defaultMaxHops = 1
+)
+
+// KeyFunc extracts the routing key from a request.
+// Returns false if the request has no routing key.
+type KeyFunc func(*http.Request) (string, bool)
+
+// FromHeader extracts the routing key from the header with the name.
+func FromHeader(name string) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		v := r.Header.Get(name)
+		return v, v != ""
+	}
+}
+
+// FromQuery extracts the routing key from the query parameter with the name.
+func FromQuery(name string) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		v := r.URL.Query().Get(name)
+		return v, v != ""
+	}
+}
+
+// FromPathSegment extracts the routing key from the segment of the path at
+// the index, where the first segment after the leading slash is at zero.
+func FromPathSegment(index int) KeyFunc {
+	return func(r *http.Request) (string, bool) {
+		segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if index < 0 || index >= len(segments) || segments[index] == "" {
+			return "", false
+		}
+		return segments[index], true
+	}
+}
+
+// Option defines a option for configuring a Forwarder
+type Option func(*Forwarder)
+
+// WithMaxHops sets how many times a request can be forwarded, before it's
+// served by whichever node it ends up at. Nodes can disagree on the owner
+// whilst changes are gossiped, so without a limit a request could go round
+// in circles.
+func WithMaxHops(hops int) Option {
+	return func(f *Forwarder) {
+		f.maxHops = hops
+	}
+}
+
+// WithTransport sets the transport used to forward the requests.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(f *Forwarder) {
+		f.transport = transport
+	}
+}
+
+// Forwarder is a http.Handler middleware that shards requests over the peers
+// of a type. The owner of the routing key of a request is looked up in the
+// registry, if the local node owns the key the request is served locally,
+// otherwise it's forwarded to the API address of the owner.
+type Forwarder struct {
+	next      http.Handler
+	registry  registry.Registry
+	peerType  members.PeerType
+	self      string
+	keyFn     KeyFunc
+	maxHops   int
+	transport http.RoundTripper
+	logger    log.Logger
+	errors    api.Error
+}
+
+// New creates a Forwarder in front of the handler, where self is the name of
+// the local node in the cluster.
+func New(next http.Handler,
+	registry registry.Registry,
+	peerType members.PeerType,
+	self string,
+	keyFn KeyFunc,
+	logger log.Logger,
+	opts ...Option,
+) *Forwarder {
+	f := &Forwarder{
+		next:      next,
+		registry:  registry,
+		peerType:  peerType,
+		self:      self,
+		keyFn:     keyFn,
+		maxHops:   defaultMaxHops,
+		transport: http.DefaultTransport,
+		logger:    logger,
+		errors:    api.NewError(logger),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+func (f *Forwarder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	hops := hopCount(r)
+	if hops >= f.maxHops {
+		f.next.ServeHTTP(w, r)
+		return
+	}
+
+	key, ok := f.keyFn(r)
+	if !ok {
+		f.next.ServeHTTP(w, r)
+		return
+	}
+
+	addr, ok := f.owner(key)
+	if !ok {
+		f.next.ServeHTTP(w, r)
+		return
+	}
+
+	level.Debug(f.logger).Log("reason", "forwarding", "key", key, "owner", addr, "hops", hops)
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = addr
+			req.Header.Set(HeaderHop, strconv.Itoa(hops+1))
+			req.Header.Set(HeaderForwardedBy, f.self)
+		},
+		Transport: f.transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			f.errors.Error(w, err.Error(), http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// owner returns the API address of the owner of the key.
+// Returns false if the local node owns the key, or the owner is unknown.
+func (f *Forwarder) owner(key string) (string, bool) {
+	keys, ok := f.registry.Lookup(f.peerType.String(), key, 1)
+	if !ok || len(keys) == 0 || keys[0].Name() == f.self {
+		return "", false
+	}
+
+	info, err := members.PeerInfoFromTags(keys[0].Tags())
+	if err != nil {
+		level.Warn(f.logger).Log("reason", "owner peer info", "owner", keys[0].Name(), "err", err)
+		return "", false
+	}
+	return net.JoinHostPort(info.APIAddr, strconv.Itoa(info.APIPort)), true
+}
+
+// hopCount returns how many times the request has already been forwarded.
+func hopCount(r *http.Request) int {
+	hops, err := strconv.Atoi(r.Header.Get(HeaderHop))
+	if err != nil || hops < 0 {
+		return 0
+	}
+	return hops
+}
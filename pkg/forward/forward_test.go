@@ -0,0 +1,260 @@
+package forward
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/registry"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/registry/mocks"
+	"github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+)
+
+const peerType = members.PeerType("peertype:store")
+
+func TestKeyFunc(t *testing.T) {
+	t.Parallel()
+
+	r := httptest.NewRequest("GET", "/users/abc/profile?id=def", nil)
+	r.Header.Set("X-Key", "ghi")
+
+	for _, v := range []struct {
+		name  string
+		fn    KeyFunc
+		key   string
+		found bool
+	}{
+		{"header", FromHeader("X-Key"), "ghi", true},
+		{"missing header", FromHeader("X-Other"), "", false},
+		{"query", FromQuery("id"), "def", true},
+		{"missing query", FromQuery("other"), "", false},
+		{"path segment", FromPathSegment(1), "abc", true},
+		{"out of range path segment", FromPathSegment(3), "", false},
+		{"negative path segment", FromPathSegment(-1), "", false},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			key, found := v.fn(r)
+			if expected, actual := v.found, found; expected != actual {
+				t.Errorf("expected: %t, actual: %t", expected, actual)
+			}
+			if expected, actual := v.key, key; expected != actual {
+				t.Errorf("expected: %q, actual: %q", expected, actual)
+			}
+		})
+	}
+}
+
+func TestForwarder(t *testing.T) {
+	t.Parallel()
+
+	t.Run("serves locally without a key", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		reg := mocks.NewMockRegistry(ctrl)
+
+		server := httptest.NewServer(New(named("local"), reg, peerType, "local", FromQuery("key"), log.NewNopLogger()))
+		defer server.Close()
+
+		if expected, actual := "local", get(t, server.URL+"/", nil); expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("serves locally when owned", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		reg := mocks.NewMockRegistry(ctrl)
+		reg.EXPECT().Lookup(peerType.String(), "abc", 1).Return([]registry.Key{
+			newKey("local", "127.0.0.1", 1),
+		}, true)
+
+		server := httptest.NewServer(New(named("local"), reg, peerType, "local", FromQuery("key"), log.NewNopLogger()))
+		defer server.Close()
+
+		if expected, actual := "local", get(t, server.URL+"/?key=abc", nil); expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("serves locally with an unknown peer type", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		reg := mocks.NewMockRegistry(ctrl)
+		reg.EXPECT().Lookup(peerType.String(), "abc", 1).Return(nil, false)
+
+		server := httptest.NewServer(New(named("local"), reg, peerType, "local", FromQuery("key"), log.NewNopLogger()))
+		defer server.Close()
+
+		if expected, actual := "local", get(t, server.URL+"/?key=abc", nil); expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("forwards to the owner", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var hop, by string
+		owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hop, by = r.Header.Get(HeaderHop), r.Header.Get(HeaderForwardedBy)
+			fmt.Fprintf(w, "owner:%s", r.URL.Query().Get("key"))
+		}))
+		defer owner.Close()
+
+		reg := mocks.NewMockRegistry(ctrl)
+		reg.EXPECT().Lookup(peerType.String(), "abc", 1).Return([]registry.Key{
+			ownerKey(t, "owner", owner.URL),
+		}, true)
+
+		server := httptest.NewServer(New(named("local"), reg, peerType, "local", FromQuery("key"), log.NewNopLogger()))
+		defer server.Close()
+
+		if expected, actual := "owner:abc", get(t, server.URL+"/?key=abc", nil); expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+		if expected, actual := "1", hop; expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+		if expected, actual := "local", by; expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("serves forwarded requests locally", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		// The registry is never asked, so the request can't be forwarded
+		// again.
+		reg := mocks.NewMockRegistry(ctrl)
+
+		server := httptest.NewServer(New(named("local"), reg, peerType, "local", FromQuery("key"), log.NewNopLogger()))
+		defer server.Close()
+
+		header := http.Header{HeaderHop: []string{"1"}}
+		if expected, actual := "local", get(t, server.URL+"/?key=abc", header); expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("max hops", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		owner := httptest.NewServer(named("owner"))
+		defer owner.Close()
+
+		reg := mocks.NewMockRegistry(ctrl)
+		reg.EXPECT().Lookup(peerType.String(), "abc", 1).Return([]registry.Key{
+			ownerKey(t, "owner", owner.URL),
+		}, true)
+
+		server := httptest.NewServer(New(named("local"), reg, peerType, "local", FromQuery("key"), log.NewNopLogger(), WithMaxHops(2)))
+		defer server.Close()
+
+		header := http.Header{HeaderHop: []string{"1"}}
+		if expected, actual := "owner", get(t, server.URL+"/?key=abc", header); expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("unreachable owner", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		owner := httptest.NewServer(named("owner"))
+		owner.Close()
+
+		reg := mocks.NewMockRegistry(ctrl)
+		reg.EXPECT().Lookup(peerType.String(), "abc", 1).Return([]registry.Key{
+			ownerKey(t, "owner", owner.URL),
+		}, true)
+
+		server := httptest.NewServer(New(named("local"), reg, peerType, "local", FromQuery("key"), log.NewNopLogger()))
+		defer server.Close()
+
+		resp, err := http.Get(server.URL + "/?key=abc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if expected, actual := http.StatusBadGateway, resp.StatusCode; expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+}
+
+func get(t *testing.T, url string, header http.Header) string {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if expected, actual := http.StatusOK, resp.StatusCode; expected != actual {
+		t.Fatalf("expected: %d, actual: %d", expected, actual)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+// ownerKey creates a key with the API address of the test server.
+func ownerKey(t *testing.T, name, rawurl string) registry.Key {
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(rawurl, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newKey(name, host, p)
+}
+
+// named is a handler that writes its name.
+type named string
+
+func (n named) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, string(n))
+}
+
+type key struct {
+	name string
+	tags map[string]string
+}
+
+func newKey(name, addr string, port int) registry.Key {
+	return key{name, map[string]string{
+		"name":     name,
+		"peertype": peerType.String(),
+		"api_addr": addr,
+		"api_port": strconv.Itoa(port),
+	}}
+}
+
+func (k key) Name() string            { return k.name }
+func (k key) Type() string            { return peerType.String() }
+func (k key) Address() string         { return k.tags["api_addr"] }
+func (k key) Tags() map[string]string { return k.tags }
@@ -0,0 +1,4 @@
+// Package grpcresolver implements a gRPC name resolver that discovers the
+// addresses of peers through the registry, so gRPC clients can dial a peer
+// type directly, for example "alchemy:///peertype:foo".
+package grpcresolver
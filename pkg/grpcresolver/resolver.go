@@ -0,0 +1,285 @@
+package grpcresolver
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/SimonRichardson/alchemy/pkg/registry/registrypb"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Scheme is the scheme that the resolver is registered under.
+	Scheme = "alchemy"
+
+	defaultRetryInterval = time.Second * 5
+)
+
+// TagKey is the key type of the address attributes, each tag of a member is
+// stored under it's own TagKey.
+type TagKey string
+
+type builder struct {
+	client registrypb.RegistryClient
+	logger log.Logger
+}
+
+// NewBuilder creates a resolver.Builder that uses the registry client to
+// resolve a peer type in to the API addresses of the members.
+func NewBuilder(client registrypb.RegistryClient, logger log.Logger) resolver.Builder {
+	return &builder{
+		client: client,
+		logger: logger,
+	}
+}
+
+// Register registers a resolver.Builder for the alchemy scheme with gRPC, it
+// should only be called during initialization.
+func Register(client registrypb.RegistryClient, logger log.Logger) {
+	resolver.Register(NewBuilder(client, logger))
+}
+
+func (b *builder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	peerType, err := cluster.ParsePeerType(strings.TrimPrefix(target.Endpoint(), "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &alchemyResolver{
+		client:     b.client,
+		cc:         cc,
+		peerType:   peerType,
+		addrs:      make(map[string]resolver.Address),
+		resolveNow: make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		logger:     log.With(b.logger, "peer_type", peerType.String()),
+	}
+	go r.run()
+	return r, nil
+}
+
+func (b *builder) Scheme() string {
+	return Scheme
+}
+
+type alchemyResolver struct {
+	client     registrypb.RegistryClient
+	cc         resolver.ClientConn
+	peerType   members.PeerType
+	addrs      map[string]resolver.Address
+	resolveNow chan struct{}
+	ctx        context.Context
+	cancel     context.CancelFunc
+	done       chan struct{}
+	logger     log.Logger
+}
+
+func (r *alchemyResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+func (r *alchemyResolver) Close() {
+	r.cancel()
+	<-r.done
+}
+
+func (r *alchemyResolver) run() {
+	defer close(r.done)
+
+	for {
+		err := r.watch()
+		if r.ctx.Err() != nil {
+			return
+		}
+
+		level.Warn(r.logger).Log("reason", "watch", "err", err)
+
+		// A watch that fell behind has missed changes, the services are
+		// listed again straight away rather than waiting.
+		if status.Code(err) == codes.ResourceExhausted {
+			continue
+		}
+		r.cc.ReportError(err)
+
+		select {
+		case <-time.After(defaultRetryInterval):
+		case <-r.resolveNow:
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// watch lists the current services and then applies the membership changes
+// as they're streamed from the registry, until an error occurs.
+func (r *alchemyResolver) watch() error {
+	ctx, cancel := context.WithCancel(r.ctx)
+	defer cancel()
+
+	// Start watching before listing, so that changes in between the two are
+	// less likely to be missed.
+	stream, err := r.client.Watch(ctx, &registrypb.WatchRequest{
+		Type: r.peerType.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := r.list(ctx); err != nil {
+		return err
+	}
+
+	var (
+		events = make(chan *registrypb.WatchEvent)
+		errs   = make(chan error, 1)
+	)
+	go func() {
+		for {
+			event, err := stream.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case event := <-events:
+			r.apply(event)
+			r.update()
+		case <-r.resolveNow:
+			if err := r.list(ctx); err != nil {
+				return err
+			}
+		case err := <-errs:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// list replaces the current addresses with the services from the registry.
+// The tags of the listed members become the attributes of the addresses, any
+// address without a listed member keeps the attributes it already has.
+func (r *alchemyResolver) list(ctx context.Context) error {
+	res, err := r.client.ListServices(ctx, &registrypb.ListServicesRequest{
+		Type: r.peerType.String(),
+	})
+	if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	tags := make(map[string]map[string]string)
+	for _, member := range res.GetMembers() {
+		info, err := members.PeerInfoFromTags(member.GetTags())
+		if err != nil {
+			level.Debug(r.logger).Log("member", member.GetName(), "err", err)
+			continue
+		}
+		tags[net.JoinHostPort(info.APIAddr, strconv.Itoa(info.APIPort))] = member.GetTags()
+	}
+
+	addrs := make(map[string]resolver.Address)
+	for _, v := range res.GetServices()[r.peerType.String()].GetAddresses() {
+		if t, ok := tags[v]; ok {
+			addrs[v] = resolver.Address{
+				Addr:       v,
+				Attributes: tagsToAttributes(t),
+			}
+			continue
+		}
+		if addr, ok := r.addrs[v]; ok {
+			addrs[v] = addr
+			continue
+		}
+		addrs[v] = resolver.Address{
+			Addr: v,
+		}
+	}
+	r.addrs = addrs
+	r.update()
+
+	return nil
+}
+
+func (r *alchemyResolver) apply(event *registrypb.WatchEvent) {
+	for _, member := range event.GetMembers() {
+		info, err := members.PeerInfoFromTags(member.GetTags())
+		if err != nil {
+			level.Debug(r.logger).Log("member", member.GetName(), "err", err)
+			continue
+		}
+
+		addr := net.JoinHostPort(info.APIAddr, strconv.Itoa(info.APIPort))
+		switch event.GetType() {
+		case registrypb.WatchEvent_JOINED, registrypb.WatchEvent_UPDATED:
+			r.addrs[addr] = resolver.Address{
+				Addr:       addr,
+				Attributes: tagsToAttributes(member.GetTags()),
+			}
+		case registrypb.WatchEvent_LEFT, registrypb.WatchEvent_FAILED:
+			delete(r.addrs, addr)
+		}
+	}
+}
+
+// update pushes the current addresses to the client connection. An error from
+// the balancer rejecting the state isn't fatal to the watch, the next change
+// will be pushed regardless.
+func (r *alchemyResolver) update() {
+	addrs := make([]resolver.Address, 0, len(r.addrs))
+	for _, v := range r.addrs {
+		addrs = append(addrs, v)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return addrs[i].Addr < addrs[j].Addr
+	})
+
+	if err := r.cc.UpdateState(resolver.State{
+		Addresses: addrs,
+	}); err != nil {
+		level.Debug(r.logger).Log("reason", "update state", "err", err)
+	}
+}
+
+func tagsToAttributes(tags map[string]string) *attributes.Attributes {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var res *attributes.Attributes
+	for _, k := range keys {
+		if res == nil {
+			res = attributes.New(TagKey(k), tags[k])
+			continue
+		}
+		res = res.WithValue(TagKey(k), tags[k])
+	}
+	return res
+}
@@ -0,0 +1,205 @@
+package grpcresolver
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SimonRichardson/alchemy/pkg/registry/registrypb"
+	"github.com/go-kit/kit/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+func TestResolver(t *testing.T) {
+	t.Parallel()
+
+	t.Run("invalid target", func(t *testing.T) {
+		var (
+			client = newFakeClient(nil)
+			conn   = newFakeConn()
+		)
+
+		_, err := NewBuilder(client, log.NewNopLogger()).Build(target("alchemy:///bad"), conn, resolver.BuildOptions{})
+
+		if expected, actual := false, err == nil; expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+	})
+
+	t.Run("list and watch", func(t *testing.T) {
+		var (
+			client = newFakeClient([]string{"10.0.0.1:8080"})
+			conn   = newFakeConn()
+		)
+
+		r, err := NewBuilder(client, log.NewNopLogger()).Build(target("alchemy:///peertype:foo"), conn, resolver.BuildOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		if expected, actual := []string{"10.0.0.1:8080"}, conn.wait(t); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		client.events <- &registrypb.WatchEvent{
+			Type:    registrypb.WatchEvent_JOINED,
+			Members: []*registrypb.Member{member("b", "10.0.0.2", "eu")},
+		}
+		if expected, actual := []string{"10.0.0.1:8080", "10.0.0.2:8080"}, conn.wait(t); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		state := conn.lastState()
+		if expected, actual := "eu", state.Addresses[1].Attributes.Value(TagKey("zone")); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		client.events <- &registrypb.WatchEvent{
+			Type:    registrypb.WatchEvent_LEFT,
+			Members: []*registrypb.Member{member("b", "10.0.0.2", "eu")},
+		}
+		if expected, actual := []string{"10.0.0.1:8080"}, conn.wait(t); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("list with tags", func(t *testing.T) {
+		var (
+			client = newFakeClient([]string{"10.0.0.1:8080", "10.0.0.2:8080"})
+			conn   = newFakeConn()
+		)
+		client.members = []*registrypb.Member{member("a", "10.0.0.1", "us")}
+
+		r, err := NewBuilder(client, log.NewNopLogger()).Build(target("alchemy:///peertype:foo"), conn, resolver.BuildOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		if expected, actual := []string{"10.0.0.1:8080", "10.0.0.2:8080"}, conn.wait(t); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+
+		state := conn.lastState()
+		if expected, actual := "us", state.Addresses[0].Attributes.Value(TagKey("zone")); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := (*attributes.Attributes)(nil), state.Addresses[1].Attributes; expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func target(s string) resolver.Target {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return resolver.Target{URL: *u}
+}
+
+func member(name, addr, zone string) *registrypb.Member {
+	return &registrypb.Member{
+		Name: name,
+		Type: "peertype:foo",
+		Tags: map[string]string{
+			"name":     name,
+			"peertype": "peertype:foo",
+			"api_addr": addr,
+			"api_port": "8080",
+			"zone":     zone,
+		},
+	}
+}
+
+type fakeClient struct {
+	registrypb.RegistryClient
+	addrs   []string
+	members []*registrypb.Member
+	events  chan *registrypb.WatchEvent
+}
+
+func newFakeClient(addrs []string) *fakeClient {
+	return &fakeClient{
+		addrs:  addrs,
+		events: make(chan *registrypb.WatchEvent),
+	}
+}
+
+func (c *fakeClient) ListServices(ctx context.Context, in *registrypb.ListServicesRequest, opts ...grpc.CallOption) (*registrypb.ListServicesResponse, error) {
+	return &registrypb.ListServicesResponse{
+		Services: map[string]*registrypb.Addresses{
+			in.GetType(): &registrypb.Addresses{Addresses: c.addrs},
+		},
+		Members: c.members,
+	}, nil
+}
+
+func (c *fakeClient) Watch(ctx context.Context, in *registrypb.WatchRequest, opts ...grpc.CallOption) (registrypb.Registry_WatchClient, error) {
+	return &fakeWatchClient{ctx: ctx, events: c.events}, nil
+}
+
+type fakeWatchClient struct {
+	grpc.ClientStream
+	ctx    context.Context
+	events chan *registrypb.WatchEvent
+}
+
+func (c *fakeWatchClient) Recv() (*registrypb.WatchEvent, error) {
+	select {
+	case event := <-c.events:
+		return event, nil
+	case <-c.ctx.Done():
+		return nil, c.ctx.Err()
+	}
+}
+
+type fakeConn struct {
+	resolver.ClientConn
+	mtx    sync.Mutex
+	state  resolver.State
+	states chan []string
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{
+		states: make(chan []string, 16),
+	}
+}
+
+func (c *fakeConn) UpdateState(state resolver.State) error {
+	c.mtx.Lock()
+	c.state = state
+	c.mtx.Unlock()
+
+	addrs := make([]string, len(state.Addresses))
+	for k, v := range state.Addresses {
+		addrs[k] = v.Addr
+	}
+	c.states <- addrs
+	return nil
+}
+
+func (c *fakeConn) ReportError(error) {}
+
+func (c *fakeConn) lastState() resolver.State {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.state
+}
+
+func (c *fakeConn) wait(t *testing.T) []string {
+	select {
+	case addrs := <-c.states:
+		return addrs
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for state")
+	}
+	return nil
+}
@@ -2,6 +2,9 @@ package registry
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -10,6 +13,7 @@ import (
 	"github.com/SimonRichardson/alchemy/pkg/api"
 	"github.com/SimonRichardson/alchemy/pkg/cluster"
 	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/partition"
 	"github.com/SimonRichardson/alchemy/pkg/cluster/registry"
 	"github.com/SimonRichardson/alchemy/pkg/metrics"
 	"github.com/go-kit/kit/log"
@@ -20,11 +24,14 @@ import (
 
 // These are the registry API URL paths.
 const (
-	APIPathServicesQuery = "/services"
+	APIPathServicesQuery    = "/services"
+	APIPathConsistencyQuery = "/consistency"
+	APIPathPartitionsQuery  = "/partitions"
 )
 
 const (
-	defaultContentType = "application/json"
+	defaultContentType    = "application/json"
+	defaultForwardTimeout = time.Second * 5
 )
 
 // API wraps a registry and provides a basic HTTP API.
@@ -32,6 +39,9 @@ type API struct {
 	handler        http.Handler
 	peer           cluster.Peer
 	registry       registry.Registry
+	federation     cluster.Federation
+	consistency    *Consistency
+	client         *http.Client
 	tickerDuration time.Duration
 	stop           chan chan struct{}
 	logger         log.Logger
@@ -52,8 +62,33 @@ type API struct {
 //         Returns 400 Bad Request if the type is in an invalid format.
 //         Returns 404 Not Found if the type doesn't exist.
 //
+//     GET /services?dc={dc}
+//         Forwards the query to a registry in the remote datacenter, if the
+//         datacenter isn't the local datacenter. Otherwise returns only the
+//         services of the local datacenter.
+//         Returns 404 Not Found if the datacenter isn't part of the federation.
+//         Returns 502 Bad Gateway if the remote registry can't be reached.
+//
+//     GET /consistency
+//         Returns which nodes hold which ring checksum for each type.
+//         Returns 404 Not Found if the consistency isn't being checked.
+//
+//     GET /partitions
+//         Returns the assignment of the partitions, with its version and
+//         checksum, for each type that is placed on partitions.
+//
+//     GET /partitions?type={type}
+//         Returns the assignment of the partitions, with its version and
+//         checksum, for the type.
+//         Returns 400 Bad Request if the type is in an invalid format.
+//         Returns 404 Not Found if the type isn't placed on partitions.
+//
+// The federation is optional and can be nil, in which case only the local
+// datacenter can be queried. The consistency is also optional and can be nil.
 func NewAPI(peer cluster.Peer,
 	registry registry.Registry,
+	federation cluster.Federation,
+	consistency *Consistency,
 	tickerDuration time.Duration,
 	logger log.Logger,
 	clients metrics.Gauge,
@@ -62,6 +97,9 @@ func NewAPI(peer cluster.Peer,
 	api := &API{
 		peer:           peer,
 		registry:       registry,
+		federation:     federation,
+		consistency:    consistency,
+		client:         &http.Client{Timeout: defaultForwardTimeout},
 		tickerDuration: tickerDuration,
 		stop:           make(chan chan struct{}),
 		logger:         logger,
@@ -72,6 +110,8 @@ func NewAPI(peer cluster.Peer,
 	{
 		router := mux.NewRouter().StrictSlash(true)
 		router.Methods("GET").Path(APIPathServicesQuery).HandlerFunc(api.handleServices)
+		router.Methods("GET").Path(APIPathConsistencyQuery).HandlerFunc(api.handleConsistency)
+		router.Methods("GET").Path(APIPathPartitionsQuery).HandlerFunc(api.handlePartitions)
 		router.NotFoundHandler = http.HandlerFunc(api.errors.NotFound)
 		api.handler = router
 	}
@@ -94,9 +134,7 @@ func (a *API) Run() error {
 		case c := <-a.stop:
 			defer close(c)
 
-			if err := a.peer.DeregisterEventHandler(adapter); err != nil {
-				return err
-			}
+			return a.peer.DeregisterEventHandler(adapter)
 		}
 	}
 }
@@ -142,7 +180,20 @@ func (a *API) handleServices(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	services, err := a.peer.Current(params.Type)
+	if a.isRemote(params.Datacenter) {
+		a.forwardServices(w, r, params)
+		return
+	}
+
+	// Naming the local datacenter only returns the services of the local
+	// datacenter, which is how the other datacenters of the federation ask
+	// for the services without them being merged back again.
+	peer := a.peer
+	if params.Datacenter != "" {
+		peer = cluster.Local(peer)
+	}
+
+	services, err := peer.Current(params.Type)
 	if err != nil {
 		a.errors.InternalServerError(w, r, err.Error())
 		return
@@ -163,9 +214,134 @@ func (a *API) handleServices(w http.ResponseWriter, r *http.Request) {
 	result.EncodeTo(w)
 }
 
+func (a *API) handleConsistency(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	if a.consistency == nil {
+		a.errors.NotFound(w, r)
+		return
+	}
+
+	begin := time.Now()
+	reports := a.consistency.Reports()
+
+	headers := w.Header()
+	headers.Set(httpHeaderContentType, defaultContentType)
+	headers.Set(httpHeaderDuration, time.Since(begin).String())
+
+	if err := json.NewEncoder(w).Encode(struct {
+		Consistency map[string]ConsistencyReport `json:"consistency"`
+	}{
+		Consistency: reports,
+	}); err != nil {
+		a.errors.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (a *API) handlePartitions(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	begin := time.Now()
+
+	var params ServicesParams
+	if err := params.DecodeFrom(r.Header, r.URL.Query()); err != nil {
+		a.errors.BadRequest(w, r, err.Error())
+		return
+	}
+
+	tables := a.registry.Partitions()
+	if params.Type != cluster.PeerTypeAny {
+		table, ok := tables[params.Type.String()]
+		if !ok {
+			a.errors.NotFound(w, r)
+			return
+		}
+		tables = map[string]partition.Table{
+			params.Type.String(): table,
+		}
+	}
+
+	headers := w.Header()
+	headers.Set(httpHeaderContentType, defaultContentType)
+	headers.Set(httpHeaderDuration, time.Since(begin).String())
+	headers.Set(httpHeaderType, params.Type.String())
+
+	if err := json.NewEncoder(w).Encode(struct {
+		Partitions map[string]partition.Table `json:"partitions"`
+	}{
+		Partitions: tables,
+	}); err != nil {
+		a.errors.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (a *API) isRemote(dc string) bool {
+	if dc == "" {
+		return false
+	}
+	return a.federation == nil || dc != a.federation.Datacenter()
+}
+
+// forwardServices sends the services query on to a registry in a remote
+// datacenter and replays the response back to the client.
+func (a *API) forwardServices(w http.ResponseWriter, r *http.Request, params ServicesParams) {
+	if a.federation == nil {
+		a.errors.NotFound(w, r)
+		return
+	}
+
+	registries, err := a.federation.Registries(params.Datacenter)
+	if err != nil {
+		a.errors.InternalServerError(w, r, err.Error())
+		return
+	}
+	if len(registries) == 0 {
+		a.errors.NotFound(w, r)
+		return
+	}
+
+	u := url.URL{
+		Scheme:   "http",
+		Host:     registries[rand.Intn(len(registries))],
+		Path:     fmt.Sprintf("/registry%s", APIPathServicesQuery),
+		RawQuery: r.URL.RawQuery,
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		a.errors.InternalServerError(w, r, err.Error())
+		return
+	}
+	req.Header.Set("Accept", defaultContentType)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		a.errors.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	headers := w.Header()
+	for _, k := range []string{
+		httpHeaderContentType,
+		httpHeaderDuration,
+		httpHeaderType,
+	} {
+		if v := resp.Header.Get(k); v != "" {
+			headers.Set(k, v)
+		}
+	}
+	headers.Set(httpHeaderDatacenter, params.Datacenter)
+	w.WriteHeader(resp.StatusCode)
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		level.Warn(a.logger).Log("reason", "forwarding", "dc", params.Datacenter, "err", err)
+	}
+}
+
 // ServicesParams handles
 type ServicesParams struct {
-	Type members.PeerType
+	Type       members.PeerType
+	Datacenter string
 }
 
 // DecodeFrom populates a ServicesParams from a Request.
@@ -179,6 +355,8 @@ func (p *ServicesParams) DecodeFrom(headers http.Header, values url.Values) (err
 	} else {
 		p.Type, err = cluster.ParsePeerType(typ)
 	}
+
+	p.Datacenter = values.Get("dc")
 	return
 }
 
@@ -211,6 +389,7 @@ const (
 	httpHeaderContentType = "Content-Type"
 	httpHeaderDuration    = "X-Duration"
 	httpHeaderType        = "X-Type"
+	httpHeaderDatacenter  = "X-Datacenter"
 )
 
 type eventAdapter struct {
@@ -219,7 +398,7 @@ type eventAdapter struct {
 
 func (e eventAdapter) HandleEvent(event members.Event) error {
 	if event.Type() == members.EventMember {
-		memberEvent, ok := event.(members.MemberEvent)
+		memberEvent, ok := event.(*members.MemberEvent)
 		if !ok {
 			return nil
 		}
@@ -228,7 +407,7 @@ func (e eventAdapter) HandleEvent(event members.Event) error {
 		switch memberEvent.EventType {
 		case members.EventMemberJoined:
 			fn = e.registry.Add
-		case members.EventMemberLeft:
+		case members.EventMemberLeft, members.EventMemberFailed:
 			fn = e.registry.Remove
 		case members.EventMemberUpdated:
 			fn = e.registry.Update
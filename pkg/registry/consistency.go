@@ -0,0 +1,269 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/registry"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// ChecksumTagPrefix prefixes the member tags that advertise the checksum
+	// of the placement for each peer type.
+	ChecksumTagPrefix = "checksum:"
+)
+
+// ConsistencyReport describes which nodes hold which checksum for a peer
+// type. When the nodes don't all use the same hash, the report also describes
+// which nodes use which hash, as the checksums will never agree.
+type ConsistencyReport struct {
+	Consistent    bool                `json:"consistent"`
+	DivergedSince *time.Time          `json:"diverged_since,omitempty"`
+	Checksums     map[string][]string `json:"checksums"`
+	Hashes        map[string][]string `json:"hashes,omitempty"`
+}
+
+// Consistency advertises the checksums of the registry to the cluster and
+// checks that every node in the cluster agrees on the checksums. Nodes will
+// disagree for a short while as changes are gossiped, so a disagreement is
+// only reported once it lasts longer than the threshold.
+type Consistency struct {
+	peer      cluster.Peer
+	registry  registry.Registry
+	interval  time.Duration
+	threshold time.Duration
+	stop      chan chan struct{}
+	logger    log.Logger
+
+	mtx        sync.RWMutex
+	advertised map[string]string
+	reports    map[string]ConsistencyReport
+	diverged   map[string]time.Time
+	hashes     map[string][]string
+
+	checksumsDesc *prometheus.Desc
+	divergedDesc  *prometheus.Desc
+	hashesDesc    *prometheus.Desc
+}
+
+// NewConsistency creates a Consistency that checks the cluster every
+// interval.
+func NewConsistency(peer cluster.Peer,
+	registry registry.Registry,
+	interval, threshold time.Duration,
+	namespace string,
+	logger log.Logger,
+) *Consistency {
+	return &Consistency{
+		peer:      peer,
+		registry:  registry,
+		interval:  interval,
+		threshold: threshold,
+		stop:      make(chan chan struct{}),
+		logger:    logger,
+		reports:   make(map[string]ConsistencyReport),
+		diverged:  make(map[string]time.Time),
+		checksumsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "ring", "checksums"),
+			"Number of different ring checksums held by the nodes in the cluster.",
+			[]string{"peer_type"}, nil,
+		),
+		divergedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "ring", "diverged"),
+			"Whether the nodes in the cluster have disagreed on the ring for longer than the threshold.",
+			[]string{"peer_type"}, nil,
+		),
+		hashesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "cluster", "hashes"),
+			"Number of different hashes used by the nodes in the cluster.",
+			nil, nil,
+		),
+	}
+}
+
+// Run the consistency checks until Stop is called.
+func (c *Consistency) Run() error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.advertise(); err != nil {
+				level.Warn(c.logger).Log("reason", "advertise checksums", "err", err)
+			}
+			if err := c.check(time.Now()); err != nil {
+				level.Warn(c.logger).Log("reason", "check checksums", "err", err)
+			}
+
+		case ch := <-c.stop:
+			close(ch)
+			return nil
+		}
+	}
+}
+
+// Stop the consistency checks.
+func (c *Consistency) Stop() {
+	ch := make(chan struct{})
+	c.stop <- ch
+	<-ch
+}
+
+// Reports returns the latest consistency report for each peer type.
+func (c *Consistency) Reports() map[string]ConsistencyReport {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	res := make(map[string]ConsistencyReport, len(c.reports))
+	for k, v := range c.reports {
+		res[k] = v
+	}
+	return res
+}
+
+// Describe implements prometheus.Collector
+func (c *Consistency) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.checksumsDesc
+	ch <- c.divergedDesc
+	ch <- c.hashesDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *Consistency) Collect(ch chan<- prometheus.Metric) {
+	for peerType, report := range c.Reports() {
+		var diverged float64
+		if report.DivergedSince != nil {
+			diverged = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.checksumsDesc, prometheus.GaugeValue, float64(len(report.Checksums)), peerType)
+		ch <- prometheus.MustNewConstMetric(c.divergedDesc, prometheus.GaugeValue, diverged, peerType)
+	}
+
+	c.mtx.RLock()
+	hashes := len(c.hashes)
+	c.mtx.RUnlock()
+	ch <- prometheus.MustNewConstMetric(c.hashesDesc, prometheus.GaugeValue, float64(hashes))
+}
+
+// advertise the checksums of the registry in the tags of the peer, only
+// when they've changed, so that gossip isn't wasted.
+func (c *Consistency) advertise() error {
+	tags := make(map[string]string)
+	for k, v := range c.registry.Checksums() {
+		tags[ChecksumTagPrefix+k] = fmt.Sprintf("%08x", v)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if equalTags(c.advertised, tags) {
+		return nil
+	}
+	if err := c.peer.SetTags(tags); err != nil {
+		return err
+	}
+	c.advertised = tags
+	return nil
+}
+
+// check gathers the checksums and the hashes that each node advertises and
+// updates the reports.
+func (c *Consistency) check(now time.Time) error {
+	var (
+		checksums = make(map[string]map[string][]string)
+		hashes    = make(map[string][]string)
+	)
+	if err := c.peer.Walk(func(info members.PeerInfo) error {
+		if hash, ok := info.Tags[members.HashTag]; ok {
+			hashes[hash] = append(hashes[hash], info.Name)
+		}
+		for k, v := range info.Tags {
+			if !strings.HasPrefix(k, ChecksumTagPrefix) {
+				continue
+			}
+
+			peerType := strings.TrimPrefix(k, ChecksumTagPrefix)
+			if _, ok := checksums[peerType]; !ok {
+				checksums[peerType] = make(map[string][]string)
+			}
+			checksums[peerType][v] = append(checksums[peerType][v], info.Name)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, v := range hashes {
+		sort.Strings(v)
+	}
+	mismatched := len(hashes) > 1
+	if mismatched {
+		level.Warn(c.logger).Log("reason", "hash mismatch", "hashes", len(hashes))
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	reports := make(map[string]ConsistencyReport, len(checksums))
+	for peerType, nodes := range checksums {
+		for _, v := range nodes {
+			sort.Strings(v)
+		}
+
+		report := ConsistencyReport{
+			Consistent: len(nodes) == 1,
+			Checksums:  nodes,
+		}
+		if mismatched {
+			report.Hashes = hashes
+		}
+		if report.Consistent {
+			delete(c.diverged, peerType)
+			reports[peerType] = report
+			continue
+		}
+
+		since, ok := c.diverged[peerType]
+		if !ok {
+			since = now
+			c.diverged[peerType] = now
+		}
+		if now.Sub(since) >= c.threshold {
+			report.DivergedSince = &since
+			level.Warn(c.logger).Log("reason", "ring diverged", "peer_type", peerType, "since", since, "checksums", len(nodes))
+		}
+		reports[peerType] = report
+	}
+
+	// Forget about any peer types that have gone away.
+	for peerType := range c.diverged {
+		if _, ok := checksums[peerType]; !ok {
+			delete(c.diverged, peerType)
+		}
+	}
+	c.reports = reports
+	c.hashes = hashes
+
+	return nil
+}
+
+func equalTags(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
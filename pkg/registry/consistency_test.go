@@ -0,0 +1,169 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	clusterMocks "github.com/SimonRichardson/alchemy/pkg/cluster/mocks"
+	registryMocks "github.com/SimonRichardson/alchemy/pkg/cluster/registry/mocks"
+	"github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+)
+
+func TestConsistency(t *testing.T) {
+	t.Parallel()
+
+	t.Run("advertise", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			peer        = clusterMocks.NewMockPeer(ctrl)
+			reg         = registryMocks.NewMockRegistry(ctrl)
+			consistency = NewConsistency(peer, reg, time.Second, time.Minute, "alchemy", log.NewNopLogger())
+		)
+
+		reg.EXPECT().Checksums().Return(map[string]uint32{
+			"peertype:registry": 0xff,
+		}).Times(2)
+		peer.EXPECT().SetTags(map[string]string{
+			"checksum:peertype:registry": "000000ff",
+		}).Return(nil).Times(1)
+
+		// Advertising the same checksums twice should only gossip once.
+		for i := 0; i < 2; i++ {
+			if err := consistency.advertise(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	t.Run("consistent", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			peer        = clusterMocks.NewMockPeer(ctrl)
+			reg         = registryMocks.NewMockRegistry(ctrl)
+			consistency = NewConsistency(peer, reg, time.Second, time.Minute, "alchemy", log.NewNopLogger())
+		)
+
+		peer.EXPECT().Walk(PeerInfos(
+			checksumInfo("a", "000000ff"),
+			checksumInfo("b", "000000ff"),
+		)).Return(nil)
+
+		if err := consistency.check(time.Now()); err != nil {
+			t.Fatal(err)
+		}
+
+		report := consistency.Reports()["peertype:registry"]
+		if expected, actual := true, report.Consistent; expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+		if expected, actual := 2, len(report.Checksums["000000ff"]); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("diverged", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			peer        = clusterMocks.NewMockPeer(ctrl)
+			reg         = registryMocks.NewMockRegistry(ctrl)
+			consistency = NewConsistency(peer, reg, time.Second, time.Minute, "alchemy", log.NewNopLogger())
+			now         = time.Now()
+		)
+
+		peer.EXPECT().Walk(PeerInfos(
+			checksumInfo("a", "000000ff"),
+			checksumInfo("b", "000000fe"),
+		)).Return(nil).Times(2)
+
+		// Disagreeing within the threshold isn't reported as diverged.
+		if err := consistency.check(now); err != nil {
+			t.Fatal(err)
+		}
+		report := consistency.Reports()["peertype:registry"]
+		if expected, actual := false, report.Consistent; expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+		if expected, actual := true, report.DivergedSince == nil; expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+
+		if err := consistency.check(now.Add(time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		report = consistency.Reports()["peertype:registry"]
+		if expected, actual := true, report.DivergedSince != nil && report.DivergedSince.Equal(now); expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+	})
+
+	t.Run("hash mismatch", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			peer        = clusterMocks.NewMockPeer(ctrl)
+			reg         = registryMocks.NewMockRegistry(ctrl)
+			consistency = NewConsistency(peer, reg, time.Second, time.Minute, "alchemy", log.NewNopLogger())
+			a           = checksumInfo("a", "000000ff")
+			b           = checksumInfo("b", "000000fe")
+		)
+		a.Tags[members.HashTag] = "murmur3"
+		b.Tags[members.HashTag] = "xxhash"
+
+		peer.EXPECT().Walk(PeerInfos(a, b)).Return(nil)
+
+		if err := consistency.check(time.Now()); err != nil {
+			t.Fatal(err)
+		}
+
+		report := consistency.Reports()["peertype:registry"]
+		want := map[string][]string{
+			"murmur3": []string{"a"},
+			"xxhash":  []string{"b"},
+		}
+		if expected, actual := want, report.Hashes; !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func checksumInfo(name, checksum string) members.PeerInfo {
+	return members.PeerInfo{
+		Name:     name,
+		PeerType: "peertype:registry",
+		Tags: map[string]string{
+			ChecksumTagPrefix + "peertype:registry": checksum,
+		},
+	}
+}
+
+type peerInfoMatcher struct {
+	infos []members.PeerInfo
+}
+
+func (m peerInfoMatcher) Matches(x interface{}) bool {
+	if fn, ok := x.(func(members.PeerInfo) error); ok {
+		for _, v := range m.infos {
+			if err := fn(v); err != nil {
+				panic(err)
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (peerInfoMatcher) String() string {
+	return "is func"
+}
+
+func PeerInfos(infos ...members.PeerInfo) gomock.Matcher { return peerInfoMatcher{infos} }
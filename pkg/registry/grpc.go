@@ -0,0 +1,229 @@
+package registry
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/registry"
+	"github.com/SimonRichardson/alchemy/pkg/registry/registrypb"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultWatchBuffer = 64
+)
+
+// GRPCServer mirrors the registry API over gRPC, along with a way to stream
+// the membership changes of the cluster.
+type GRPCServer struct {
+	registrypb.UnimplementedRegistryServer
+
+	peer     cluster.Peer
+	registry registry.Registry
+	logger   log.Logger
+}
+
+// NewGRPCServer creates a GRPCServer with the correct dependencies.
+// The GRPCServer can be registered with a grpc.Server using
+// registrypb.RegisterRegistryServer.
+func NewGRPCServer(peer cluster.Peer,
+	registry registry.Registry,
+	logger log.Logger,
+) *GRPCServer {
+	return &GRPCServer{
+		peer:     peer,
+		registry: registry,
+		logger:   logger,
+	}
+}
+
+// ListServices returns the current list of services according to the
+// registry, along with the members of the local datacenter and their tags.
+func (s *GRPCServer) ListServices(ctx context.Context, req *registrypb.ListServicesRequest) (*registrypb.ListServicesResponse, error) {
+	peerType, err := parsePeerType(req.GetType())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	services, err := s.peer.Current(peerType)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if peerType != cluster.PeerTypeAny {
+		if list, ok := services[peerType]; !ok || len(list) == 0 {
+			return nil, status.Errorf(codes.NotFound, "%s not found", peerType)
+		}
+	}
+
+	res := &registrypb.ListServicesResponse{
+		Services: make(map[string]*registrypb.Addresses, len(services)),
+	}
+	for k, v := range services {
+		res.Services[k.String()] = &registrypb.Addresses{
+			Addresses: v,
+		}
+	}
+
+	// The members carry the tags, which the addresses alone can't.
+	if err := s.peer.Walk(func(info members.PeerInfo) error {
+		if peerType == cluster.PeerTypeAny || info.PeerType == peerType {
+			res.Members = append(res.Members, &registrypb.Member{
+				Name: info.Name,
+				Type: info.PeerType.String(),
+				Tags: info.Tags,
+			})
+		}
+		return nil
+	}); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	sort.Slice(res.Members, func(i, j int) bool {
+		return res.Members[i].GetName() < res.Members[j].GetName()
+	})
+	return res, nil
+}
+
+// Lookup returns the members that own the key for a given peer type.
+func (s *GRPCServer) Lookup(ctx context.Context, req *registrypb.LookupRequest) (*registrypb.LookupResponse, error) {
+	peerType, err := cluster.ParsePeerType(req.GetType())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// Without a number of members the configured replicas of the registry
+	// own the key.
+	n := int(req.GetN())
+	if n <= 0 {
+		n = s.registry.Replicas()
+	}
+
+	keys, ok := s.registry.Lookup(peerType.String(), req.GetKey(), n)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "%s not found", peerType)
+	}
+
+	res := &registrypb.LookupResponse{
+		Members: make([]*registrypb.Member, len(keys)),
+	}
+	for k, v := range keys {
+		res.Members[k] = &registrypb.Member{
+			Name:    v.Name(),
+			Type:    v.Type(),
+			Address: v.Address(),
+			Tags:    v.Tags(),
+		}
+	}
+	return res, nil
+}
+
+// Watch streams the membership changes of the cluster until the client goes
+// away. If the client can't keep up with the changes, the stream is ended with
+// ResourceExhausted, as the client has missed changes and has to list the
+// services again before watching.
+func (s *GRPCServer) Watch(req *registrypb.WatchRequest, stream registrypb.Registry_WatchServer) error {
+	peerType, err := parsePeerType(req.GetType())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	handler := newWatchHandler(peerType, defaultWatchBuffer)
+	if err := s.peer.RegisterEventHandler(handler); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer func() {
+		if err := s.peer.DeregisterEventHandler(handler); err != nil {
+			level.Warn(s.logger).Log("reason", "deregister watch", "err", err)
+		}
+	}()
+
+	for {
+		select {
+		case event := <-handler.events:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		case <-handler.overflow:
+			return status.Error(codes.ResourceExhausted, "watch fell behind, events were dropped")
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func parsePeerType(t string) (members.PeerType, error) {
+	if t == "" {
+		return cluster.PeerTypeAny, nil
+	}
+	return cluster.ParsePeerType(t)
+}
+
+// watchHandler converts member events into watch events for a stream.
+type watchHandler struct {
+	peerType members.PeerType
+	events   chan *registrypb.WatchEvent
+	overflow chan struct{}
+	once     sync.Once
+}
+
+func newWatchHandler(peerType members.PeerType, size int) *watchHandler {
+	return &watchHandler{
+		peerType: peerType,
+		events:   make(chan *registrypb.WatchEvent, size),
+		overflow: make(chan struct{}),
+	}
+}
+
+func (h *watchHandler) HandleEvent(event members.Event) error {
+	memberEvent, ok := event.(*members.MemberEvent)
+	if !ok {
+		return nil
+	}
+
+	var typ registrypb.WatchEvent_Type
+	switch memberEvent.EventType {
+	case members.EventMemberJoined:
+		typ = registrypb.WatchEvent_JOINED
+	case members.EventMemberLeft:
+		typ = registrypb.WatchEvent_LEFT
+	case members.EventMemberFailed:
+		typ = registrypb.WatchEvent_FAILED
+	case members.EventMemberUpdated:
+		typ = registrypb.WatchEvent_UPDATED
+	default:
+		return nil
+	}
+
+	var m []*registrypb.Member
+	for _, v := range memberEvent.Members {
+		if h.peerType != cluster.PeerTypeAny && v.PeerType() != h.peerType {
+			continue
+		}
+		m = append(m, &registrypb.Member{
+			Name:    v.Name(),
+			Type:    v.PeerType().String(),
+			Address: v.Address(),
+			Tags:    v.Tags(),
+		})
+	}
+	if len(m) == 0 {
+		return nil
+	}
+
+	select {
+	case h.events <- &registrypb.WatchEvent{Type: typ, Members: m}:
+		return nil
+	default:
+		// Once an event is dropped the stream can't be trusted, so the
+		// stream is told to end.
+		h.once.Do(func() { close(h.overflow) })
+		return errors.Errorf("watch buffer full, dropping event")
+	}
+}
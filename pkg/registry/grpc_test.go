@@ -0,0 +1,248 @@
+package registry
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/members"
+	clusterMocks "github.com/SimonRichardson/alchemy/pkg/cluster/mocks"
+	"github.com/SimonRichardson/alchemy/pkg/cluster/registry"
+	registryMocks "github.com/SimonRichardson/alchemy/pkg/cluster/registry/mocks"
+	"github.com/SimonRichardson/alchemy/pkg/registry/registrypb"
+	"github.com/go-kit/kit/log"
+	"github.com/golang/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCServer(t *testing.T) {
+	t.Parallel()
+
+	t.Run("list services", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			peer     = clusterMocks.NewMockPeer(ctrl)
+			reg      = registryMocks.NewMockRegistry(ctrl)
+			server   = NewGRPCServer(peer, reg, log.NewNopLogger())
+			services = map[members.PeerType][]string{
+				"peertype:registry": []string{"10.0.0.1:8080"},
+			}
+		)
+
+		peer.EXPECT().Current(members.PeerType("peertype:registry")).Return(services, nil)
+		peer.EXPECT().Walk(gomock.Any()).DoAndReturn(func(fn func(members.PeerInfo) error) error {
+			for _, v := range []members.PeerInfo{
+				{Name: "b", PeerType: "peertype:other", Tags: map[string]string{"zone": "us"}},
+				{Name: "a", PeerType: "peertype:registry", Tags: map[string]string{"zone": "eu"}},
+			} {
+				if err := fn(v); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		res, err := server.ListServices(context.Background(), &registrypb.ListServicesRequest{
+			Type: "peertype:registry",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{"10.0.0.1:8080"}
+		if expected, actual := want, res.Services["peertype:registry"].GetAddresses(); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 1, len(res.GetMembers()); expected != actual {
+			t.Fatalf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := "eu", res.GetMembers()[0].GetTags()["zone"]; expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("list services with invalid type", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			peer   = clusterMocks.NewMockPeer(ctrl)
+			reg    = registryMocks.NewMockRegistry(ctrl)
+			server = NewGRPCServer(peer, reg, log.NewNopLogger())
+		)
+
+		_, err := server.ListServices(context.Background(), &registrypb.ListServicesRequest{
+			Type: "bad",
+		})
+
+		if expected, actual := codes.InvalidArgument, status.Code(err); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			peer   = clusterMocks.NewMockPeer(ctrl)
+			reg    = registryMocks.NewMockRegistry(ctrl)
+			server = NewGRPCServer(peer, reg, log.NewNopLogger())
+			member = memberKey{"a", "peertype:registry", "10.0.0.1:8079"}
+		)
+
+		reg.EXPECT().Lookup("peertype:registry", "key", 2).Return([]registry.Key{member}, true)
+
+		res, err := server.Lookup(context.Background(), &registrypb.LookupRequest{
+			Type: "peertype:registry",
+			Key:  "key",
+			N:    2,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, actual := 1, len(res.Members); expected != actual {
+			t.Fatalf("expected: %d, actual: %d", expected, actual)
+		}
+		if expected, actual := "10.0.0.1:8079", res.Members[0].GetAddress(); expected != actual {
+			t.Errorf("expected: %q, actual: %q", expected, actual)
+		}
+	})
+
+	t.Run("watch overflow", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			peer       = clusterMocks.NewMockPeer(ctrl)
+			reg        = registryMocks.NewMockRegistry(ctrl)
+			server     = NewGRPCServer(peer, reg, log.NewNopLogger())
+			registered = make(chan members.EventHandler, 1)
+			stream     = &blockingWatchStream{
+				ctx:     context.Background(),
+				release: make(chan struct{}),
+			}
+		)
+
+		peer.EXPECT().RegisterEventHandler(gomock.Any()).DoAndReturn(func(h members.EventHandler) error {
+			registered <- h
+			return nil
+		})
+		peer.EXPECT().DeregisterEventHandler(gomock.Any()).Return(nil)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- server.Watch(&registrypb.WatchRequest{}, stream)
+		}()
+
+		// The first event blocks the stream, the rest fill the buffer until
+		// an event has to be dropped.
+		handler := <-registered
+		for i := 0; i <= defaultWatchBuffer+1; i++ {
+			handler.HandleEvent(members.NewMemberEvent(members.EventMemberJoined, []members.Member{
+				memberKey{"a", "peertype:registry", "10.0.0.1:8079"},
+			}))
+		}
+		close(stream.release)
+
+		if expected, actual := codes.ResourceExhausted, status.Code(<-done); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+
+	t.Run("lookup not found", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		var (
+			peer   = clusterMocks.NewMockPeer(ctrl)
+			reg    = registryMocks.NewMockRegistry(ctrl)
+			server = NewGRPCServer(peer, reg, log.NewNopLogger())
+		)
+
+		reg.EXPECT().Replicas().Return(3)
+		reg.EXPECT().Lookup("peertype:registry", "key", 3).Return(nil, false)
+
+		_, err := server.Lookup(context.Background(), &registrypb.LookupRequest{
+			Type: "peertype:registry",
+			Key:  "key",
+		})
+
+		if expected, actual := codes.NotFound, status.Code(err); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+	})
+}
+
+func TestWatchHandler(t *testing.T) {
+	t.Parallel()
+
+	t.Run("filters peer type", func(t *testing.T) {
+		handler := newWatchHandler("peertype:registry", 1)
+
+		err := handler.HandleEvent(members.NewMemberEvent(members.EventMemberJoined, []members.Member{
+			memberKey{"a", "peertype:registry", "10.0.0.1:8079"},
+			memberKey{"b", "peertype:other", "10.0.0.2:8079"},
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		event := <-handler.events
+		if expected, actual := registrypb.WatchEvent_JOINED, event.GetType(); expected != actual {
+			t.Errorf("expected: %v, actual: %v", expected, actual)
+		}
+		if expected, actual := 1, len(event.GetMembers()); expected != actual {
+			t.Errorf("expected: %d, actual: %d", expected, actual)
+		}
+	})
+
+	t.Run("full buffer", func(t *testing.T) {
+		handler := newWatchHandler("peertype:*", 0)
+
+		err := handler.HandleEvent(members.NewMemberEvent(members.EventMemberLeft, []members.Member{
+			memberKey{"a", "peertype:registry", "10.0.0.1:8079"},
+		}))
+
+		if expected, actual := false, err == nil; expected != actual {
+			t.Errorf("expected: %t, actual: %t", expected, actual)
+		}
+
+		select {
+		case <-handler.overflow:
+		default:
+			t.Errorf("expected: overflow, actual: none")
+		}
+	})
+}
+
+// blockingWatchStream blocks sending any event until it's released.
+type blockingWatchStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	release chan struct{}
+}
+
+func (s *blockingWatchStream) Send(*registrypb.WatchEvent) error {
+	<-s.release
+	return nil
+}
+
+func (s *blockingWatchStream) Context() context.Context {
+	return s.ctx
+}
+
+type memberKey struct {
+	name, peerType, address string
+}
+
+func (m memberKey) Name() string               { return m.name }
+func (m memberKey) Type() string               { return m.peerType }
+func (m memberKey) PeerType() members.PeerType { return members.PeerType(m.peerType) }
+func (m memberKey) Address() string            { return m.address }
+func (m memberKey) Tags() map[string]string    { return map[string]string{} }
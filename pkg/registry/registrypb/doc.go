@@ -0,0 +1,5 @@
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative registry.proto
+
+// Package registrypb contains the generated protocol buffers and gRPC service
+// definitions for the registry.
+package registrypb
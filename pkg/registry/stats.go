@@ -0,0 +1,80 @@
+package registry
+
+import (
+	"github.com/SimonRichardson/alchemy/pkg/cluster/registry"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// StatsCollector exports how balanced the ownership of the registry is, per
+// peer type, as Prometheus gauges. The statistics are gathered when the
+// metrics are collected, so they're always up to date.
+type StatsCollector struct {
+	registry    registry.Registry
+	hosts       *prometheus.Desc
+	points      *prometheus.Desc
+	collisions  *prometheus.Desc
+	ownership   *prometheus.Desc
+	stdDev      *prometheus.Desc
+	maxOverMean *prometheus.Desc
+}
+
+// NewStatsCollector creates a StatsCollector for the registry.
+func NewStatsCollector(namespace string, registry registry.Registry) *StatsCollector {
+	return &StatsCollector{
+		registry: registry,
+		hosts: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "ring", "hosts"),
+			"Number of hosts on the ring.",
+			[]string{"peer_type"}, nil,
+		),
+		points: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "ring", "points"),
+			"Number of virtual nodes on the ring.",
+			[]string{"peer_type"}, nil,
+		),
+		collisions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "ring", "collisions"),
+			"Number of virtual nodes that were rehashed because of a collision.",
+			[]string{"peer_type"}, nil,
+		),
+		ownership: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "ring", "ownership_ratio"),
+			"Fraction of the keyspace owned by a host.",
+			[]string{"peer_type", "host"}, nil,
+		),
+		stdDev: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "ring", "ownership_stddev"),
+			"Standard deviation of the fraction of the keyspace owned by each host.",
+			[]string{"peer_type"}, nil,
+		),
+		maxOverMean: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "ring", "ownership_max_over_mean"),
+			"Largest fraction of the keyspace owned by a host over the mean.",
+			[]string{"peer_type"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *StatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hosts
+	ch <- c.points
+	ch <- c.collisions
+	ch <- c.ownership
+	ch <- c.stdDev
+	ch <- c.maxOverMean
+}
+
+// Collect implements prometheus.Collector
+func (c *StatsCollector) Collect(ch chan<- prometheus.Metric) {
+	for peerType, stats := range c.registry.Stats() {
+		ch <- prometheus.MustNewConstMetric(c.hosts, prometheus.GaugeValue, float64(stats.Hosts), peerType)
+		ch <- prometheus.MustNewConstMetric(c.points, prometheus.GaugeValue, float64(stats.Points), peerType)
+		ch <- prometheus.MustNewConstMetric(c.collisions, prometheus.GaugeValue, float64(stats.Collisions), peerType)
+		ch <- prometheus.MustNewConstMetric(c.stdDev, prometheus.GaugeValue, stats.StdDev, peerType)
+		ch <- prometheus.MustNewConstMetric(c.maxOverMean, prometheus.GaugeValue, stats.MaxOverMean, peerType)
+		for host, ownership := range stats.Ownership {
+			ch <- prometheus.MustNewConstMetric(c.ownership, prometheus.GaugeValue, ownership, peerType, host)
+		}
+	}
+}
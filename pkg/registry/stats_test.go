@@ -0,0 +1,45 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/SimonRichardson/alchemy/pkg/cluster/hashring"
+	registryMocks "github.com/SimonRichardson/alchemy/pkg/cluster/registry/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStatsCollector(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	reg := registryMocks.NewMockRegistry(ctrl)
+	reg.EXPECT().Stats().Return(map[string]hashring.Stats{
+		"peertype:registry": hashring.Stats{
+			Hosts:  2,
+			Points: 10,
+			Ownership: map[string]float64{
+				"10.0.0.1:8079": 0.4,
+				"10.0.0.2:8079": 0.6,
+			},
+		},
+	})
+
+	var (
+		collector = NewStatsCollector("alchemy", reg)
+		ch        = make(chan prometheus.Metric, 16)
+	)
+	collector.Collect(ch)
+	close(ch)
+
+	var metrics int
+	for range ch {
+		metrics++
+	}
+
+	if expected, actual := 7, metrics; expected != actual {
+		t.Errorf("expected: %d, actual: %d", expected, actual)
+	}
+}